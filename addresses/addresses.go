@@ -2,42 +2,56 @@ package addresses
 
 import (
 	"encoding/json"
-	"errors"
-	"fmt"
 	"net"
 	"net/http"
+	"reflect"
 	"strconv"
 	"strings"
+	"syscall"
 
 	log "github.com/Sirupsen/logrus"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/boltdb/bolt"
-	"github.com/vishvananda/netlink"
 
-	"github.com/guilhem/tentacool/dhcp"
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/dbutil"
+	"github.com/guilhem/tentacool/linkwatch"
+	"github.com/guilhem/tentacool/types"
 )
 
-type addressStruct struct {
-	ID   string `json:"id"`
-	Link string `json:"link"`
-	IP   string `json:"ip"`
-}
+type addressStruct = types.Address
+
+// Address is an address managed on a link
+type Address = addressStruct
+
+// Status of an address in the kernel
+const (
+	StatusApplied     = "applied"
+	StatusMissing     = "missing"
+	StatusConflicting = "conflicting"
+	StatusLinkAbsent  = "link-absent"
+	StatusDADFailed   = "dad-failed"
+)
 
 const (
 	defaultIface  = "eth0"
 	addressBucket = "address"
 )
 
-var db *bolt.DB
+// Handler serves the addresses API
+type Handler struct {
+	DB      *bolt.DB
+	Backend Backend
+}
 
 // GetAddresses returns all registered addresses
-func GetAddresses(w rest.ResponseWriter, req *rest.Request) {
+func (h *Handler) GetAddresses(w rest.ResponseWriter, req *rest.Request) {
 	addresses := []addressStruct{}
-	err := db.View(func(tx *bolt.Tx) (err error) {
+	err := h.DB.View(func(tx *bolt.Tx) (err error) {
 		b := tx.Bucket([]byte(addressBucket))
-		address := addressStruct{}
 		b.ForEach(func(k, v []byte) (err error) {
+			address := addressStruct{}
 			err = json.Unmarshal(v, &address)
 			if err != nil {
 				return
@@ -48,133 +62,421 @@ func GetAddresses(w rest.ResponseWriter, req *rest.Request) {
 		return
 	})
 	if err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, err)
 		return
 	}
-	log.Printf("GetAddresses requested : %s", addresses)
+	if err := h.Backend.Status(addresses); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	log.Printf("GetAddresses requested : %v", addresses)
 	w.WriteJson(addresses)
 }
 
-// GetAddress returns the address with the specified ID
-func GetAddress(w rest.ResponseWriter, req *rest.Request) {
-	id := req.PathParam("address")
-	address := addressStruct{}
-	err := db.View(func(tx *bolt.Tx) (err error) {
+// Validate checks an address like the API does
+func Validate(a Address) error {
+	return validate(a)
+}
+
+// validate checks the fields set by clients
+func validate(a addressStruct) error {
+	if a.Link == "" {
+		return apierror.Invalid("link", "Link is empty")
+	}
+	if a.IP == "" {
+		return apierror.Invalid("ip", "IP is empty")
+	}
+	ip, _, err := net.ParseCIDR(a.IP)
+	if err != nil {
+		return apierror.Invalid("ip", "%s", err)
+	}
+	v4 := ip.To4() != nil
+
+	if a.ValidLft < 0 || int64(a.ValidLft) >= forever {
+		return apierror.Invalid("valid_lft", "Invalid lifetime %d", a.ValidLft)
+	}
+	if a.PreferredLft < 0 || int64(a.PreferredLft) >= forever {
+		return apierror.Invalid("preferred_lft", "Invalid lifetime %d", a.PreferredLft)
+	}
+	if a.ValidLft != 0 && a.PreferredLft > a.ValidLft {
+		return apierror.Invalid("preferred_lft", "Preferred lifetime longer than the valid one")
+	}
+	if a.Label != "" {
+		if !v4 {
+			return apierror.Invalid("label", "Labels are IPv4 only")
+		}
+		if !strings.HasPrefix(a.Label, a.Link) || len(a.Label) >= syscall.IFNAMSIZ {
+			return apierror.Invalid("label", "Label must start with %s and be shorter than %d", a.Link, syscall.IFNAMSIZ)
+		}
+	}
+	if a.Broadcast != "" {
+		if broadcast := net.ParseIP(a.Broadcast); broadcast == nil || broadcast.To4() == nil || !v4 {
+			return apierror.Invalid("broadcast", "Invalid IPv4 broadcast %s", a.Broadcast)
+		}
+	}
+	if a.Peer != "" {
+		peer := net.ParseIP(a.Peer)
+		if peer == nil {
+			peer, _, _ = net.ParseCIDR(a.Peer)
+		}
+		if peer == nil || (peer.To4() != nil) != v4 {
+			return apierror.Invalid("peer", "Invalid peer %s", a.Peer)
+		}
+	}
+	for _, flag := range a.Flags {
+		if _, ok := flags[flag]; !ok {
+			return apierror.Invalid("flags", "Unknown flag %s", flag)
+		}
+	}
+	return nil
+}
+
+// Conflict returns the address of others clashing with a, if any: one
+// with the same IP, or an overlapping network on another link or with
+// another prefix. Point-to-point addresses only clash on their IP.
+func Conflict(a Address, others []Address) *Address {
+	ip, network, err := net.ParseCIDR(a.IP)
+	if err != nil {
+		return nil
+	}
+	for i, other := range others {
+		if other.ID == a.ID {
+			continue
+		}
+		otherIP, otherNetwork, err := net.ParseCIDR(other.IP)
+		if err != nil {
+			continue
+		}
+		if otherIP.Equal(ip) {
+			return &others[i]
+		}
+		if a.Peer != "" || other.Peer != "" {
+			continue
+		}
+		if !network.Contains(otherIP) && !otherNetwork.Contains(ip) {
+			continue
+		}
+		if other.Link != a.Link || otherNetwork.String() != network.String() {
+			return &others[i]
+		}
+	}
+	return nil
+}
+
+// conflict returns an error when a clashes with a stored address
+func (h *Handler) conflict(a addressStruct) error {
+	var others []addressStruct
+	err := h.DB.View(func(tx *bolt.Tx) error {
+		return all(tx.Bucket([]byte(addressBucket)), &others)
+	})
+	if err != nil {
+		return err
+	}
+	return conflict(a, others)
+}
+
+// conflict returns an error when a clashes with one of others
+func conflict(a addressStruct, others []addressStruct) error {
+	if other := Conflict(a, others); other != nil {
+		return apierror.ConflictWith("ip", other, "%s clashes with address %s, %s on %s", a.IP, other.ID, other.IP, other.Link)
+	}
+	return nil
+}
+
+func (h *Handler) get(id string) (address addressStruct, err error) {
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
 		tmp := tx.Bucket([]byte(addressBucket)).Get([]byte(id))
 		if tmp == nil {
-			err = fmt.Errorf("ItemNotFound: Could not find address for %s in db", id)
-			return
+			return apierror.NotFound("Could not find address for %s in db", id)
 		}
-		err = json.Unmarshal(tmp, &address)
-		return
+		return json.Unmarshal(tmp, &address)
 	})
+	return
+}
+
+// GetAddress returns the address with the specified ID
+func (h *Handler) GetAddress(w rest.ResponseWriter, req *rest.Request) {
+	id := req.PathParam("address")
+	address, err := h.get(id)
 	if err != nil {
-		log.Printf(err.Error())
-		code := http.StatusInternalServerError
-		if strings.Contains(err.Error(), "ItemNotFound") {
-			code = http.StatusNotFound
-		}
-		rest.Error(w, err.Error(), code)
+		apierror.Write(w, err)
+		return
+	}
+	addrs := []addressStruct{address}
+	if err := h.Backend.Status(addrs); err != nil {
+		apierror.Write(w, err)
 		return
 	}
 
-	log.Printf("GetAddress %s requested : %s", id, address)
-	w.WriteJson(address)
+	log.Printf("GetAddress %s requested : %v", id, addrs[0])
+	w.WriteJson(addrs[0])
+}
+
+// PostApply adds the address with the specified ID to its link again,
+// returning its status
+func (h *Handler) PostApply(w rest.ResponseWriter, req *rest.Request) {
+	address, err := h.get(req.PathParam("address"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	err = h.Backend.Add(address)
+	if err == syscall.EEXIST {
+		err = nil
+	}
+	addrs := []addressStruct{address}
+	if e := h.Backend.Status(addrs); e != nil {
+		apierror.Write(w, e)
+		return
+	}
+	if err != nil {
+		apierror.NotApplied(w, addrs[0], err)
+		return
+	}
+	w.WriteJson(addrs[0])
 }
 
 // PostAddress register a new address
-func PostAddress(w rest.ResponseWriter, req *rest.Request) {
+func (h *Handler) PostAddress(w rest.ResponseWriter, req *rest.Request) {
 	address := addressStruct{}
 	if err := req.DecodeJsonPayload(&address); err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, apierror.BadRequest(err))
 		return
 	}
-	if address.Link == "" {
-		err := errors.New("Link is empty")
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+	// computed, not stored
+	address.Status = ""
+	probe, _ := strconv.ParseBool(req.URL.Query().Get("probe"))
+	// the IP of a pool is allocated and checked along with the ID
+	pooled := address.Pool != ""
+	if !pooled {
+		if err := validate(address); err != nil {
+			apierror.Write(w, err)
+			return
+		}
+		if err := h.conflict(address); err != nil {
+			apierror.Write(w, err)
+			return
+		}
+		if probe {
+			if err := h.probe(address); err != nil {
+				apierror.Write(w, err)
+				return
+			}
+		}
+	}
+	var err error
+	if pooled && probe {
+		address, err = h.allocateProbed(address)
+	} else {
+		err = h.DB.Update(func(tx *bolt.Tx) error {
+			return h.create(tx, &address, nil, "")
+		})
+	}
+	if err != nil {
+		apierror.Write(w, err)
 		return
 	}
-	if address.IP == "" {
-		err := errors.New("IP is empty")
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+
+	address, err = h.add(address)
+	// an address already on the link is applied, but neither checked
+	// nor removed as this request did not add it
+	existing := err == syscall.EEXIST
+	if err != nil && !existing {
+		apierror.NotApplied(w, address, err)
 		return
 	}
-	if _, _, err := net.ParseCIDR(address.IP); err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+	if probe && !existing && address.Status == StatusApplied {
+		if err := h.dad(address); err != nil {
+			h.undo(address, nil)
+			apierror.Write(w, err)
+			return
+		}
+	}
+	apierror.Created(w, req.URL.Path+"/"+address.ID, address)
+}
+
+// create stores a new address, allocating the IP of one of a pool
+// but the ones of skip. Unless empty, the IP allocated must be probed,
+// errRaced being returned when another address took it meanwhile.
+func (h *Handler) create(tx *bolt.Tx, address *addressStruct, skip map[string]bool, probed string) (err error) {
+	b := tx.Bucket([]byte(addressBucket))
+	if address.Pool != "" {
+		var others []addressStruct
+		if err := all(b, &others); err != nil {
+			return err
+		}
+		if err := h.allocate(tx, address, others, skip); err != nil {
+			return err
+		}
+		if probed != "" && address.IP != probed {
+			return errRaced
+		}
+		if err := validate(*address); err != nil {
+			return err
+		}
+		if err := conflict(*address, others); err != nil {
+			return err
+		}
+	}
+	if address.ID == "" {
+		if address.ID, err = dbutil.NextID(b); err != nil {
+			return err
+		}
+	} else {
+		if _, err := strconv.ParseUint(address.ID, 10, 64); err == nil {
+			return apierror.Invalid("id", "ID is an integer")
+		}
+		if a := b.Get([]byte(address.ID)); a != nil {
+			return apierror.Conflict("id", "ID exists")
+		}
+	}
+	data, err := json.Marshal(address)
+	if err != nil {
 		return
 	}
-	err := db.Update(func(tx *bolt.Tx) (err error) {
+	return b.Put([]byte(address.ID), data)
+}
+
+// add applies the address and sets its status, one on a link not
+// present being pending until the link appears
+func (h *Handler) add(address addressStruct) (addressStruct, error) {
+	err := h.Backend.Add(address)
+	if linkwatch.IsAbsent(err) {
+		log.Printf("Address %s pending until %s appears", address.IP, address.Link)
+		address.Status = StatusLinkAbsent
+		return address, nil
+	}
+	if err == nil || err == syscall.EEXIST {
+		address.Status = StatusApplied
+	}
+	return address, err
+}
+
+type hostStruct = types.Neighbor
+
+// Host is another host of the network found using an address
+type Host = hostStruct
+
+// probe returns an error when another host answers the ARP probes
+// for an IPv4 address, links not present being left unprobed
+func (h *Handler) probe(a addressStruct) error {
+	hardwareAddr, err := h.Backend.Probe(a)
+	if linkwatch.IsAbsent(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if hardwareAddr != "" {
+		ip, _, _ := net.ParseCIDR(a.IP)
+		return apierror.ConflictWith("ip", hostStruct{IP: ip.String(), Link: a.Link, HardwareAddr: hardwareAddr}, "%s is used by %s on %s", ip, hardwareAddr, a.Link)
+	}
+	return nil
+}
+
+// dad returns an error when the duplicate address detection of an
+// IPv6 address just added fails
+func (h *Handler) dad(a addressStruct) error {
+	for _, flag := range a.Flags {
+		if flag == "nodad" {
+			return nil
+		}
+	}
+	err := h.Backend.WaitDAD(a)
+	if err == ErrDADFailed {
+		return apierror.Conflict("ip", "%s: %s", a.IP, err)
+	}
+	if err != nil {
+		log.Print(err)
+	}
+	return nil
+}
+
+// undo removes an address just added, putting back the old one
+// it replaced if any
+func (h *Handler) undo(address addressStruct, old *addressStruct) {
+	if err := h.Backend.Delete(address); err != nil {
+		log.Print(err)
+	}
+	err := h.DB.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(addressBucket))
-		if address.ID == "" {
-			int, err := b.NextSequence()
-			if err != nil {
-				return err
-			}
-			address.ID = strconv.FormatUint(int, 10)
-		} else {
-			if _, err := strconv.ParseUint(address.ID, 10, 64); err == nil {
-				return errors.New("ID is an integer")
-			}
-			if a := b.Get([]byte(address.ID)); a != nil {
-				return errors.New("ID exists")
-			}
+		if old == nil {
+			return b.Delete([]byte(address.ID))
 		}
-		data, err := json.Marshal(address)
+		data, err := json.Marshal(old)
 		if err != nil {
-			return
+			return err
 		}
-		err = b.Put([]byte(address.ID), []byte(data))
-		return
+		return b.Put([]byte(old.ID), data)
 	})
-
 	if err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		log.Print(err)
 	}
-
-	if err := setIP(address); err != nil {
-		w.Header().Set("X-ERROR", err.Error())
+	if old != nil {
+		if _, err := h.add(*old); err != nil && err != syscall.EEXIST {
+			log.Print(err)
+		}
 	}
-	w.WriteJson(address)
 }
 
-// PutAddress modify the existing address with the specified ID
-func PutAddress(w rest.ResponseWriter, req *rest.Request) {
+// PutAddress modify the address with the specified ID,
+// creating it if needed
+func (h *Handler) PutAddress(w rest.ResponseWriter, req *rest.Request) {
 	address := addressStruct{}
 	if err := req.DecodeJsonPayload(&address); err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, apierror.BadRequest(err))
 		return
 	}
+	// computed, not stored
+	address.Status = ""
 	address.ID = req.PathParam("address")
-
-	// Removing the old interface address using netlink
-	oldAddress := addressStruct{}
-	err := db.View(func(tx *bolt.Tx) (err error) {
-		tmp := tx.Bucket([]byte(addressBucket)).Get([]byte(address.ID))
-		if tmp != nil {
-			err = json.Unmarshal(tmp, &oldAddress)
-			if oldAddress != address {
-				_ = deleteIP(oldAddress)
-			}
-			if err != nil {
-				log.Printf(err.Error())
-			}
+	// only checked, the IP and link of the pool, the IP being
+	// allocated by POST
+	if address.Pool != "" {
+		if address.IP == "" {
+			apierror.Write(w, apierror.Invalid("ip", "PUT requires an IP, use POST to allocate"))
+			return
+		}
+		err := h.DB.View(func(tx *bolt.Tx) error {
+			return h.allocate(tx, &address, nil, nil)
+		})
+		if err != nil {
+			apierror.Write(w, err)
+			return
 		}
+	}
+	if err := validate(address); err != nil {
+		apierror.Write(w, err)
 		return
-	})
+	}
 
-	if err != nil {
-		log.Printf(err.Error())
+	// Removing the old interface address using netlink
+	oldAddress, err := h.get(address.ID)
+	created := apierror.IsNotFound(err)
+	if err != nil && !created {
+		apierror.Write(w, err)
+		return
+	}
+	if err := h.conflict(address); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	// the address kept needs no probe
+	probe, _ := strconv.ParseBool(req.URL.Query().Get("probe"))
+	probe = probe && (created || oldAddress.IP != address.IP || oldAddress.Link != address.Link)
+	if probe {
+		if err := h.probe(address); err != nil {
+			apierror.Write(w, err)
+			return
+		}
+	}
+	if !created && !reflect.DeepEqual(oldAddress, address) {
+		if err := h.Backend.Delete(oldAddress); err != nil {
+			log.Print(err)
+		}
 	}
 
-	err = db.Update(func(tx *bolt.Tx) (err error) {
+	err = h.DB.Update(func(tx *bolt.Tx) (err error) {
 		b := tx.Bucket([]byte(addressBucket))
 		data, err := json.Marshal(address)
 		if err != nil {
@@ -183,153 +485,112 @@ func PutAddress(w rest.ResponseWriter, req *rest.Request) {
 		err = b.Put([]byte(address.ID), []byte(data))
 		return
 	})
-
 	if err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, err)
 		return
 	}
 
-	if err = setIP(address); err != nil {
-		w.Header().Set("X-ERROR", err.Error())
+	same := reflect.DeepEqual(oldAddress, address)
+	if address, err = h.add(address); err != nil && !(err == syscall.EEXIST && same) {
+		apierror.NotApplied(w, address, err)
+		return
+	}
+	if probe && address.Status == StatusApplied {
+		if err := h.dad(address); err != nil {
+			if created {
+				h.undo(address, nil)
+			} else {
+				h.undo(address, &oldAddress)
+			}
+			apierror.Write(w, err)
+			return
+		}
+	}
+	if created {
+		apierror.Created(w, req.URL.Path, address)
+		return
 	}
 	w.WriteJson(address)
 }
 
 // DeleteAddress deletes the address with the specified ID
-func DeleteAddress(w rest.ResponseWriter, req *rest.Request) {
+func (h *Handler) DeleteAddress(w rest.ResponseWriter, req *rest.Request) {
 	id := req.PathParam("address")
 
-	address := addressStruct{}
-	err := db.View(func(tx *bolt.Tx) (err error) {
-		tmp := tx.Bucket([]byte(addressBucket)).Get([]byte(id))
-		err = json.Unmarshal(tmp, &address)
-		return
-	})
+	address, err := h.get(id)
 	if err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, err)
 		return
 	}
 
-	if err = deleteIP(address); err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+	// an address already gone from the link is only forgotten
+	if err = h.Backend.Delete(address); err != nil && err != syscall.EADDRNOTAVAIL && !linkwatch.IsAbsent(err) {
+		apierror.Write(w, err)
 		return
 	}
 
-	err = db.Update(func(tx *bolt.Tx) (err error) {
+	err = h.DB.Update(func(tx *bolt.Tx) (err error) {
 		err = tx.Bucket([]byte(addressBucket)).Delete([]byte(id))
 		return
 	})
 	if err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-}
-
-func setIP(a addressStruct) error {
-	log.Printf("Set IP:%s, to:%s", a.IP, a.Link)
-	lk, _ := netlink.LinkByName(a.Link)
-	addr, _ := netlink.ParseAddr(a.IP)
-	if err := netlink.AddrAdd(lk, addr); err != nil {
-		return err
-	}
-	return nil
-	// log.Printf("Adding route for this address")
-	// dst := net.ParseIP(a.IP)
-	// _ = netlink.RouteAdd("", dst, "", a.Link)
-	// return
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func deleteIP(a addressStruct) error {
-	log.Printf("Deleting IP: %s, to:%s", a.IP, a.Link)
-	link, _ := netlink.LinkByName(a.Link)
-	addr, _ := netlink.ParseAddr(a.IP)
-	if err := netlink.AddrDel(link, addr); err != nil {
-		return err
-	}
-	return nil
-}
-
-// CommandSetIP is a command-line tool to set an IP
-func CommandSetIP(id string, link string, ip string) {
-	if _, _, err := net.ParseCIDR(ip); err != nil {
-		log.Printf(err.Error())
-		return
-	}
-
-	if err := db.Update(func(tx *bolt.Tx) (err error) {
-		_, err = tx.CreateBucketIfNotExists([]byte(addressBucket))
-		return
-	}); err != nil {
-		log.Printf(err.Error())
-		return
-	}
-
-	address := addressStruct{ID: id, Link: link, IP: ip}
-
-	oldAddress := addressStruct{}
-	if err := db.View(func(tx *bolt.Tx) (err error) {
-		tmp := tx.Bucket([]byte(addressBucket)).Get([]byte(address.ID))
-		if tmp != nil {
-			err = json.Unmarshal(tmp, &oldAddress)
-			if oldAddress != address {
-				err = deleteIP(oldAddress)
-			}
+// Restore applies to the system the change of the address bucket
+// from one content to another, the database already holding the latter
+func (h *Handler) Restore(from, to map[string][]byte) (err error) {
+	for k, v := range from {
+		if w, ok := to[k]; ok && string(v) == string(w) {
+			continue
 		}
-		return
-	}); err != nil {
-		log.Printf(err.Error())
-		return
-	}
-
-	if err := db.Update(func(tx *bolt.Tx) (err error) {
-		b := tx.Bucket([]byte(addressBucket))
-		data, err := json.Marshal(address)
-		if err != nil {
-			return
+		address := addressStruct{}
+		if e := json.Unmarshal(v, &address); e != nil {
+			err = e
+		} else if e := h.Backend.Delete(address); e != nil && e != syscall.EADDRNOTAVAIL && !linkwatch.IsAbsent(e) {
+			err = e
 		}
-		err = b.Put([]byte(address.ID), []byte(data))
-		return
-	}); err != nil {
-		log.Printf(err.Error())
-		return
-	}
-
-	if err := dhcp.SetDhcp(false, link); err != nil {
-		log.Printf(err.Error())
-		return
 	}
-	if err := setIP(address); err != nil {
-		log.Printf(err.Error())
-		return
+	for k, w := range to {
+		if v, ok := from[k]; ok && string(v) == string(w) {
+			continue
+		}
+		address := addressStruct{}
+		if e := json.Unmarshal(w, &address); e != nil {
+			err = e
+		} else if _, e := h.add(address); e != nil && e != syscall.EEXIST {
+			err = e
+		}
 	}
+	return
 }
 
 // DBinit initializes the addresses database at startup
-func DBinit(d *bolt.DB) (err error) {
-	db = d
-	err = db.Update(func(tx *bolt.Tx) (err error) {
-		_, err = tx.CreateBucketIfNotExists([]byte(addressBucket))
+func (h *Handler) DBinit() (err error) {
+	err = h.DB.Update(func(tx *bolt.Tx) (err error) {
+		if _, err = tx.CreateBucketIfNotExists([]byte(addressBucket)); err != nil {
+			return
+		}
+		_, err = tx.CreateBucketIfNotExists([]byte(poolBucket))
 		return
 	})
 	if err != nil {
 		return err
 	}
 
-	err = db.View(func(tx *bolt.Tx) (err error) {
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
 		b := tx.Bucket([]byte(addressBucket))
 
 		log.Printf("Reinstall previous address from DB")
-		address := addressStruct{}
 		b.ForEach(func(k, v []byte) (err error) {
+			address := addressStruct{}
 			if err := json.Unmarshal(v, &address); err != nil {
-				log.Printf(err.Error())
-			} else if err := setIP(address); err != nil {
-				log.Printf(err.Error())
+				log.Print(err)
+			} else if _, err := h.add(address); err != nil {
+				log.Print(err)
 			}
 			return
 		})
@@ -337,3 +598,40 @@ func DBinit(d *bolt.DB) (err error) {
 	})
 	return
 }
+
+// byLink returns the addresses stored for a link
+func (h *Handler) byLink(name string) (addrs []addressStruct) {
+	h.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(addressBucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			address := addressStruct{}
+			if err := json.Unmarshal(v, &address); err == nil && address.Link == name {
+				addrs = append(addrs, address)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// LinkAdded applies the addresses pending on the link
+func (h *Handler) LinkAdded(name string) {
+	for _, address := range h.byLink(name) {
+		if err := h.Backend.Add(address); err != nil && err != syscall.EEXIST {
+			log.WithError(err).Errorf("Can't apply address %s to %s", address.IP, name)
+			continue
+		}
+		log.Printf("Applied pending address %s to %s", address.IP, name)
+	}
+}
+
+// LinkRemoved only logs, the kernel dropping the addresses of the link,
+// which are applied again when it comes back
+func (h *Handler) LinkRemoved(name string) {
+	if addrs := h.byLink(name); len(addrs) > 0 {
+		log.Printf("Addresses of %s pending until it comes back: %d", name, len(addrs))
+	}
+}
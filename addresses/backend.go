@@ -0,0 +1,207 @@
+package addresses
+
+import (
+	"net"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/guilhem/tentacool/linkwatch"
+)
+
+// Backend applies addresses to the system
+type Backend interface {
+	Add(a addressStruct) error
+	Delete(a addressStruct) error
+	// Status sets the Status of the addresses from the system
+	Status(addrs []addressStruct) error
+	// Probe returns the hardware address of another host using the
+	// IPv4 address on its link, if any
+	Probe(a addressStruct) (string, error)
+	// WaitDAD waits for the duplicate address detection of the IPv6
+	// address added, returning ErrDADFailed when it fails
+	WaitDAD(a addressStruct) error
+}
+
+const (
+	// ifaFlags is the u32 IFA_FLAGS attribute, for flags over 8 bits
+	ifaFlags = 0x8
+	// ifaFNoPrefixRoute is IFA_F_NOPREFIXROUTE, missing from syscall
+	ifaFNoPrefixRoute = 0x200
+	// forever is the infinite lifetime of the kernel
+	forever = 0xffffffff
+)
+
+// flags are the address flags set by name
+var flags = map[string]int{
+	"nodad":         syscall.IFA_F_NODAD,
+	"noprefixroute": ifaFNoPrefixRoute,
+}
+
+// NetlinkBackend applies addresses to the kernel with netlink
+type NetlinkBackend struct{}
+
+// netlinkAddr returns the netlink address of a, with its label,
+// broadcast, peer and flags
+func netlinkAddr(a addressStruct) (*netlink.Addr, error) {
+	addr, err := netlink.ParseAddr(a.IP)
+	if err != nil {
+		return nil, err
+	}
+	addr.Label = a.Label
+	// 4 bytes, netlink.AddrAdd sending it as is
+	addr.Broadcast = net.ParseIP(a.Broadcast).To4()
+	if a.Peer != "" {
+		if ip := net.ParseIP(a.Peer); ip != nil {
+			addr.Peer = &net.IPNet{IP: ip, Mask: addr.Mask}
+		} else if _, addr.Peer, err = net.ParseCIDR(a.Peer); err != nil {
+			return nil, err
+		}
+	}
+	for _, flag := range a.Flags {
+		addr.Flags |= flags[flag]
+	}
+	return addr, nil
+}
+
+// Add adds the address to its link
+func (NetlinkBackend) Add(a addressStruct) error {
+	log.Printf("Set IP:%s, to:%s", a.IP, a.Link)
+	link, err := linkwatch.ByName(a.Link)
+	if err != nil {
+		return err
+	}
+	addr, err := netlinkAddr(a)
+	if err != nil {
+		return err
+	}
+	if a.ValidLft == 0 && a.PreferredLft == 0 {
+		return netlink.AddrAdd(link, addr)
+	}
+	return addrAdd(link, addr, a.PreferredLft, a.ValidLft)
+}
+
+// addrAdd is netlink.AddrAdd setting the lifetimes of the address,
+// the vendored netlink not knowing IFA_CACHEINFO
+func addrAdd(link netlink.Link, addr *netlink.Addr, preferred, valid int) error {
+	req := nl.NewNetlinkRequest(syscall.RTM_NEWADDR, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL|syscall.NLM_F_ACK)
+	family := nl.GetIPFamily(addr.IP)
+	msg := nl.NewIfAddrmsg(family)
+	msg.Index = uint32(link.Attrs().Index)
+	msg.Scope = uint8(addr.Scope)
+	prefixlen, _ := addr.Mask.Size()
+	msg.Prefixlen = uint8(prefixlen)
+	if addr.Flags <= 0xff {
+		msg.Flags = uint8(addr.Flags)
+	}
+	req.AddData(msg)
+
+	local := addr.IP.To16()
+	if family == netlink.FAMILY_V4 {
+		local = addr.IP.To4()
+	}
+	req.AddData(nl.NewRtAttr(syscall.IFA_LOCAL, local))
+	peer := local
+	if addr.Peer != nil {
+		peer = addr.Peer.IP.To16()
+		if family == netlink.FAMILY_V4 {
+			peer = addr.Peer.IP.To4()
+		}
+	}
+	req.AddData(nl.NewRtAttr(syscall.IFA_ADDRESS, peer))
+	if addr.Flags > 0xff {
+		req.AddData(nl.NewRtAttr(ifaFlags, nl.Uint32Attr(uint32(addr.Flags))))
+	}
+	if addr.Broadcast != nil {
+		req.AddData(nl.NewRtAttr(syscall.IFA_BROADCAST, addr.Broadcast.To4()))
+	}
+	if addr.Label != "" {
+		req.AddData(nl.NewRtAttr(syscall.IFA_LABEL, nl.ZeroTerminated(addr.Label)))
+	}
+
+	// struct ifa_cacheinfo: preferred and valid lifetimes, then the
+	// creation and update timestamps set by the kernel
+	lifetimes := [2]uint32{forever, forever}
+	if valid > 0 {
+		lifetimes[1] = uint32(valid)
+	}
+	// the kernel refuses a preferred lifetime over the valid one
+	lifetimes[0] = lifetimes[1]
+	if preferred > 0 {
+		lifetimes[0] = uint32(preferred)
+	}
+	cacheinfo := make([]byte, 16)
+	nl.NativeEndian().PutUint32(cacheinfo[0:], lifetimes[0])
+	nl.NativeEndian().PutUint32(cacheinfo[4:], lifetimes[1])
+	req.AddData(nl.NewRtAttr(syscall.IFA_CACHEINFO, cacheinfo))
+
+	_, err := req.Execute(syscall.NETLINK_ROUTE, 0)
+	return err
+}
+
+// Delete removes the address from its link
+func (NetlinkBackend) Delete(a addressStruct) error {
+	log.Printf("Deleting IP: %s, to:%s", a.IP, a.Link)
+	link, err := linkwatch.ByName(a.Link)
+	if err != nil {
+		return err
+	}
+	addr, err := netlinkAddr(a)
+	if err != nil {
+		return err
+	}
+	return netlink.AddrDel(link, addr)
+}
+
+// status returns the status of a among the live addresses, by link
+func status(a addressStruct, live map[string][]netlink.Addr) string {
+	ip, network, err := net.ParseCIDR(a.IP)
+	if err != nil {
+		return StatusMissing
+	}
+	addrs, ok := live[a.Link]
+	if !ok {
+		return StatusLinkAbsent
+	}
+	for _, l := range addrs {
+		if !l.IP.Equal(ip) {
+			continue
+		}
+		if l.Mask.String() != network.Mask.String() {
+			return StatusConflicting
+		}
+		if l.Flags&syscall.IFA_F_DADFAILED != 0 {
+			return StatusDADFailed
+		}
+		return StatusApplied
+	}
+	for link, addrs := range live {
+		for _, l := range addrs {
+			if link != a.Link && l.IP.Equal(ip) {
+				return StatusConflicting
+			}
+		}
+	}
+	return StatusMissing
+}
+
+// Status compares the addresses to the ones of every link
+func (NetlinkBackend) Status(addrs []addressStruct) error {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return err
+	}
+	live := map[string][]netlink.Addr{}
+	for _, link := range links {
+		if live[link.Attrs().Name], err = netlink.AddrList(link, netlink.FAMILY_ALL); err != nil {
+			return err
+		}
+	}
+	for i := range addrs {
+		addrs[i].Status = status(addrs[i], live)
+	}
+	return nil
+}
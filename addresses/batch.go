@@ -0,0 +1,234 @@
+package addresses
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/boltdb/bolt"
+
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/dbutil"
+	"github.com/guilhem/tentacool/linkwatch"
+	"github.com/guilhem/tentacool/types"
+)
+
+// Operations of a batch
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+type batchOperationStruct = types.BatchOperation
+
+// BatchOperation is an operation of a batch
+type BatchOperation = batchOperationStruct
+
+type batchStruct = types.Batch
+
+// Batch is a list of operations done all together or not at all
+type Batch = batchStruct
+
+// sortedIDs returns the IDs of addrs in order
+func sortedIDs(addrs map[string]addressStruct) []string {
+	ids := make([]string, 0, len(addrs))
+	for id := range addrs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// PostBatch creates, updates and deletes addresses in one transaction,
+// returning the address of each operation. Clashes are checked once
+// every operation is done, for addresses to be renumbered. On any
+// failure the addresses already changed in the kernel are put back
+// and nothing is stored.
+func (h *Handler) PostBatch(w rest.ResponseWriter, req *rest.Request) {
+	batch := batchStruct{}
+	if err := req.DecodeJsonPayload(&batch); err != nil {
+		apierror.Write(w, apierror.BadRequest(err))
+		return
+	}
+	var results []addressStruct
+	err := h.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(addressBucket))
+		current := map[string]addressStruct{}
+		err := b.ForEach(func(k, v []byte) error {
+			address := addressStruct{}
+			if err := json.Unmarshal(v, &address); err != nil {
+				return err
+			}
+			current[string(k)] = address
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		target := map[string]addressStruct{}
+		for id, address := range current {
+			target[id] = address
+		}
+		// the last operation on each ID, to blame for its clashes
+		ops := map[string]int{}
+		for i, op := range batch.Operations {
+			field := fmt.Sprintf("operations.%d.address", i)
+			address := op.Address
+			// computed, not stored
+			address.Status = ""
+			switch op.Op {
+			case OpCreate:
+				if address.ID == "" {
+					id, err := dbutil.NextID(b)
+					if err != nil {
+						return err
+					}
+					address.ID = id
+				} else if _, err := strconv.ParseUint(address.ID, 10, 64); err == nil {
+					return apierror.Invalid(field+".id", "ID is an integer")
+				} else if _, ok := target[address.ID]; ok {
+					return apierror.Conflict(field+".id", "ID exists")
+				}
+			case OpUpdate:
+				if _, ok := target[address.ID]; !ok {
+					return apierror.NotFound("Could not find address for %s in db", address.ID)
+				}
+			case OpDelete:
+				old, ok := target[address.ID]
+				if !ok {
+					return apierror.NotFound("Could not find address for %s in db", address.ID)
+				}
+				delete(target, address.ID)
+				results = append(results, old)
+				continue
+			default:
+				return apierror.Invalid(fmt.Sprintf("operations.%d.op", i), "Unknown operation %s", op.Op)
+			}
+			if address.Pool != "" {
+				var others []addressStruct
+				for _, id := range sortedIDs(target) {
+					others = append(others, target[id])
+				}
+				if err := h.allocate(tx, &address, others, nil); err != nil {
+					if e, ok := err.(*apierror.Error); ok {
+						e.Field = field + "." + e.Field
+					}
+					return err
+				}
+			}
+			if err := validate(address); err != nil {
+				if e, ok := err.(*apierror.Error); ok {
+					e.Field = field + "." + e.Field
+				}
+				return err
+			}
+			target[address.ID] = address
+			ops[address.ID] = i
+			results = append(results, address)
+		}
+
+		var others []addressStruct
+		for _, id := range sortedIDs(target) {
+			others = append(others, target[id])
+		}
+		for _, id := range sortedIDs(target) {
+			address := target[id]
+			if old, ok := current[id]; ok && reflect.DeepEqual(old, address) {
+				continue
+			}
+			if other := Conflict(address, others); other != nil {
+				return apierror.ConflictWith(fmt.Sprintf("operations.%d.address.ip", ops[id]), other, "%s clashes with address %s, %s on %s", address.IP, other.ID, other.IP, other.Link)
+			}
+		}
+
+		for id := range current {
+			if _, ok := target[id]; !ok {
+				if err := b.Delete([]byte(id)); err != nil {
+					return err
+				}
+			}
+		}
+		for id, address := range target {
+			if old, ok := current[id]; ok && reflect.DeepEqual(old, address) {
+				continue
+			}
+			data, err := json.Marshal(address)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(id), data); err != nil {
+				return err
+			}
+		}
+		// last, the transaction being rolled back when it fails
+		return h.replace(current, target)
+	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	if err := h.Backend.Status(results); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(results)
+}
+
+// replace applies the change of addresses from one set to another,
+// putting the addresses already changed back when it fails. Addresses
+// on links not present are pending as usual.
+func (h *Handler) replace(from, to map[string]addressStruct) error {
+	var removed, added []addressStruct
+	for _, id := range sortedIDs(from) {
+		if address, ok := to[id]; !ok || !reflect.DeepEqual(address, from[id]) {
+			removed = append(removed, from[id])
+		}
+	}
+	for _, id := range sortedIDs(to) {
+		if address, ok := from[id]; !ok || !reflect.DeepEqual(address, to[id]) {
+			added = append(added, to[id])
+		}
+	}
+
+	var undo []func() error
+	rollback := func(address addressStruct, err error) error {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i](); err != nil {
+				log.Print(err)
+			}
+		}
+		return fmt.Errorf("Address %s on %s: %s, batch rolled back", address.IP, address.Link, err)
+	}
+	for _, address := range removed {
+		err := h.Backend.Delete(address)
+		if err == syscall.EADDRNOTAVAIL || linkwatch.IsAbsent(err) {
+			continue
+		}
+		if err != nil {
+			return rollback(address, err)
+		}
+		address := address
+		undo = append(undo, func() error { return h.Backend.Add(address) })
+	}
+	for _, address := range added {
+		err := h.Backend.Add(address)
+		// an address already on the link is left there on rollback
+		if err == syscall.EEXIST || linkwatch.IsAbsent(err) {
+			continue
+		}
+		if err != nil {
+			return rollback(address, err)
+		}
+		address := address
+		undo = append(undo, func() error { return h.Backend.Delete(address) })
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package addresses
+
+import (
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+)
+
+// FakeBackend keeps addresses in memory instead of the kernel, for tests
+type FakeBackend struct {
+	sync.Mutex
+	// Links holds the addresses of each link, in CIDR format
+	Links map[string][]string
+	// Failing holds the errors of Add and Delete by IP, in CIDR format
+	Failing map[string]error
+	// Neighbors are the hardware addresses of the other hosts of the
+	// network by IP, answering probes and failing the DAD
+	Neighbors map[string]string
+	// Err is returned by every operation when set
+	Err error
+}
+
+// NewFakeBackend returns an empty FakeBackend
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{Links: map[string][]string{}}
+}
+
+// Add records the address like netlink would
+func (f *FakeBackend) Add(a addressStruct) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	if err := f.Failing[a.IP]; err != nil {
+		return err
+	}
+	for _, ip := range f.Links[a.Link] {
+		if ip == a.IP {
+			return syscall.EEXIST
+		}
+	}
+	f.Links[a.Link] = append(f.Links[a.Link], a.IP)
+	return nil
+}
+
+// Delete forgets the address like netlink would
+func (f *FakeBackend) Delete(a addressStruct) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	if err := f.Failing[a.IP]; err != nil {
+		return err
+	}
+	for i, ip := range f.Links[a.Link] {
+		if ip == a.IP {
+			f.Links[a.Link] = append(f.Links[a.Link][:i], f.Links[a.Link][i+1:]...)
+			return nil
+		}
+	}
+	return syscall.EADDRNOTAVAIL
+}
+
+// Status compares the addresses to the ones recorded, every link
+// existing
+func (f *FakeBackend) Status(addrs []addressStruct) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	live := map[string][]netlink.Addr{}
+	for link, ips := range f.Links {
+		for _, ip := range ips {
+			addr, err := netlink.ParseAddr(ip)
+			if err != nil {
+				return err
+			}
+			live[link] = append(live[link], *addr)
+		}
+	}
+	for i := range addrs {
+		if _, ok := live[addrs[i].Link]; !ok {
+			live[addrs[i].Link] = []netlink.Addr{}
+		}
+		addrs[i].Status = status(addrs[i], live)
+	}
+	return nil
+}
+
+// neighbor returns the hardware address of the other host using the IP
+func (f *FakeBackend) neighbor(a addressStruct) string {
+	ip, _, err := net.ParseCIDR(a.IP)
+	if err != nil {
+		return ""
+	}
+	return f.Neighbors[ip.String()]
+}
+
+// Probe returns the neighbor using an IPv4 address, IPv6 ones being
+// left to the DAD
+func (f *FakeBackend) Probe(a addressStruct) (string, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return "", f.Err
+	}
+	if ip, _, err := net.ParseCIDR(a.IP); err != nil || ip.To4() == nil {
+		return "", nil
+	}
+	return f.neighbor(a), nil
+}
+
+// WaitDAD fails when a neighbor uses the IP
+func (f *FakeBackend) WaitDAD(a addressStruct) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	if f.neighbor(a) != "" {
+		return ErrDADFailed
+	}
+	return nil
+}
@@ -0,0 +1,391 @@
+package addresses
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/boltdb/bolt"
+
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/dbutil"
+	"github.com/guilhem/tentacool/types"
+)
+
+const (
+	poolBucket = "pools"
+	// maxPoolBits bounds the size of pools, scanned to allocate
+	maxPoolBits = 16
+)
+
+type poolUsageStruct = types.PoolUsage
+
+// PoolUsage is the utilization of a pool
+type PoolUsage = poolUsageStruct
+
+type poolStruct = types.Pool
+
+// Pool is a range of IPs of a link, allocated to addresses
+type Pool = poolStruct
+
+func validatePool(p poolStruct) error {
+	if p.Link == "" {
+		return apierror.Invalid("link", "Link is empty")
+	}
+	_, network, err := net.ParseCIDR(p.CIDR)
+	if err != nil {
+		return apierror.Invalid("cidr", "%s", err)
+	}
+	ones, bits := network.Mask.Size()
+	if bits-ones > maxPoolBits {
+		return apierror.Invalid("cidr", "Pools hold at most %d IPs", 1<<maxPoolBits)
+	}
+	if p.Prefix < 0 || p.Prefix > bits {
+		return apierror.Invalid("prefix", "Invalid prefix length %d", p.Prefix)
+	}
+	for _, exclude := range p.Exclude {
+		if ip := net.ParseIP(exclude); ip == nil || (ip.To4() != nil) != (bits == 32) {
+			return apierror.Invalid("exclude", "Invalid IP %s", exclude)
+		}
+	}
+	return nil
+}
+
+// next returns the IP following ip
+func next(ip net.IP) net.IP {
+	n := append(net.IP{}, ip...)
+	for i := len(n) - 1; i >= 0; i-- {
+		n[i]++
+		if n[i] != 0 {
+			break
+		}
+	}
+	return n
+}
+
+// eachIP calls f with the IPs of the pool to allocate, in order, until
+// it returns false. The network address and the IPv4 broadcast one
+// are left out.
+func eachIP(p poolStruct, f func(ip net.IP) bool) {
+	_, network, err := net.ParseCIDR(p.CIDR)
+	if err != nil {
+		return
+	}
+	ones, bits := network.Mask.Size()
+	size := uint64(1) << uint(bits-ones)
+	excluded := map[string]bool{}
+	for _, exclude := range p.Exclude {
+		excluded[net.ParseIP(exclude).String()] = true
+	}
+	ip := network.IP
+	for n := uint64(0); n < size; n, ip = n+1, next(ip) {
+		if size > 2 && (n == 0 || (bits == 32 && n == size-1)) {
+			continue
+		}
+		if excluded[ip.String()] {
+			continue
+		}
+		if !f(ip) {
+			return
+		}
+	}
+}
+
+// inPool tells if the pool allocates ip
+func inPool(p poolStruct, ip net.IP) (found bool) {
+	eachIP(p, func(i net.IP) bool {
+		found = i.Equal(ip)
+		return !found
+	})
+	return
+}
+
+// poolPrefix returns the prefix length of the addresses allocated
+func poolPrefix(p poolStruct) int {
+	if p.Prefix != 0 {
+		return p.Prefix
+	}
+	_, network, _ := net.ParseCIDR(p.CIDR)
+	ones, _ := network.Mask.Size()
+	return ones
+}
+
+// setUsage sets the usage of the pool from the addresses
+func setUsage(p *poolStruct, addrs []addressStruct) {
+	holders := map[string]string{}
+	for _, a := range addrs {
+		if ip, _, err := net.ParseCIDR(a.IP); err == nil {
+			holders[ip.String()] = a.ID
+		}
+	}
+	usage := &poolUsageStruct{Addresses: []string{}}
+	eachIP(*p, func(ip net.IP) bool {
+		usage.Size++
+		if id, ok := holders[ip.String()]; ok {
+			usage.Used++
+			usage.Addresses = append(usage.Addresses, id)
+		}
+		return true
+	})
+	usage.Free = usage.Size - usage.Used
+	sort.Strings(usage.Addresses)
+	p.Usage = usage
+}
+
+// all returns the values of a bucket of addresses or pools, in the
+// order of their ID
+func all(b *bolt.Bucket, v interface{}) error {
+	raws := []json.RawMessage{}
+	err := b.ForEach(func(k, v []byte) error {
+		raws = append(raws, append(json.RawMessage{}, v...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(raws)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// errRaced is returned when the IP probed is allocated meanwhile
+var errRaced = errors.New("IP allocated meanwhile")
+
+// allocate sets the link of an address of a pool and, when missing,
+// its IP: the first one of the pool not held by the others nor in
+// skip. A given IP must be in the pool.
+func (h *Handler) allocate(tx *bolt.Tx, a *addressStruct, others []addressStruct, skip map[string]bool) error {
+	pool := poolStruct{}
+	data := tx.Bucket([]byte(poolBucket)).Get([]byte(a.Pool))
+	if data == nil {
+		return apierror.Invalid("pool", "Unknown pool %s", a.Pool)
+	}
+	if err := json.Unmarshal(data, &pool); err != nil {
+		return err
+	}
+	if a.Link != "" && a.Link != pool.Link {
+		return apierror.Invalid("link", "Pool %s is on link %s", pool.ID, pool.Link)
+	}
+	a.Link = pool.Link
+
+	if a.IP != "" {
+		ip, _, err := net.ParseCIDR(a.IP)
+		if err != nil {
+			return apierror.Invalid("ip", "%s", err)
+		}
+		if !inPool(pool, ip) {
+			return apierror.Invalid("ip", "%s is not in pool %s", ip, pool.ID)
+		}
+		return nil
+	}
+
+	held := map[string]bool{}
+	for ip := range skip {
+		held[ip] = true
+	}
+	for _, other := range others {
+		if ip, _, err := net.ParseCIDR(other.IP); err == nil && other.ID != a.ID {
+			held[ip.String()] = true
+		}
+	}
+	eachIP(pool, func(ip net.IP) bool {
+		if held[ip.String()] {
+			return true
+		}
+		a.IP = fmt.Sprintf("%s/%d", ip, poolPrefix(pool))
+		return false
+	})
+	if a.IP == "" {
+		return apierror.Conflict("pool", "Pool %s is exhausted", pool.ID)
+	}
+	return nil
+}
+
+// allocateProbed stores a new address of a pool, its IP being probed
+// out of the transaction not to hold the database for seconds. IPs
+// answering are skipped, and the allocation done again when another
+// address takes the one probed meanwhile.
+func (h *Handler) allocateProbed(address addressStruct) (addressStruct, error) {
+	skip := map[string]bool{}
+	for {
+		candidate := address
+		err := h.DB.View(func(tx *bolt.Tx) error {
+			var others []addressStruct
+			if err := all(tx.Bucket([]byte(addressBucket)), &others); err != nil {
+				return err
+			}
+			return h.allocate(tx, &candidate, others, skip)
+		})
+		if err != nil {
+			return address, err
+		}
+		if err := h.probe(candidate); err != nil {
+			e, ok := err.(*apierror.Error)
+			if !ok || e.Code != apierror.CodeConflict || address.IP != "" {
+				return address, err
+			}
+			log.Printf("Pool %s skips %s: %s", address.Pool, candidate.IP, err)
+			ip, _, _ := net.ParseCIDR(candidate.IP)
+			skip[ip.String()] = true
+			continue
+		}
+		created := address
+		err = h.DB.Update(func(tx *bolt.Tx) error {
+			return h.create(tx, &created, skip, candidate.IP)
+		})
+		if err == errRaced {
+			log.Printf("Pool %s allocated %s meanwhile, allocating again", address.Pool, candidate.IP)
+			continue
+		}
+		return created, err
+	}
+}
+
+// pools returns the pools with their usage, or only the one with
+// the given ID
+func (h *Handler) pools(id string) (pools []poolStruct, err error) {
+	err = h.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(poolBucket))
+		if id == "" {
+			if err := all(b, &pools); err != nil {
+				return err
+			}
+		} else {
+			data := b.Get([]byte(id))
+			if data == nil {
+				return apierror.NotFound("Could not find pool for %s in db", id)
+			}
+			pools = make([]poolStruct, 1)
+			if err := json.Unmarshal(data, &pools[0]); err != nil {
+				return err
+			}
+		}
+		var addrs []addressStruct
+		if err := all(tx.Bucket([]byte(addressBucket)), &addrs); err != nil {
+			return err
+		}
+		for i := range pools {
+			setUsage(&pools[i], addrs)
+		}
+		return nil
+	})
+	return
+}
+
+// GetPools returns all pools with their usage
+func (h *Handler) GetPools(w rest.ResponseWriter, req *rest.Request) {
+	pools, err := h.pools("")
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(pools)
+}
+
+// GetPool returns the pool with the specified ID and its usage
+func (h *Handler) GetPool(w rest.ResponseWriter, req *rest.Request) {
+	pools, err := h.pools(req.PathParam("pool"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(pools[0])
+}
+
+// PostPool registers a new pool, which can't overlap another one
+func (h *Handler) PostPool(w rest.ResponseWriter, req *rest.Request) {
+	pool := poolStruct{}
+	if err := req.DecodeJsonPayload(&pool); err != nil {
+		apierror.Write(w, apierror.BadRequest(err))
+		return
+	}
+	// computed, not stored
+	pool.Usage = nil
+	if err := validatePool(pool); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	err := h.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(poolBucket))
+		if pool.ID == "" {
+			id, err := dbutil.NextID(b)
+			if err != nil {
+				return err
+			}
+			pool.ID = id
+		} else {
+			if _, err := strconv.ParseUint(pool.ID, 10, 64); err == nil {
+				return apierror.Invalid("id", "ID is an integer")
+			}
+			if p := b.Get([]byte(pool.ID)); p != nil {
+				return apierror.Conflict("id", "ID exists")
+			}
+		}
+		var others []poolStruct
+		if err := all(b, &others); err != nil {
+			return err
+		}
+		_, network, _ := net.ParseCIDR(pool.CIDR)
+		for _, other := range others {
+			_, otherNetwork, err := net.ParseCIDR(other.CIDR)
+			if err == nil && (network.Contains(otherNetwork.IP) || otherNetwork.Contains(network.IP)) {
+				return apierror.ConflictWith("cidr", other, "%s overlaps pool %s, %s", pool.CIDR, other.ID, other.CIDR)
+			}
+		}
+		data, err := json.Marshal(pool)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(pool.ID), data)
+	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.Created(w, req.URL.Path+"/"+pool.ID, pool)
+}
+
+// PoolRestorer restores the pools bucket, pools being only held
+// by the database
+type PoolRestorer struct{}
+
+// Restore has nothing to apply to the system
+func (PoolRestorer) Restore(from, to map[string][]byte) error {
+	return nil
+}
+
+// DeletePool deletes the pool with the specified ID, once no address
+// is allocated from it
+func (h *Handler) DeletePool(w rest.ResponseWriter, req *rest.Request) {
+	id := req.PathParam("pool")
+	err := h.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(poolBucket))
+		if b.Get([]byte(id)) == nil {
+			return apierror.NotFound("Could not find pool for %s in db", id)
+		}
+		var addrs []addressStruct
+		if err := all(tx.Bucket([]byte(addressBucket)), &addrs); err != nil {
+			return err
+		}
+		for _, a := range addrs {
+			if a.Pool == id {
+				return apierror.ConflictWith("id", a, "Pool %s holds address %s", id, a.ID)
+			}
+		}
+		return b.Delete([]byte(id))
+	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
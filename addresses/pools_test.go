@@ -0,0 +1,76 @@
+package addresses
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// racingBackend stores another address with the IP probed first,
+// as a request would while the probe runs
+type racingBackend struct {
+	*FakeBackend
+	h      *Handler
+	probed []string
+}
+
+func (b *racingBackend) Probe(a addressStruct) (string, error) {
+	if len(b.probed) == 0 {
+		err := b.h.DB.Update(func(tx *bolt.Tx) error {
+			data, err := json.Marshal(addressStruct{ID: "other", Link: "eth0", IP: a.IP})
+			if err != nil {
+				return err
+			}
+			return tx.Bucket([]byte(addressBucket)).Put([]byte("other"), data)
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	b.probed = append(b.probed, a.IP)
+	return b.FakeBackend.Probe(a)
+}
+
+func TestAllocateProbedRaced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tentacool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	h := &Handler{DB: db}
+	backend := &racingBackend{FakeBackend: NewFakeBackend(), h: h}
+	h.Backend = backend
+	if err := h.DBinit(); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(poolStruct{ID: "svc", Link: "eth0", CIDR: "192.168.32.16/30"})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(poolBucket)).Put([]byte("svc"), data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := h.allocateProbed(addressStruct{Pool: "svc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the IP taken meanwhile is left to the other address, the next
+	// one being probed before being stored
+	if created.IP != "192.168.32.18/30" || len(backend.probed) != 2 || backend.probed[1] != created.IP {
+		t.Errorf("got %+v, probed %v", created, backend.probed)
+	}
+}
@@ -0,0 +1,149 @@
+package addresses
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/guilhem/tentacool/linkwatch"
+)
+
+// ErrDADFailed is returned when IPv6 duplicate address detection
+// finds the address on another host
+var ErrDADFailed = errors.New("Duplicate address detection failed")
+
+// ARP probing, shortened from the seconds of RFC 5227 to answer requests
+const (
+	probeNum      = 3
+	probeInterval = 200 * time.Millisecond
+	probeWait     = time.Second
+	// dadWait bounds the wait for IPv6 duplicate address detection
+	dadWait = 3 * time.Second
+)
+
+// htons returns v in network order, as socket calls expect
+func htons(v uint16) uint16 {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return nl.NativeEndian().Uint16(b)
+}
+
+// arp returns an Ethernet ARP packet
+func arp(op uint16, sha net.HardwareAddr, spa, tpa net.IP) []byte {
+	b := make([]byte, 28)
+	binary.BigEndian.PutUint16(b[0:], 1) // Ethernet
+	binary.BigEndian.PutUint16(b[2:], syscall.ETH_P_IP)
+	b[4], b[5] = 6, 4
+	binary.BigEndian.PutUint16(b[6:], op)
+	copy(b[8:], sha)
+	copy(b[14:], spa.To4())
+	copy(b[24:], tpa.To4())
+	return b
+}
+
+// Probe sends ARP probes for an IPv4 address on its link as RFC 5227
+// describes, returning the hardware address of a host answering or
+// probing for it too. Links down or without hardware address, and
+// IPv6 addresses, are not probed.
+func (NetlinkBackend) Probe(a addressStruct) (string, error) {
+	ip, _, err := net.ParseCIDR(a.IP)
+	if err != nil || ip.To4() == nil {
+		return "", err
+	}
+	link, err := linkwatch.ByName(a.Link)
+	if err != nil {
+		return "", err
+	}
+	attrs := link.Attrs()
+	if attrs.Flags&net.FlagUp == 0 || len(attrs.HardwareAddr) != 6 {
+		return "", nil
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM, int(htons(syscall.ETH_P_ARP)))
+	if err != nil {
+		return "", err
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: htons(syscall.ETH_P_ARP), Ifindex: attrs.Index}); err != nil {
+		return "", err
+	}
+	timeout := syscall.NsecToTimeval(int64(probeInterval))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		return "", err
+	}
+
+	broadcast := &syscall.SockaddrLinklayer{Protocol: htons(syscall.ETH_P_ARP), Ifindex: attrs.Index, Halen: 6}
+	copy(broadcast.Addr[:], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	probe := arp(1, attrs.HardwareAddr, net.IPv4zero, ip)
+
+	buf := make([]byte, 1500)
+	deadline := time.Now().Add(probeWait)
+	for sent := 0; time.Now().Before(deadline); {
+		if sent < probeNum {
+			if err := syscall.Sendto(fd, probe, 0, broadcast); err != nil {
+				return "", err
+			}
+			sent++
+		}
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if n < 28 {
+			continue
+		}
+		sha := net.HardwareAddr(buf[8:14])
+		spa, tpa := net.IP(buf[14:18]), net.IP(buf[24:28])
+		if bytes.Equal(sha, attrs.HardwareAddr) {
+			continue
+		}
+		// a host using the address, or probing for it at the same time
+		op := binary.BigEndian.Uint16(buf[6:])
+		if spa.Equal(ip) || (op == 1 && spa.Equal(net.IPv4zero) && tpa.Equal(ip)) {
+			return sha.String(), nil
+		}
+	}
+	return "", nil
+}
+
+// WaitDAD waits for the duplicate address detection of an IPv6 address
+// once added, returning ErrDADFailed when it fails
+func (NetlinkBackend) WaitDAD(a addressStruct) error {
+	ip, _, err := net.ParseCIDR(a.IP)
+	if err != nil || ip.To4() != nil {
+		return err
+	}
+	link, err := linkwatch.ByName(a.Link)
+	if err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(dadWait); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_V6)
+		if err != nil {
+			return err
+		}
+		tentative := false
+		for _, addr := range addrs {
+			if !addr.IP.Equal(ip) {
+				continue
+			}
+			if addr.Flags&syscall.IFA_F_DADFAILED != 0 {
+				return ErrDADFailed
+			}
+			tentative = addr.Flags&syscall.IFA_F_TENTATIVE != 0
+		}
+		if !tentative {
+			return nil
+		}
+	}
+	return nil
+}
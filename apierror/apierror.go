@@ -0,0 +1,205 @@
+package apierror
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"github.com/guilhem/tentacool/types"
+)
+
+// Code identifies the kind of error in responses
+type Code = types.Code
+
+// Codes returned by the API
+const (
+	CodeBadRequest   = types.CodeBadRequest
+	CodeUnauthorized = types.CodeUnauthorized
+	CodeForbidden    = types.CodeForbidden
+	CodeNotFound     = types.CodeNotFound
+	CodeNotAllowed   = types.CodeNotAllowed
+	CodeConflict     = types.CodeConflict
+	CodeInvalid      = types.CodeInvalid
+	CodeInternal     = types.CodeInternal
+	CodeNotApplied   = types.CodeNotApplied
+)
+
+var statuses = map[Code]int{
+	CodeBadRequest:   http.StatusBadRequest,
+	CodeUnauthorized: http.StatusUnauthorized,
+	CodeForbidden:    http.StatusForbidden,
+	CodeNotFound:     http.StatusNotFound,
+	CodeNotAllowed:   http.StatusMethodNotAllowed,
+	CodeConflict:     http.StatusConflict,
+	CodeInvalid:      http.StatusUnprocessableEntity,
+	CodeInternal:     http.StatusInternalServerError,
+	CodeNotApplied:   StatusNotApplied,
+}
+
+// StatusNotApplied is the status of a change stored but not applied,
+// the resource being returned along with the error
+const StatusNotApplied = types.StatusNotApplied
+
+// Error is the body of every error response
+type Error = types.Error
+
+// status returns the HTTP status of the error
+func status(e *Error) int {
+	if status, ok := statuses[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+func newError(code Code, field, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Field: field, Message: fmt.Sprintf(format, a...)}
+}
+
+// BadRequest is a request which can't be read, like malformed JSON
+func BadRequest(err error) *Error {
+	return newError(CodeBadRequest, "", "%s", err)
+}
+
+// Unauthorized is a request without valid credentials
+func Unauthorized(format string, a ...interface{}) *Error {
+	return newError(CodeUnauthorized, "", format, a...)
+}
+
+// Forbidden is a request not allowed to the client
+func Forbidden(format string, a ...interface{}) *Error {
+	return newError(CodeForbidden, "", format, a...)
+}
+
+// NotFound is a missing resource
+func NotFound(format string, a ...interface{}) *Error {
+	return newError(CodeNotFound, "", format, a...)
+}
+
+// Conflict is a request clashing with an existing resource
+func Conflict(field, format string, a ...interface{}) *Error {
+	return newError(CodeConflict, field, format, a...)
+}
+
+// ConflictWith is a Conflict returning the resource clashing with the request
+func ConflictWith(field string, owner interface{}, format string, a ...interface{}) *Error {
+	e := newError(CodeConflict, field, format, a...)
+	e.Resource = owner
+	return e
+}
+
+// Invalid is a well-formed request with an invalid field
+func Invalid(field, format string, a ...interface{}) *Error {
+	return newError(CodeInvalid, field, format, a...)
+}
+
+// IsNotFound tells if err is a NotFound error
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == CodeNotFound
+}
+
+// Write sends err as the response, errors not typed being internal ones
+func Write(w rest.ResponseWriter, err error) {
+	log.Print(err)
+	e, ok := err.(*Error)
+	if !ok {
+		e = newError(CodeInternal, "", "%s", err)
+	}
+	w.WriteHeader(status(e))
+	w.WriteJson(e)
+}
+
+// NotApplied sends the stored resource along with the error
+// failing to apply it
+func NotApplied(w rest.ResponseWriter, resource interface{}, err error) {
+	log.Print(err)
+	w.WriteHeader(StatusNotApplied)
+	w.WriteJson(&Error{Code: CodeNotApplied, Message: err.Error(), Resource: resource})
+}
+
+// BodyWriter keeps a copy of the body of the response
+type BodyWriter struct {
+	rest.ResponseWriter
+	Body bytes.Buffer
+}
+
+// WriteJson encodes v through Write
+func (w *BodyWriter) WriteJson(v interface{}) error {
+	b, err := w.EncodeJson(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (w *BodyWriter) Write(b []byte) (int, error) {
+	w.Body.Write(b)
+	return w.ResponseWriter.(http.ResponseWriter).Write(b)
+}
+
+// Sent returns the error sent in the body, if any
+func (w *BodyWriter) Sent() (*Error, bool) {
+	e := &Error{}
+	if err := json.Unmarshal(w.Body.Bytes(), e); err != nil || e.Code == "" {
+		return nil, false
+	}
+	return e, true
+}
+
+// Created sends a resource just created at location
+func Created(w rest.ResponseWriter, location string, resource interface{}) {
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusCreated)
+	w.WriteJson(resource)
+}
+
+// routerWriter turns the errors of the router into Error
+type routerWriter struct {
+	rest.ResponseWriter
+	status int
+}
+
+func (w *routerWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *routerWriter) WriteJson(v interface{}) error {
+	if m, ok := v.(map[string]string); ok && len(m) == 1 && m[rest.ErrorFieldName] != "" {
+		code := CodeInternal
+		for c, status := range statuses {
+			if status == w.status && c != CodeNotApplied {
+				code = c
+			}
+		}
+		v = &Error{Code: code, Message: m[rest.ErrorFieldName]}
+	}
+	return w.ResponseWriter.WriteJson(v)
+}
+
+// Write lets handlers stream their response
+func (w *routerWriter) Write(b []byte) (int, error) {
+	return w.ResponseWriter.(http.ResponseWriter).Write(b)
+}
+
+// Flush lets handlers stream their response
+func (w *routerWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// App wraps app so that errors it sends with rest.Error, like unknown
+// routes, use the Error body too
+func App(app rest.App) rest.App {
+	handler := app.AppFunc()
+	return rest.AppSimple(func(w rest.ResponseWriter, req *rest.Request) {
+		handler(&routerWriter{ResponseWriter: w}, req)
+	})
+}
@@ -0,0 +1,253 @@
+// Package apply reads a declarative configuration file
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+
+	"github.com/guilhem/dnsconfig"
+	"github.com/vishvananda/netlink"
+	"gopkg.in/yaml.v2"
+
+	"github.com/guilhem/tentacool/addresses"
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/dhcp"
+	"github.com/guilhem/tentacool/gateway"
+	"github.com/guilhem/tentacool/revisions"
+)
+
+// Link is the state of a network interface, unset fields being left as is
+type Link struct {
+	Name string `yaml:"name"`
+	Up   *bool  `yaml:"up,omitempty"`
+	MTU  int    `yaml:"mtu,omitempty"`
+}
+
+// Address is an address managed on a link
+type Address struct {
+	ID           string   `yaml:"id"`
+	Link         string   `yaml:"link"`
+	IP           string   `yaml:"ip"`
+	ValidLft     int      `yaml:"valid_lft,omitempty"`
+	PreferredLft int      `yaml:"preferred_lft,omitempty"`
+	Label        string   `yaml:"label,omitempty"`
+	Broadcast    string   `yaml:"broadcast,omitempty"`
+	Peer         string   `yaml:"peer,omitempty"`
+	Flags        []string `yaml:"flags,omitempty"`
+}
+
+func (a Address) address() addresses.Address {
+	return addresses.Address{
+		ID:           a.ID,
+		Link:         a.Link,
+		IP:           a.IP,
+		ValidLft:     a.ValidLft,
+		PreferredLft: a.PreferredLft,
+		Label:        a.Label,
+		Broadcast:    a.Broadcast,
+		Peer:         a.Peer,
+		Flags:        a.Flags,
+	}
+}
+
+// Gateway is the default route
+type Gateway struct {
+	IP   string `yaml:"ip"`
+	Link string `yaml:"link,omitempty"`
+}
+
+// Routes are the routes managed, only the default gateway for now
+type Routes struct {
+	Gateway *Gateway `yaml:"gateway"`
+}
+
+// DNS is the resolver configuration
+type DNS struct {
+	Servers  []string `yaml:"servers"`
+	Search   []string `yaml:"search,omitempty"`
+	Ndots    int      `yaml:"ndots,omitempty"`
+	Timeout  int      `yaml:"timeout,omitempty"`
+	Attempts int      `yaml:"attempts,omitempty"`
+	Rotate   bool     `yaml:"rotate,omitempty"`
+}
+
+// DHCP is the state of the DHCP client
+type DHCP struct {
+	Active    bool   `yaml:"active"`
+	Interface string `yaml:"interface,omitempty"`
+}
+
+// File is a declarative configuration. Each section replaces what is
+// managed by tentacool, sections left out being kept as they are.
+type File struct {
+	Links     []Link     `yaml:"links,omitempty"`
+	Addresses *[]Address `yaml:"addresses,omitempty"`
+	Routes    *Routes    `yaml:"routes,omitempty"`
+	DNS       *DNS       `yaml:"dns,omitempty"`
+	DHCP      *DHCP      `yaml:"dhcp,omitempty"`
+}
+
+var sections = map[string]bool{"links": true, "addresses": true, "routes": true, "dns": true, "dhcp": true}
+
+// Load reads a file, refusing unknown sections
+func Load(r io.Reader) (f File, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	keys := map[string]interface{}{}
+	if err = yaml.Unmarshal(data, &keys); err != nil {
+		return
+	}
+	for key := range keys {
+		if !sections[key] {
+			return f, apierror.Invalid(key, "Unknown section")
+		}
+	}
+	err = yaml.Unmarshal(data, &f)
+	return
+}
+
+// Validate checks the file like the API checks requests
+func (f File) Validate() error {
+	for i, link := range f.Links {
+		field := fmt.Sprintf("links.%d", i)
+		if link.Name == "" {
+			return apierror.Invalid(field+".name", "Name is empty")
+		}
+		if link.MTU < 0 {
+			return apierror.Invalid(field+".mtu", "Invalid MTU %d", link.MTU)
+		}
+	}
+	if f.Addresses != nil {
+		ids := map[string]bool{}
+		var checked []addresses.Address
+		for i, a := range *f.Addresses {
+			field := fmt.Sprintf("addresses.%d", i)
+			if a.ID == "" {
+				return apierror.Invalid(field+".id", "ID is empty")
+			}
+			if _, err := strconv.ParseUint(a.ID, 10, 64); err == nil {
+				return apierror.Invalid(field+".id", "ID is an integer")
+			}
+			if ids[a.ID] {
+				return apierror.Conflict(field+".id", "Duplicate ID %s", a.ID)
+			}
+			ids[a.ID] = true
+			if err := addresses.Validate(a.address()); err != nil {
+				if e, ok := err.(*apierror.Error); ok {
+					e.Field = field + "." + e.Field
+				}
+				return err
+			}
+			if other := addresses.Conflict(a.address(), checked); other != nil {
+				return apierror.ConflictWith(field+".ip", other, "%s clashes with address %s, %s on %s", a.IP, other.ID, other.IP, other.Link)
+			}
+			checked = append(checked, a.address())
+		}
+	}
+	if f.Routes != nil && f.Routes.Gateway != nil && net.ParseIP(f.Routes.Gateway.IP) == nil {
+		return apierror.Invalid("routes.gateway.ip", "Invalid IP %s", f.Routes.Gateway.IP)
+	}
+	if f.DNS != nil {
+		for _, server := range f.DNS.Servers {
+			if net.ParseIP(server) == nil {
+				return apierror.Invalid("dns.servers", "Invalid IP %s", server)
+			}
+		}
+	}
+	return nil
+}
+
+func marshal(v interface{}) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// Config returns the configuration stored once the file is applied
+// over the current one
+func (f File) Config(current revisions.Config) revisions.Config {
+	config := revisions.Config{}
+	for name, values := range current {
+		config[name] = values
+	}
+	if f.Addresses != nil {
+		config["address"] = map[string]json.RawMessage{}
+		for _, a := range *f.Addresses {
+			config["address"][a.ID] = marshal(a.address())
+		}
+	}
+	if f.Routes != nil {
+		config["routes"] = map[string]json.RawMessage{}
+		if gw := f.Routes.Gateway; gw != nil {
+			config["routes"]["default"] = marshal(gateway.Gateway{IP: gw.IP, Link: gw.Link})
+		}
+	}
+	if f.DNS != nil {
+		config["dns"] = map[string]json.RawMessage{"dns": marshal(dnsconfig.DnsConfig{
+			Servers:  f.DNS.Servers,
+			Search:   f.DNS.Search,
+			Ndots:    f.DNS.Ndots,
+			Timeout:  f.DNS.Timeout,
+			Attempts: f.DNS.Attempts,
+			Rotate:   f.DNS.Rotate,
+		})}
+	}
+	if f.DHCP != nil {
+		iface := f.DHCP.Interface
+		if iface == "" {
+			iface = "eth0"
+		}
+		config["dhcp"] = map[string]json.RawMessage{"active": marshal(dhcp.Config{Active: f.DHCP.Active, Interface: iface})}
+	}
+	return config
+}
+
+// LinkChange is a change of a network interface
+type LinkChange struct {
+	Link     netlink.Link
+	Field    string
+	From, To string
+}
+
+func (c LinkChange) String() string {
+	return fmt.Sprintf("~ link/%s %s %s -> %s", c.Link.Attrs().Name, c.Field, c.From, c.To)
+}
+
+// LinkChanges returns the changes the file brings to the links
+func (f File) LinkChanges() (changes []LinkChange, err error) {
+	for _, l := range f.Links {
+		link, err := netlink.LinkByName(l.Name)
+		if err != nil {
+			return nil, fmt.Errorf("link %s: %s", l.Name, err)
+		}
+		attrs := link.Attrs()
+		if l.MTU != 0 && l.MTU != attrs.MTU {
+			changes = append(changes, LinkChange{link, "mtu", strconv.Itoa(attrs.MTU), strconv.Itoa(l.MTU)})
+		}
+		up := attrs.Flags&net.FlagUp != 0
+		if l.Up != nil && *l.Up != up {
+			changes = append(changes, LinkChange{link, "up", strconv.FormatBool(up), strconv.FormatBool(*l.Up)})
+		}
+	}
+	return
+}
+
+// Apply changes the network interface
+func (c LinkChange) Apply() error {
+	switch c.Field {
+	case "mtu":
+		mtu, _ := strconv.Atoi(c.To)
+		return netlink.LinkSetMTU(c.Link, mtu)
+	case "up":
+		if c.To == "true" {
+			return netlink.LinkSetUp(c.Link)
+		}
+		return netlink.LinkSetDown(c.Link)
+	}
+	return nil
+}
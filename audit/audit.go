@@ -0,0 +1,371 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/boltdb/bolt"
+
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/auth"
+	"github.com/guilhem/tentacool/types"
+)
+
+const auditBucket = "audit"
+
+var apiVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// skipped buckets are not recorded: tokens only hold secrets, the
+// others are internal, revisions and leases growing on their own
+var skipped = map[string]bool{
+	auditBucket: true,
+	"tokens":    true,
+	"revisions": true,
+	"meta":      true,
+	"leases":    true,
+}
+
+// Handler records changes and serves the audit log
+type Handler struct {
+	DB *bolt.DB
+	// mu guards last and orders the records of the chain, changes
+	// running concurrently being recorded by the first one to end
+	mu sync.Mutex
+	// last is the snapshot of the previous record, the next one
+	// holding what changed since
+	last map[string][]byte
+
+	subscribersMu sync.Mutex
+	subscribers   map[chan recordStruct]bool
+}
+
+// resultStruct is the outcome of the change
+type resultStruct = types.RecordResult
+
+// recordStruct is an audit record, chained to the previous one by Prev
+type recordStruct = types.Record
+
+// Record is an entry of the audit log
+type Record = recordStruct
+
+// sum hashes the record without its own hash
+func sum(r recordStruct) (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// resource is the first element of the path after the API version
+func resource(path string) string {
+	elements := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 3)
+	if len(elements) > 1 && apiVersion.MatchString(elements[0]) {
+		return elements[1]
+	}
+	return elements[0]
+}
+
+// snapshot returns the values of every recorded bucket, by "bucket/key"
+func (h *Handler) snapshot() (values map[string][]byte, err error) {
+	values = map[string][]byte{}
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) (err error) {
+			if skipped[string(name)] {
+				return
+			}
+			return b.ForEach(func(k, v []byte) (err error) {
+				values[string(name)+"/"+string(k)] = append([]byte{}, v...)
+				return
+			})
+		})
+	})
+	return
+}
+
+// raw keeps JSON values as is and quotes the others
+func raw(v []byte) json.RawMessage {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, v); err == nil {
+		return buf.Bytes()
+	}
+	quoted, _ := json.Marshal(string(v))
+	return quoted
+}
+
+// diff returns the values changed between two snapshots
+func diff(old, cur map[string][]byte) (before, after map[string]json.RawMessage) {
+	before = map[string]json.RawMessage{}
+	after = map[string]json.RawMessage{}
+	for k, v := range old {
+		if w, ok := cur[k]; !ok || !bytes.Equal(v, w) {
+			before[k] = raw(v)
+			after[k] = json.RawMessage("null")
+		}
+	}
+	for k, w := range cur {
+		if v, ok := old[k]; !ok || !bytes.Equal(v, w) {
+			if !ok {
+				before[k] = json.RawMessage("null")
+			}
+			after[k] = raw(w)
+		}
+	}
+	return
+}
+
+// baseline takes the snapshot the first record is diffed against
+func (h *Handler) baseline() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.last != nil {
+		return nil
+	}
+	last, err := h.snapshot()
+	if err != nil {
+		return err
+	}
+	h.last = last
+	return nil
+}
+
+// commit chains a record of the values changed since the previous one
+func (h *Handler) commit(record recordStruct) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cur, err := h.snapshot()
+	if err != nil {
+		return err
+	}
+	record.Before, record.After = diff(h.last, cur)
+	if err := h.append(record); err != nil {
+		return err
+	}
+	h.last = cur
+	return nil
+}
+
+// Change records a change of the DB made outside of the API, by the
+// offline commands, returning the error of change
+func (h *Handler) Change(record recordStruct, change func() error) error {
+	if err := h.baseline(); err != nil {
+		return err
+	}
+	record.Time = time.Now().UTC()
+	err := change()
+	record.Result.Status = http.StatusOK
+	if err != nil {
+		record.Result.Status = http.StatusInternalServerError
+		record.Result.Error = err.Error()
+	}
+	if err := h.commit(record); err != nil {
+		log.WithError(err).Error("Can't append audit record")
+	}
+	return err
+}
+
+// append chains the record to the log
+func (h *Handler) append(record recordStruct) error {
+	err := h.DB.Update(func(tx *bolt.Tx) (err error) {
+		b := tx.Bucket([]byte(auditBucket))
+		if _, last := b.Cursor().Last(); last != nil {
+			prev := recordStruct{}
+			if err = json.Unmarshal(last, &prev); err != nil {
+				return
+			}
+			record.Prev = prev.Hash
+		}
+		if record.Seq, err = b.NextSequence(); err != nil {
+			return
+		}
+		if record.Hash, err = sum(record); err != nil {
+			return
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return
+		}
+		return b.Put(itob(record.Seq), data)
+	})
+	if err == nil {
+		h.publish(record)
+	}
+	return err
+}
+
+// Middleware records every request changing something, with the
+// client set in auth.UserEnv and the pid of socket peers, the values
+// changed and the result
+func (h *Handler) Middleware() rest.Middleware {
+	return rest.MiddlewareSimple(func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return func(w rest.ResponseWriter, req *rest.Request) {
+			if req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions {
+				handler(w, req)
+				return
+			}
+			if err := h.baseline(); err != nil {
+				apierror.Write(w, err)
+				return
+			}
+			record := recordStruct{
+				Time:     time.Now().UTC(),
+				Method:   req.Method,
+				Path:     req.URL.Path,
+				Resource: resource(req.URL.Path),
+			}
+			if user, ok := req.Env[auth.UserEnv].(string); ok {
+				record.User = user
+			}
+			if cred, ok := auth.PeerCred(req.RemoteAddr); ok {
+				record.Pid = cred.Pid
+			}
+
+			var body *apierror.BodyWriter
+			recorded := (&rest.RecorderMiddleware{}).MiddlewareFunc(func(w rest.ResponseWriter, req *rest.Request) {
+				body = &apierror.BodyWriter{ResponseWriter: w}
+				handler(body, req)
+			})
+			recorded(w, req)
+
+			record.Result.Status, _ = req.Env["STATUS_CODE"].(int)
+			if record.Result.Status >= http.StatusBadRequest {
+				if sent, ok := body.Sent(); ok {
+					record.Result.Error = sent.Error()
+				}
+			}
+			if err := h.commit(record); err != nil {
+				log.WithError(err).Error("Can't append audit record")
+			}
+		}
+	})
+}
+
+// GetAudit returns the records, filtered by the "since" and "until"
+// RFC 3339 times, the "resource" and the "user" query parameters
+func (h *Handler) GetAudit(w rest.ResponseWriter, req *rest.Request) {
+	query := req.URL.Query()
+	var since, until time.Time
+	var err error
+	if s := query.Get("since"); s != "" {
+		if since, err = time.Parse(time.RFC3339, s); err != nil {
+			apierror.Write(w, apierror.Invalid("since", "%s", err))
+			return
+		}
+	}
+	if s := query.Get("until"); s != "" {
+		if until, err = time.Parse(time.RFC3339, s); err != nil {
+			apierror.Write(w, apierror.Invalid("until", "%s", err))
+			return
+		}
+	}
+
+	records := []recordStruct{}
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
+		return tx.Bucket([]byte(auditBucket)).ForEach(func(k, v []byte) (err error) {
+			record := recordStruct{}
+			if err = json.Unmarshal(v, &record); err != nil {
+				return
+			}
+			switch {
+			case !since.IsZero() && record.Time.Before(since):
+			case !until.IsZero() && record.Time.After(until):
+			case query.Get("resource") != "" && query.Get("resource") != record.Resource:
+			case query.Get("user") != "" && query.Get("user") != record.User:
+			default:
+				records = append(records, record)
+			}
+			return
+		})
+	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(records)
+}
+
+// verifyStruct is the result of a chain verification
+type verifyStruct struct {
+	Valid   bool   `json:"valid"`
+	Records int    `json:"records"`
+	Broken  uint64 `json:"broken,omitempty"`
+}
+
+// Verification is the result of a chain verification
+type Verification = verifyStruct
+
+// Verify walks the chain, returning the first record not matching
+func (h *Handler) Verify() (result verifyStruct, err error) {
+	result.Valid = true
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
+		prev := ""
+		return tx.Bucket([]byte(auditBucket)).ForEach(func(k, v []byte) (err error) {
+			if !result.Valid {
+				return
+			}
+			record := recordStruct{}
+			if err = json.Unmarshal(v, &record); err != nil {
+				return
+			}
+			result.Records++
+			hash, err := sum(record)
+			if err != nil {
+				return
+			}
+			if record.Prev != prev || record.Hash != hash || !bytes.Equal(k, itob(record.Seq)) {
+				result.Valid = false
+				result.Broken = record.Seq
+			}
+			prev = record.Hash
+			return
+		})
+	})
+	return
+}
+
+// GetVerify checks the chain of records
+func (h *Handler) GetVerify(w rest.ResponseWriter, req *rest.Request) {
+	result, err := h.Verify()
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(result)
+}
+
+// DBinit initializes the audit database at startup
+func (h *Handler) DBinit() (err error) {
+	if err = h.DB.Update(func(tx *bolt.Tx) (err error) {
+		_, err = tx.CreateBucketIfNotExists([]byte(auditBucket))
+		return
+	}); err != nil {
+		return
+	}
+	result, err := h.Verify()
+	if err != nil {
+		return
+	}
+	if !result.Valid {
+		log.Errorf("Audit log tampered with, chain broken at record %d", result.Broken)
+	}
+	return
+}
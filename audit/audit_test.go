@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func put(db *bolt.DB, key, value string) error {
+	return db.Update(func(tx *bolt.Tx) (err error) {
+		b, err := tx.CreateBucketIfNotExists([]byte("address"))
+		if err != nil {
+			return
+		}
+		return b.Put([]byte(key), []byte(value))
+	})
+}
+
+func TestChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tentacool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	h := &Handler{DB: db}
+	if err := h.DBinit(); err != nil {
+		t.Fatal(err)
+	}
+	// changes made before the first record are not recorded
+	if err := put(db, "0", `{"ip":"10.0.0.0/8"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	err = h.Change(recordStruct{User: "uid:0", Method: "APPLY", Path: "outer.yml"}, func() error {
+		// the log is not locked while changing
+		err := h.Change(recordStruct{User: "uid:0", Method: "APPLY", Path: "inner.yml"}, func() error {
+			return put(db, "1", `{"ip":"10.0.0.1/8"}`)
+		})
+		if err != nil {
+			return err
+		}
+		return put(db, "2", `{"ip":"10.0.0.2/8"}`)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := errors.New("not applied")
+	if err := h.Change(recordStruct{Method: "IMPORT", Path: "backup.json"}, func() error { return failed }); err != failed {
+		t.Errorf("got %v, expecting %v", err, failed)
+	}
+
+	records := []recordStruct{}
+	err = db.View(func(tx *bolt.Tx) (err error) {
+		return tx.Bucket([]byte(auditBucket)).ForEach(func(k, v []byte) (err error) {
+			record := recordStruct{}
+			if err = json.Unmarshal(v, &record); err != nil {
+				return
+			}
+			records = append(records, record)
+			return
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path   string
+		after  []string
+		status int
+	}{
+		{"inner.yml", []string{"address/1"}, http.StatusOK},
+		{"outer.yml", []string{"address/2"}, http.StatusOK},
+		{"backup.json", []string{}, http.StatusInternalServerError},
+	}
+	if len(records) != len(tests) {
+		t.Fatalf("got %d records", len(records))
+	}
+	for i, test := range tests {
+		r := records[i]
+		after := []string{}
+		for k := range r.After {
+			after = append(after, k)
+		}
+		if r.Path != test.path || !reflect.DeepEqual(after, test.after) || r.Result.Status != test.status {
+			t.Errorf("record %d: got %s %v %d, expecting %s %v %d", i, r.Path, after, r.Result.Status, test.path, test.after, test.status)
+		}
+	}
+	if records[2].Result.Error != failed.Error() {
+		t.Errorf("got error %q", records[2].Result.Error)
+	}
+	if result, err := h.Verify(); err != nil || !result.Valid || result.Records != 3 {
+		t.Errorf("got %+v, %v", result, err)
+	}
+}
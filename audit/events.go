@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/boltdb/bolt"
+
+	"github.com/guilhem/tentacool/apierror"
+)
+
+// eventsBuffer is the number of records a subscriber may lag behind
+// before being dropped, it then resumes with Last-Event-ID
+const eventsBuffer = 64
+
+func (h *Handler) subscribe() chan recordStruct {
+	h.subscribersMu.Lock()
+	defer h.subscribersMu.Unlock()
+	if h.subscribers == nil {
+		h.subscribers = map[chan recordStruct]bool{}
+	}
+	records := make(chan recordStruct, eventsBuffer)
+	h.subscribers[records] = true
+	return records
+}
+
+func (h *Handler) unsubscribe(records chan recordStruct) {
+	h.subscribersMu.Lock()
+	defer h.subscribersMu.Unlock()
+	if h.subscribers[records] {
+		delete(h.subscribers, records)
+		close(records)
+	}
+}
+
+// publish sends the record to subscribers, closing the ones lagging
+func (h *Handler) publish(record recordStruct) {
+	h.subscribersMu.Lock()
+	defer h.subscribersMu.Unlock()
+	for records := range h.subscribers {
+		select {
+		case records <- record:
+		default:
+			delete(h.subscribers, records)
+			close(records)
+		}
+	}
+}
+
+// since returns the records following seq
+func (h *Handler) since(seq uint64) (records []recordStruct, err error) {
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
+		c := tx.Bucket([]byte(auditBucket)).Cursor()
+		for k, v := c.Seek(itob(seq + 1)); k != nil; k, v = c.Next() {
+			record := recordStruct{}
+			if err = json.Unmarshal(v, &record); err != nil {
+				return
+			}
+			records = append(records, record)
+		}
+		return
+	})
+	return
+}
+
+// GetEvents streams the records as server-sent events, filtered by
+// the "resource" query parameter. Records following the one given by
+// the Last-Event-ID header are sent first.
+func (h *Handler) GetEvents(w rest.ResponseWriter, req *rest.Request) {
+	stream, ok := w.(http.ResponseWriter)
+	flusher, flushes := w.(http.Flusher)
+	if !ok || !flushes {
+		apierror.Write(w, errors.New("Streaming unsupported"))
+		return
+	}
+
+	records := h.subscribe()
+	defer h.unsubscribe(records)
+
+	var last uint64
+	var missed []recordStruct
+	if id := req.Header.Get("Last-Event-ID"); id != "" {
+		var err error
+		if last, err = strconv.ParseUint(id, 10, 64); err != nil {
+			apierror.Write(w, apierror.Invalid("Last-Event-ID", "%s", err))
+			return
+		}
+		if missed, err = h.since(last); err != nil {
+			apierror.Write(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	resource := req.URL.Query().Get("resource")
+	send := func(record recordStruct) bool {
+		if record.Seq <= last {
+			return true
+		}
+		last = record.Seq
+		if resource != "" && resource != record.Resource {
+			return true
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return false
+		}
+		if _, err := fmt.Fprintf(stream, "id: %d\ndata: %s\n\n", record.Seq, data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	for _, record := range missed {
+		if !send(record) {
+			return
+		}
+	}
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case record, ok := <-records:
+			if !ok || !send(record) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/boltdb/bolt"
+
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/types"
+)
+
+const (
+	tokensBucket = "tokens"
+	tokenBytes   = 32
+	// UserEnv is the request Env key holding the authenticated client
+	UserEnv = "REMOTE_USER"
+)
+
+// Handler serves the tokens API and authenticates requests
+type Handler struct {
+	DB *bolt.DB
+	// Policy restricts unix socket peers, nil allows everything
+	Policy *Policy
+}
+
+// tokenStruct is a stored token, the secret itself is never kept
+type tokenStruct = types.Token
+
+// Token is an API token, its secret only set at creation
+type Token = tokenStruct
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetTokens returns all tokens, without their hash
+func (h *Handler) GetTokens(w rest.ResponseWriter, req *rest.Request) {
+	tokens := []tokenStruct{}
+	err := h.DB.View(func(tx *bolt.Tx) (err error) {
+		return tx.Bucket([]byte(tokensBucket)).ForEach(func(k, v []byte) (err error) {
+			token := tokenStruct{}
+			if err = json.Unmarshal(v, &token); err != nil {
+				return
+			}
+			token.Hash = ""
+			tokens = append(tokens, token)
+			return
+		})
+	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(tokens)
+}
+
+// PostToken creates a token, returned in clear this time only
+func (h *Handler) PostToken(w rest.ResponseWriter, req *rest.Request) {
+	token := tokenStruct{}
+	if err := req.DecodeJsonPayload(&token); err != nil {
+		apierror.Write(w, apierror.BadRequest(err))
+		return
+	}
+	if token.Name == "" {
+		apierror.Write(w, apierror.Invalid("name", "Name is empty"))
+		return
+	}
+
+	token, err := h.Create(token.Name)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.Created(w, req.URL.Path+"/"+token.ID, token)
+}
+
+// Create stores a new token for name, returned with its secret
+// in clear this time only
+func (h *Handler) Create(name string) (token Token, err error) {
+	secret := make([]byte, tokenBytes)
+	if _, err = rand.Read(secret); err != nil {
+		return
+	}
+	id := make([]byte, 8)
+	if _, err = rand.Read(id); err != nil {
+		return
+	}
+	token.ID = hex.EncodeToString(id)
+	token.Name = name
+	token.Token = hex.EncodeToString(secret)
+	token.Created = time.Now().UTC()
+
+	err = h.DB.Update(func(tx *bolt.Tx) (err error) {
+		stored := token
+		stored.Hash = hash(token.Token)
+		stored.Token = ""
+		data, err := json.Marshal(stored)
+		if err != nil {
+			return
+		}
+		return tx.Bucket([]byte(tokensBucket)).Put([]byte(token.ID), data)
+	})
+	if err != nil {
+		return
+	}
+	log.Printf("Token %s created for %s", token.ID, token.Name)
+	return
+}
+
+// DeleteToken revokes the token with the specified ID
+func (h *Handler) DeleteToken(w rest.ResponseWriter, req *rest.Request) {
+	id := req.PathParam("token")
+	err := h.DB.Update(func(tx *bolt.Tx) (err error) {
+		b := tx.Bucket([]byte(tokensBucket))
+		if b.Get([]byte(id)) == nil {
+			return apierror.NotFound("Could not find token %s", id)
+		}
+		return b.Delete([]byte(id))
+	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	log.Printf("Token %s revoked", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// check returns the stored token matching the given secret
+func (h *Handler) check(secret string) (token tokenStruct, err error) {
+	sum := []byte(hash(secret))
+	found := false
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
+		return tx.Bucket([]byte(tokensBucket)).ForEach(func(k, v []byte) (err error) {
+			t := tokenStruct{}
+			if err = json.Unmarshal(v, &t); err != nil {
+				return
+			}
+			if subtle.ConstantTimeCompare(sum, []byte(t.Hash)) == 1 {
+				token = t
+				found = true
+			}
+			return
+		})
+	})
+	if err == nil && !found {
+		err = errors.New("invalid token")
+	}
+	return
+}
+
+// Middleware authenticates requests with a verified TLS client
+// certificate or a bearer token, the client is set in UserEnv
+func (h *Handler) Middleware() rest.Middleware {
+	return rest.MiddlewareSimple(func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return func(w rest.ResponseWriter, req *rest.Request) {
+			if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+				req.Env[UserEnv] = "cert:" + req.TLS.VerifiedChains[0][0].Subject.CommonName
+				handler(w, req)
+				return
+			}
+
+			authorization := req.Header.Get("Authorization")
+			if strings.HasPrefix(authorization, "Bearer ") {
+				token, err := h.check(strings.TrimPrefix(authorization, "Bearer "))
+				if err == nil {
+					req.Env[UserEnv] = "token:" + token.ID
+					handler(w, req)
+					return
+				}
+				log.WithError(err).Warnf("Authentication failed from %s", req.RemoteAddr)
+			}
+
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tentacool"`)
+			apierror.Write(w, apierror.Unauthorized("Not Authorized"))
+		}
+	})
+}
+
+// DBinit initializes the tokens database at startup
+func (h *Handler) DBinit() (err error) {
+	return h.DB.Update(func(tx *bolt.Tx) (err error) {
+		_, err = tx.CreateBucketIfNotExists([]byte(tokensBucket))
+		return
+	})
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// peerFormat encodes credentials in the remote address of a connection,
+// the only connection data reaching handlers as Request.RemoteAddr
+const peerFormat = "peer:pid=%d,uid=%d,gid=%d"
+
+// peerListener reads SO_PEERCRED of every accepted unix connection
+type peerListener struct {
+	net.Listener
+}
+
+// PeerListener wraps a unix listener so the credentials of the peer
+// are available to handlers, see PeerCred
+func PeerListener(ln net.Listener) net.Listener {
+	return peerListener{ln}
+}
+
+func (l peerListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	unix, ok := conn.(*net.UnixConn)
+	if !ok {
+		return conn, nil
+	}
+	cred, err := ucred(unix)
+	if err != nil {
+		log.WithError(err).Warn("Can't read peer credentials")
+		return conn, nil
+	}
+	return peerConn{conn, cred}, nil
+}
+
+func ucred(conn *net.UnixConn) (cred *syscall.Ucred, err error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return
+	}
+	cerr := raw.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if cerr != nil {
+		return nil, cerr
+	}
+	return
+}
+
+type peerConn struct {
+	net.Conn
+	cred *syscall.Ucred
+}
+
+func (c peerConn) RemoteAddr() net.Addr {
+	return peerAddr{c.cred}
+}
+
+type peerAddr struct {
+	cred *syscall.Ucred
+}
+
+func (a peerAddr) Network() string {
+	return "unix"
+}
+
+func (a peerAddr) String() string {
+	return fmt.Sprintf(peerFormat, a.cred.Pid, a.cred.Uid, a.cred.Gid)
+}
+
+// PeerCred returns the credentials of the peer from a request
+// remote address, if it went through a PeerListener
+func PeerCred(remoteAddr string) (cred syscall.Ucred, ok bool) {
+	n, _ := fmt.Sscanf(remoteAddr, peerFormat, &cred.Pid, &cred.Uid, &cred.Gid)
+	return cred, n == 3
+}
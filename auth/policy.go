@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"os/user"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"github.com/guilhem/tentacool/apierror"
+)
+
+// Rule allows methods on paths, empty lists allowing everything.
+// A path allows itself and everything below it.
+type Rule struct {
+	Methods []string `mapstructure:"methods"`
+	Paths   []string `mapstructure:"paths"`
+}
+
+// Binding gives roles to a unix user or group
+type Binding struct {
+	User  string   `mapstructure:"user"`
+	Group string   `mapstructure:"group"`
+	Roles []string `mapstructure:"roles"`
+}
+
+// Policy decides what unix socket peers may do.
+// Peers without binding are denied, except root.
+type Policy struct {
+	Roles map[string][]Rule `mapstructure:"roles"`
+	Peers []Binding         `mapstructure:"peers"`
+}
+
+func (r Rule) allows(method, path string) bool {
+	if len(r.Methods) > 0 {
+		found := false
+		for _, m := range r.Methods {
+			if strings.EqualFold(m, method) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.Paths) == 0 {
+		return true
+	}
+	for _, p := range r.Paths {
+		p = strings.TrimSuffix(p, "/")
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that bindings refer to defined roles
+func (p *Policy) Validate() error {
+	for _, b := range p.Peers {
+		if (b.User == "") == (b.Group == "") {
+			return fmt.Errorf("peer binding needs either a user or a group: %+v", b)
+		}
+		for _, role := range b.Roles {
+			if _, ok := p.Roles[role]; !ok {
+				return fmt.Errorf("unknown role %q", role)
+			}
+		}
+	}
+	return nil
+}
+
+// peerNames resolves the user name and group names of a uid
+func peerNames(uid, gid uint32) (name string, groups map[string]bool) {
+	groups = map[string]bool{}
+	gids := []string{strconv.Itoa(int(gid))}
+	if u, err := user.LookupId(strconv.Itoa(int(uid))); err == nil {
+		name = u.Username
+		if ids, err := u.GroupIds(); err == nil {
+			gids = append(gids, ids...)
+		}
+	}
+	for _, id := range gids {
+		if g, err := user.LookupGroupId(id); err == nil {
+			groups[g.Name] = true
+		}
+	}
+	return
+}
+
+// Allows tells if a peer may do method on path
+func (p *Policy) Allows(uid, gid uint32, method, path string) bool {
+	if uid == 0 {
+		return true
+	}
+	name, groups := peerNames(uid, gid)
+	for _, b := range p.Peers {
+		if (b.User != "" && b.User != name && b.User != strconv.Itoa(int(uid))) ||
+			(b.Group != "" && !groups[b.Group]) {
+			continue
+		}
+		for _, role := range b.Roles {
+			for _, rule := range p.Roles[role] {
+				if rule.allows(method, path) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// PeerMiddleware enforces the policy on requests coming through a
+// PeerListener, the peer is set in UserEnv as "uid:<uid>"
+func (h *Handler) PeerMiddleware() rest.Middleware {
+	return rest.MiddlewareSimple(func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return func(w rest.ResponseWriter, req *rest.Request) {
+			cred, ok := PeerCred(req.RemoteAddr)
+			if !ok {
+				apierror.Write(w, apierror.Forbidden("Unknown peer"))
+				return
+			}
+			entry := log.WithFields(log.Fields{
+				"uid":    cred.Uid,
+				"pid":    cred.Pid,
+				"method": req.Method,
+				"path":   req.URL.Path,
+			})
+			req.Env[UserEnv] = "uid:" + strconv.Itoa(int(cred.Uid))
+
+			if h.Policy != nil && !h.Policy.Allows(cred.Uid, cred.Gid, req.Method, req.URL.Path) {
+				entry.Warn("Denied")
+				apierror.Write(w, apierror.Forbidden("Forbidden"))
+				return
+			}
+			if req.Method != http.MethodGet {
+				entry.Info("Allowed")
+			}
+			handler(w, req)
+		}
+	})
+}
@@ -0,0 +1,381 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"gopkg.in/yaml.v2"
+
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/revisions"
+	"github.com/guilhem/tentacool/types"
+)
+
+// Version of the backup document written by Export
+const Version = 1
+
+// Document is a backup of the configuration
+type Document = types.Document
+
+// Formats of the document
+const (
+	JSON = "json"
+	YAML = "yaml"
+)
+
+// FormatOf returns the format of a file name or media type,
+// JSON unless it names YAML
+func FormatOf(name string) string {
+	if strings.Contains(name, "yaml") || strings.HasSuffix(name, ".yml") {
+		return YAML
+	}
+	return JSON
+}
+
+// Marshal encodes the document in format, JSON being indented
+func Marshal(doc Document, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil || format != YAML {
+		return append(data, '\n'), err
+	}
+	// the values are raw JSON, going through a generic tree
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(tree)
+}
+
+// Unmarshal decodes a document in format
+func Unmarshal(data []byte, format string) (doc Document, err error) {
+	if format == YAML {
+		var tree interface{}
+		if err = yaml.Unmarshal(data, &tree); err != nil {
+			return
+		}
+		if tree, err = jsonTree(tree); err != nil {
+			return
+		}
+		if data, err = json.Marshal(tree); err != nil {
+			return
+		}
+	}
+	err = json.Unmarshal(data, &doc)
+	return
+}
+
+// jsonTree turns the maps decoded from YAML into JSON objects
+func jsonTree(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			// unquoted IDs are integers
+			var key string
+			switch k := k.(type) {
+			case string:
+				key = k
+			case int, uint64, float64, bool:
+				key = fmt.Sprint(k)
+			default:
+				return nil, fmt.Errorf("key %v is not a string", k)
+			}
+			var err error
+			if object[key], err = jsonTree(value); err != nil {
+				return nil, err
+			}
+		}
+		return object, nil
+	case []interface{}:
+		for i, value := range v {
+			var err error
+			if v[i], err = jsonTree(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// kind is the type of a field value
+type kind int
+
+const (
+	kindString kind = iota
+	kindStrings
+	kindBool
+	kindInt
+	kindIP
+	kindCIDR
+)
+
+type field struct {
+	kind     kind
+	required bool
+}
+
+// bucketSchema describes the values of a bucket,
+// keys being restricted when set
+type bucketSchema struct {
+	keys   []string
+	fields map[string]field
+}
+
+var schema = map[string]bucketSchema{
+	"address": {
+		fields: map[string]field{
+			"id":            {kindString, true},
+			"link":          {kindString, true},
+			"ip":            {kindCIDR, true},
+			"valid_lft":     {kindInt, false},
+			"preferred_lft": {kindInt, false},
+			"label":         {kindString, false},
+			"broadcast":     {kindIP, false},
+			"peer":          {kindString, false},
+			"flags":         {kindStrings, false},
+			"pool":          {kindString, false},
+		},
+	},
+	"pools": {
+		fields: map[string]field{
+			"id":      {kindString, true},
+			"link":    {kindString, true},
+			"cidr":    {kindCIDR, true},
+			"prefix":  {kindInt, false},
+			"exclude": {kindStrings, false},
+		},
+	},
+	"dhcp": {
+		keys: []string{"active"},
+		fields: map[string]field{
+			"active":    {kindBool, true},
+			"interface": {kindString, false},
+		},
+	},
+	"dns": {
+		keys: []string{"dns"},
+		fields: map[string]field{
+			"servers": {kindStrings, false},
+			"search":  {kindStrings, false},
+			"ndots":   {kindInt, false},
+			"timeout": {kindInt, false},
+			"attemps": {kindInt, false},
+			"rotate":  {kindBool, false},
+		},
+	},
+	"routes": {
+		keys: []string{"default"},
+		fields: map[string]field{
+			"ip":   {kindIP, true},
+			"link": {kindString, false},
+		},
+	},
+}
+
+func (f field) check(v interface{}) bool {
+	switch f.kind {
+	case kindString:
+		_, ok := v.(string)
+		return ok
+	case kindStrings:
+		if v == nil {
+			return true
+		}
+		list, ok := v.([]interface{})
+		for _, s := range list {
+			if _, isString := s.(string); !isString {
+				return false
+			}
+		}
+		return ok
+	case kindBool:
+		_, ok := v.(bool)
+		return ok
+	case kindInt:
+		n, ok := v.(float64)
+		return ok && n == float64(int(n))
+	case kindIP:
+		s, ok := v.(string)
+		return ok && net.ParseIP(s) != nil
+	case kindCIDR:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		_, _, err := net.ParseCIDR(s)
+		return err == nil
+	}
+	return false
+}
+
+// Validate checks the document against the schema of its version
+func Validate(d Document) error {
+	if d.Version != Version {
+		return apierror.Invalid("version", "unsupported version %d, expecting %d", d.Version, Version)
+	}
+	for name, values := range d.Buckets {
+		s, ok := schema[name]
+		if !ok {
+			return apierror.Invalid("buckets", "unknown bucket %q", name)
+		}
+		for key, raw := range values {
+			if err := s.validate(key, raw); err != nil {
+				return apierror.Invalid("buckets."+name+"."+key, "%s", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s bucketSchema) validate(key string, raw json.RawMessage) error {
+	if len(s.keys) > 0 {
+		found := false
+		for _, k := range s.keys {
+			found = found || k == key
+		}
+		if !found {
+			return fmt.Errorf("unexpected key")
+		}
+	}
+	value := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return err
+	}
+	for name, f := range s.fields {
+		v, ok := value[name]
+		if !ok {
+			if f.required {
+				return fmt.Errorf("missing %s", name)
+			}
+			continue
+		}
+		if !f.check(v) {
+			return fmt.Errorf("invalid %s: %v", name, v)
+		}
+	}
+	for name := range value {
+		if _, ok := s.fields[name]; !ok {
+			return fmt.Errorf("unknown field %s", name)
+		}
+	}
+	if id, ok := value["id"]; ok && id != key {
+		return fmt.Errorf("id %v doesn't match its key", id)
+	}
+	return nil
+}
+
+// Handler serves the backup API
+type Handler struct {
+	Revisions *revisions.Handler
+}
+
+// resultStruct is the outcome of an import
+type resultStruct = types.ImportResult
+
+// Result is the outcome of an import
+type Result = resultStruct
+
+// Export returns the current configuration as a document
+func Export(r *revisions.Handler) (doc Document, err error) {
+	config, err := r.Current()
+	if err != nil {
+		return
+	}
+	for name := range config {
+		if _, ok := schema[name]; !ok {
+			delete(config, name)
+		}
+	}
+	return Document{Version: Version, Created: time.Now().UTC(), Buckets: config}, nil
+}
+
+// Import validates the document and returns the changes it brings,
+// storing and applying it unless dryRun is set.
+// Failures to apply are returned as a revisions.ApplyError.
+func Import(r *revisions.Handler, doc Document, dryRun bool) (changes []revisions.Change, err error) {
+	if err = Validate(doc); err != nil {
+		return
+	}
+	current, err := r.Current()
+	if err != nil {
+		return
+	}
+	config := revisions.Config{}
+	for name := range schema {
+		config[name] = map[string]json.RawMessage{}
+		for key, raw := range doc.Buckets[name] {
+			var buf bytes.Buffer
+			if err = json.Compact(&buf, raw); err != nil {
+				return
+			}
+			config[name][key] = buf.Bytes()
+		}
+	}
+	changes = revisions.Diff(current, config)
+	if dryRun || len(changes) == 0 {
+		return
+	}
+	err = r.Replace(config)
+	return
+}
+
+// GetBackup returns the current configuration as a document,
+// in YAML when the Accept header asks for it
+func (h *Handler) GetBackup(w rest.ResponseWriter, req *rest.Request) {
+	doc, err := Export(h.Revisions)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	if FormatOf(req.Header.Get("Accept")) != YAML {
+		w.WriteJson(doc)
+		return
+	}
+	data, err := Marshal(doc, YAML)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.(http.ResponseWriter).Write(data)
+}
+
+// PutBackup imports a document, in YAML when its Content-Type says so,
+// only returning the changes it would bring with the "dry_run" query
+// parameter
+func (h *Handler) PutBackup(w rest.ResponseWriter, req *rest.Request) {
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		apierror.Write(w, apierror.BadRequest(err))
+		return
+	}
+	doc, err := Unmarshal(data, FormatOf(req.Header.Get("Content-Type")))
+	if err != nil {
+		apierror.Write(w, apierror.BadRequest(err))
+		return
+	}
+	if err := Validate(doc); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	dryRun, _ := strconv.ParseBool(req.URL.Query().Get("dry_run"))
+	changes, err := Import(h.Revisions, doc, dryRun)
+	result := resultStruct{Changes: changes, Applied: !dryRun && len(changes) > 0}
+	if err != nil {
+		if _, ok := err.(revisions.ApplyError); !ok {
+			apierror.Write(w, err)
+			return
+		}
+		apierror.NotApplied(w, result, err)
+		return
+	}
+	w.WriteJson(result)
+}
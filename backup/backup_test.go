@@ -0,0 +1,97 @@
+package backup
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guilhem/tentacool/revisions"
+)
+
+var doc = Document{
+	Version: Version,
+	Created: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+	Buckets: revisions.Config{
+		"address": {"1": json.RawMessage(`{"id":"1","link":"eth0","ip":"192.168.32.11/24","valid_lft":3600,"flags":["nodad"]}`)},
+		"pools":   {"svc": json.RawMessage(`{"id":"svc","link":"eth0","cidr":"192.168.32.16/28","prefix":24,"exclude":[]}`)},
+		"dhcp":    {"active": json.RawMessage(`{"active":false,"interface":"eth0"}`)},
+		"dns":     {"dns": json.RawMessage(`{"servers":["9.9.9.9"],"search":null,"ndots":1,"timeout":5,"attemps":2,"rotate":false}`)},
+		"routes":  {"default": json.RawMessage(`{"ip":"192.168.32.1","link":""}`)},
+	},
+}
+
+func TestFormatOf(t *testing.T) {
+	for name, format := range map[string]string{
+		"backup.json":          JSON,
+		"backup.yaml":          YAML,
+		"backup.yml":           YAML,
+		"-":                    JSON,
+		"application/json":     JSON,
+		"application/yaml":     YAML,
+		"application/x-yaml":   YAML,
+		"text/yaml, */*;q=0.8": YAML,
+		"":                     JSON,
+	} {
+		if got := FormatOf(name); got != format {
+			t.Errorf("%q: got %s, expecting %s", name, got, format)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []string{JSON, YAML} {
+		data, err := Marshal(doc, format)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+		got, err := Unmarshal(data, format)
+		if err != nil {
+			t.Fatalf("%s: %s\n%s", format, err, data)
+		}
+		if err := Validate(got); err != nil {
+			t.Errorf("%s: %s\n%s", format, err, data)
+		}
+		if !got.Created.Equal(doc.Created) || got.Version != doc.Version {
+			t.Errorf("%s: got %+v", format, got)
+		}
+		// the values are the same once decoded
+		for name, values := range doc.Buckets {
+			for key, raw := range values {
+				var expected, value interface{}
+				json.Unmarshal(raw, &expected)
+				json.Unmarshal(got.Buckets[name][key], &value)
+				if !reflect.DeepEqual(value, expected) {
+					t.Errorf("%s: %s/%s is %s, expecting %s", format, name, key, got.Buckets[name][key], raw)
+				}
+			}
+		}
+	}
+}
+
+func TestYAML(t *testing.T) {
+	data, err := Marshal(doc, YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// integer keys and IDs stay strings
+	if !strings.Contains(string(data), `id: "1"`) || strings.Contains(string(data), "{") {
+		t.Errorf("got\n%s", data)
+	}
+
+	handwritten := "version: 1\nbuckets:\n  address:\n    1: {id: \"1\", link: eth0, ip: 10.0.0.2/8}\n"
+	got, err := Unmarshal([]byte(handwritten), YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(got); err != nil {
+		t.Errorf("got %+v: %s", got, err)
+	}
+
+	for _, invalid := range []string{"version: [", "buckets:\n  address:\n    ? [a]\n    : {}\n"} {
+		if _, err := Unmarshal([]byte(invalid), YAML); err == nil {
+			t.Errorf("%q: expecting an error", invalid)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/addresses"
+)
+
+func addressRows(addrs ...addresses.Address) func() [][]string {
+	return func() [][]string {
+		rows := [][]string{{"ID", "LINK", "IP", "STATUS"}}
+		for _, a := range addrs {
+			rows = append(rows, []string{a.ID, a.Link, a.IP, a.Status})
+		}
+		return rows
+	}
+}
+
+// AddrList shows the managed addresses
+func AddrList(cmd *cobra.Command, args []string) {
+	addrs, err := newClient(cmd).ListAddresses()
+	check(cmd, err, nil, nil)
+	show(cmd, addrs, addressRows(addrs...))
+}
+
+// AddrAdd adds the address given as LINK CIDR, or allocated from
+// the --pool given
+func AddrAdd(cmd *cobra.Command, args []string) {
+	addr := addresses.Address{}
+	addr.Pool, _ = cmd.Flags().GetString("pool")
+	switch {
+	case len(args) == 2:
+		addr.Link, addr.IP = args[0], args[1]
+	case len(args) == 0 && addr.Pool != "":
+	default:
+		log.Fatal("LINK CIDR required, unless allocated from a --pool")
+	}
+	addr.ID, _ = cmd.Flags().GetString("id")
+	addr.ValidLft, _ = cmd.Flags().GetInt("valid-lft")
+	addr.PreferredLft, _ = cmd.Flags().GetInt("preferred-lft")
+	addr.Label, _ = cmd.Flags().GetString("label")
+	addr.Broadcast, _ = cmd.Flags().GetString("broadcast")
+	addr.Peer, _ = cmd.Flags().GetString("peer")
+	addr.Flags, _ = cmd.Flags().GetStringSlice("flag")
+	probe, _ := cmd.Flags().GetBool("probe")
+	addr, err := newClient(cmd).CreateAddress(addr, probe)
+	check(cmd, err, addr, addressRows(addr))
+	show(cmd, addr, addressRows(addr))
+}
+
+// AddrBatch runs the operations of the JSON batch read from the file
+// given, '-' being stdin
+func AddrBatch(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		log.Fatal("File required ('-' for stdin)")
+	}
+	in := io.Reader(os.Stdin)
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			log.WithError(err).Fatal()
+		}
+		defer f.Close()
+		in = f
+	}
+	batch := addresses.Batch{}
+	if err := json.NewDecoder(in).Decode(&batch); err != nil {
+		log.WithError(err).Fatal()
+	}
+	addrs, err := newClient(cmd).Batch(batch)
+	check(cmd, err, addrs, addressRows(addrs...))
+	show(cmd, addrs, addressRows(addrs...))
+}
+
+// AddrApply adds the addresses given by ID to their link again
+func AddrApply(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		log.Fatal("ID required")
+	}
+	c := newClient(cmd)
+	var addrs []addresses.Address
+	for _, id := range args {
+		addr, err := c.ApplyAddress(id)
+		check(cmd, err, addr, addressRows(addr))
+		addrs = append(addrs, addr)
+	}
+	show(cmd, addrs, addressRows(addrs...))
+}
+
+// AddrDel removes the addresses given by ID
+func AddrDel(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		log.Fatal("ID required")
+	}
+	c := newClient(cmd)
+	for _, id := range args {
+		check(cmd, c.DeleteAddress(id), nil, nil)
+	}
+}
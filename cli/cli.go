@@ -0,0 +1,97 @@
+// Package cli implements the commands talking to a running tentacool
+package cli
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/client"
+)
+
+// Output formats
+const (
+	Table = "table"
+	JSON  = "json"
+)
+
+// AddFlags adds the flags reaching the daemon to a command and its children
+func AddFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("host", "/var/run/tentacool", "Address of the daemon. Format Path or IP:PORT")
+	cmd.PersistentFlags().String("token", "", "Bearer token for a TCP daemon")
+	cmd.PersistentFlags().String("tls-ca", "", "CA bundle verifying a TCP daemon, enabling TLS")
+	cmd.PersistentFlags().StringP("output", "o", Table, "Output format: table or json")
+}
+
+// newClient returns a client of the daemon set by the flags
+func newClient(cmd *cobra.Command) *client.Client {
+	// keep stdout for the output
+	log.SetOutput(os.Stderr)
+
+	host, _ := cmd.Flags().GetString("host")
+	var config *tls.Config
+	if ca, _ := cmd.Flags().GetString("tls-ca"); ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			log.WithError(err).Fatal()
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			log.Fatalf("No certificate found in %s", ca)
+		}
+		config = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	c := client.New(host, config)
+	c.Token, _ = cmd.Flags().GetString("token")
+	return c
+}
+
+// show writes v as JSON, or as a table of the rows returned by
+// table, the first one being the header
+func show(cmd *cobra.Command, v interface{}, table func() [][]string) {
+	output, _ := cmd.Flags().GetString("output")
+	switch output {
+	case JSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			log.WithError(err).Fatal()
+		}
+		fmt.Println(string(data))
+	case Table:
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, row := range table() {
+			for i, cell := range row {
+				if i > 0 {
+					fmt.Fprint(w, "\t")
+				}
+				fmt.Fprint(w, cell)
+			}
+			fmt.Fprintln(w)
+		}
+		w.Flush()
+	default:
+		log.Fatalf("Unknown output format %q", output)
+	}
+}
+
+// check exits on errors, a change stored but not applied
+// being printed before
+func check(cmd *cobra.Command, err error, v interface{}, table func() [][]string) {
+	if err == nil {
+		return
+	}
+	if e, ok := err.(*apierror.Error); ok && e.Code == apierror.CodeNotApplied {
+		show(cmd, v, table)
+		log.WithError(err).Fatal("Stored but not applied")
+	}
+	log.WithError(err).Fatal()
+}
@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/dhcp"
+)
+
+func dhcpRows(config dhcp.Config) func() [][]string {
+	return func() [][]string {
+		return [][]string{{"ACTIVE", "LINK"}, {strconv.FormatBool(config.Active), config.Interface}}
+	}
+}
+
+// DHCP shows the state of the DHCP client
+func DHCP(cmd *cobra.Command, args []string) {
+	config, err := newClient(cmd).DHCP()
+	check(cmd, err, nil, nil)
+	show(cmd, config, dhcpRows(config))
+}
+
+func setDHCP(cmd *cobra.Command, args []string, active bool) {
+	config := dhcp.Config{Active: active}
+	if len(args) > 0 {
+		config.Interface = args[0]
+	}
+	config, err := newClient(cmd).SetDHCP(config)
+	check(cmd, err, config, dhcpRows(config))
+	show(cmd, config, dhcpRows(config))
+}
+
+// EnableDHCP starts the DHCP client on the link given, eth0 by default
+func EnableDHCP(cmd *cobra.Command, args []string) {
+	setDHCP(cmd, args, true)
+}
+
+// DisableDHCP stops the DHCP client on the link given, eth0 by default
+func DisableDHCP(cmd *cobra.Command, args []string) {
+	setDHCP(cmd, args, false)
+}
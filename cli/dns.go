@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/types"
+)
+
+func dnsRows(config types.DNS) func() [][]string {
+	return func() [][]string {
+		return [][]string{
+			{"SERVERS", "SEARCH", "NDOTS", "TIMEOUT", "ATTEMPTS", "ROTATE"},
+			{strings.Join(config.Servers, ","), strings.Join(config.Search, ","),
+				strconv.Itoa(config.Ndots), strconv.Itoa(config.Timeout),
+				strconv.Itoa(config.Attempts), strconv.FormatBool(config.Rotate)},
+		}
+	}
+}
+
+// DNS shows the resolver configuration
+func DNS(cmd *cobra.Command, args []string) {
+	config, err := newClient(cmd).DNS()
+	check(cmd, err, nil, nil)
+	show(cmd, config, dnsRows(config))
+}
+
+// SetDNS sets the resolver configuration to the servers given
+func SetDNS(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		log.Fatal("SERVER required")
+	}
+	config := types.DNS{Servers: args}
+	config.Search, _ = cmd.Flags().GetStringSlice("search")
+	config.Ndots, _ = cmd.Flags().GetInt("ndots")
+	config.Timeout, _ = cmd.Flags().GetInt("timeout")
+	config.Attempts, _ = cmd.Flags().GetInt("attempts")
+	config.Rotate, _ = cmd.Flags().GetBool("rotate")
+	config, err := newClient(cmd).SetDNS(config)
+	check(cmd, err, config, dnsRows(config))
+	show(cmd, config, dnsRows(config))
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/addresses"
+)
+
+func poolRows(pools ...addresses.Pool) func() [][]string {
+	return func() [][]string {
+		rows := [][]string{{"ID", "LINK", "CIDR", "SIZE", "USED", "FREE"}}
+		for _, p := range pools {
+			row := []string{p.ID, p.Link, p.CIDR, "", "", ""}
+			if p.Usage != nil {
+				row[3], row[4], row[5] = strconv.Itoa(p.Usage.Size), strconv.Itoa(p.Usage.Used), strconv.Itoa(p.Usage.Free)
+			}
+			rows = append(rows, row)
+		}
+		return rows
+	}
+}
+
+// PoolList shows the address pools with their usage
+func PoolList(cmd *cobra.Command, args []string) {
+	pools, err := newClient(cmd).ListPools()
+	check(cmd, err, nil, nil)
+	show(cmd, pools, poolRows(pools...))
+}
+
+// PoolShow shows the address pools given by ID with their usage
+func PoolShow(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		log.Fatal("ID required")
+	}
+	c := newClient(cmd)
+	var pools []addresses.Pool
+	for _, id := range args {
+		pool, err := c.GetPool(id)
+		check(cmd, err, nil, nil)
+		pools = append(pools, pool)
+	}
+	show(cmd, pools, poolRows(pools...))
+}
+
+// PoolAdd adds the address pool given as LINK CIDR
+func PoolAdd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		log.Fatal("LINK CIDR required")
+	}
+	pool := addresses.Pool{Link: args[0], CIDR: args[1]}
+	pool.ID, _ = cmd.Flags().GetString("id")
+	pool.Prefix, _ = cmd.Flags().GetInt("prefix")
+	pool.Exclude, _ = cmd.Flags().GetStringSlice("exclude")
+	pool, err := newClient(cmd).CreatePool(pool)
+	check(cmd, err, nil, nil)
+	show(cmd, pool, poolRows(pool))
+}
+
+// PoolDel removes the address pools given by ID
+func PoolDel(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		log.Fatal("ID required")
+	}
+	c := newClient(cmd)
+	for _, id := range args {
+		check(cmd, c.DeletePool(id), nil, nil)
+	}
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+)
+
+// Render shows the configuration as the files of a format, or writes
+// them under the directory set by --root
+func Render(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		log.Fatal("FORMAT required: ifupdown, netplan or networkd")
+	}
+	files, err := newClient(cmd).Render(args[0])
+	check(cmd, err, nil, nil)
+
+	root, _ := cmd.Flags().GetString("root")
+	if root == "" {
+		if output, _ := cmd.Flags().GetString("output"); output == JSON {
+			show(cmd, files, nil)
+			return
+		}
+		for i, f := range files {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("# %s\n%s", f.Path, f.Content)
+		}
+		return
+	}
+	for _, f := range files {
+		path := filepath.Join(root, f.Path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			log.WithError(err).Fatal()
+		}
+		if err := ioutil.WriteFile(path, []byte(f.Content), 0644); err != nil {
+			log.WithError(err).Fatal()
+		}
+		log.Infof("Wrote %s", path)
+	}
+}
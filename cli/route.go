@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/gateway"
+)
+
+// RouteList shows the routing table
+func RouteList(cmd *cobra.Command, args []string) {
+	routes, err := newClient(cmd).ListRoutes()
+	check(cmd, err, nil, nil)
+	show(cmd, routes, func() [][]string {
+		rows := [][]string{{"DST", "GW", "SRC", "LINK", "TABLE", "PROTO"}}
+		for _, r := range routes {
+			dst, gw, src := "default", "", ""
+			if r.Dst != nil {
+				dst = r.Dst.String()
+			}
+			if r.Gw != nil {
+				gw = r.Gw.String()
+			}
+			if r.Src != nil {
+				src = r.Src.String()
+			}
+			rows = append(rows, []string{dst, gw, src,
+				strconv.Itoa(r.LinkIndex), strconv.Itoa(r.Table), strconv.Itoa(r.Protocol)})
+		}
+		return rows
+	})
+}
+
+func gatewayRows(gw gateway.Gateway) func() [][]string {
+	return func() [][]string {
+		return [][]string{{"IP", "LINK"}, {gw.IP, gw.Link}}
+	}
+}
+
+// Gateway shows the default gateway
+func Gateway(cmd *cobra.Command, args []string) {
+	gw, err := newClient(cmd).Gateway()
+	check(cmd, err, nil, nil)
+	show(cmd, gw, gatewayRows(gw))
+}
+
+// SetGateway sets the default gateway given as IP [LINK]
+func SetGateway(cmd *cobra.Command, args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		log.Fatal("IP [LINK] required")
+	}
+	gw := gateway.Gateway{IP: args[0]}
+	if len(args) == 2 {
+		gw.Link = args[1]
+	}
+	gw, err := newClient(cmd).SetGateway(gw)
+	check(cmd, err, gw, gatewayRows(gw))
+	show(cmd, gw, gatewayRows(gw))
+}
@@ -0,0 +1,246 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/guilhem/tentacool/types"
+)
+
+// ListInterfaces returns the network interfaces
+func (c *Client) ListInterfaces() (ifaces []types.Interface, err error) {
+	err = c.do(http.MethodGet, "/interfaces", nil, nil, &ifaces)
+	return
+}
+
+// InterfaceAddresses returns the addresses of a network interface
+func (c *Client) InterfaceAddresses(name string) (addrs []types.InterfaceAddress, err error) {
+	err = c.do(http.MethodGet, pathf("/interfaces/%s", name), nil, nil, &addrs)
+	return
+}
+
+// ListAddresses returns the managed addresses
+func (c *Client) ListAddresses() (addrs []types.Address, err error) {
+	err = c.do(http.MethodGet, "/addresses", nil, nil, &addrs)
+	return
+}
+
+// GetAddress returns the address with the given ID
+func (c *Client) GetAddress(id string) (addr types.Address, err error) {
+	err = c.do(http.MethodGet, pathf("/addresses/%s", id), nil, nil, &addr)
+	return
+}
+
+// probeQuery returns the query checking that no other host
+// uses the IP when probe is set
+func probeQuery(probe bool) url.Values {
+	query := url.Values{}
+	if probe {
+		query.Set("probe", "true")
+	}
+	return query
+}
+
+// CreateAddress adds an address, its ID being allocated when empty.
+// With probe, the daemon first checks that no other host uses the IP.
+func (c *Client) CreateAddress(addr types.Address, probe bool) (created types.Address, err error) {
+	err = c.do(http.MethodPost, "/addresses", probeQuery(probe), addr, &created)
+	return
+}
+
+// SetAddress creates or replaces the address with the ID of addr.
+// With probe, the daemon first checks that no other host uses the IP.
+func (c *Client) SetAddress(addr types.Address, probe bool) (set types.Address, err error) {
+	err = c.do(http.MethodPut, pathf("/addresses/%s", addr.ID), probeQuery(probe), addr, &set)
+	return
+}
+
+// Batch creates, updates and deletes addresses all together or not at
+// all, returning the address of each operation
+func (c *Client) Batch(batch types.Batch) (addrs []types.Address, err error) {
+	err = c.do(http.MethodPost, "/addresses:batch", nil, batch, &addrs)
+	return
+}
+
+// ApplyAddress adds the address with the given ID to its link again
+func (c *Client) ApplyAddress(id string) (addr types.Address, err error) {
+	err = c.do(http.MethodPost, pathf("/addresses/%s/apply", id), nil, nil, &addr)
+	return
+}
+
+// DeleteAddress removes the address with the given ID
+func (c *Client) DeleteAddress(id string) error {
+	return c.do(http.MethodDelete, pathf("/addresses/%s", id), nil, nil, nil)
+}
+
+// ListPools returns the address pools with their usage
+func (c *Client) ListPools() (pools []types.Pool, err error) {
+	err = c.do(http.MethodGet, "/pools", nil, nil, &pools)
+	return
+}
+
+// GetPool returns the address pool with the given ID and its usage
+func (c *Client) GetPool(id string) (pool types.Pool, err error) {
+	err = c.do(http.MethodGet, pathf("/pools/%s", id), nil, nil, &pool)
+	return
+}
+
+// CreatePool adds an address pool, its ID being allocated when empty
+func (c *Client) CreatePool(pool types.Pool) (created types.Pool, err error) {
+	err = c.do(http.MethodPost, "/pools", nil, pool, &created)
+	return
+}
+
+// DeletePool removes the address pool with the given ID
+func (c *Client) DeletePool(id string) error {
+	return c.do(http.MethodDelete, pathf("/pools/%s", id), nil, nil, nil)
+}
+
+// ListRoutes returns the routing table
+func (c *Client) ListRoutes() (routes []types.Route, err error) {
+	err = c.do(http.MethodGet, "/routes", nil, nil, &routes)
+	return
+}
+
+// Gateway returns the default gateway
+func (c *Client) Gateway() (gw types.Gateway, err error) {
+	err = c.do(http.MethodGet, "/routes/gateway", nil, nil, &gw)
+	return
+}
+
+// SetGateway sets the default gateway
+func (c *Client) SetGateway(gw types.Gateway) (set types.Gateway, err error) {
+	err = c.do(http.MethodPost, "/routes/gateway", nil, gw, &set)
+	return
+}
+
+// DNS returns the resolver configuration
+func (c *Client) DNS() (config types.DNS, err error) {
+	err = c.do(http.MethodGet, "/dns", nil, nil, &config)
+	return
+}
+
+// SetDNS sets the resolver configuration
+func (c *Client) SetDNS(config types.DNS) (set types.DNS, err error) {
+	err = c.do(http.MethodPost, "/dns", nil, config, &set)
+	return
+}
+
+// DHCP returns the state of the DHCP client
+func (c *Client) DHCP() (config types.DHCP, err error) {
+	err = c.do(http.MethodGet, "/dhcp", nil, nil, &config)
+	return
+}
+
+// SetDHCP starts or stops the DHCP client
+func (c *Client) SetDHCP(config types.DHCP) (set types.DHCP, err error) {
+	err = c.do(http.MethodPost, "/dhcp", nil, config, &set)
+	return
+}
+
+// ListHosts returns the managed /etc/hosts entries
+func (c *Client) ListHosts() (entries []types.Host, err error) {
+	err = c.do(http.MethodGet, "/hosts", nil, nil, &entries)
+	return
+}
+
+// CreateHost adds an /etc/hosts entry, its ID being allocated when empty
+func (c *Client) CreateHost(host types.Host) (created types.Host, err error) {
+	err = c.do(http.MethodPost, "/hosts", nil, host, &created)
+	return
+}
+
+// SetHost creates or replaces the /etc/hosts entry with the ID of host
+func (c *Client) SetHost(host types.Host) (set types.Host, err error) {
+	err = c.do(http.MethodPut, pathf("/hosts/%s", host.ID), nil, host, &set)
+	return
+}
+
+// DeleteHost removes the /etc/hosts entry with the given ID
+func (c *Client) DeleteHost(id string) error {
+	return c.do(http.MethodDelete, pathf("/hosts/%s", id), nil, nil, nil)
+}
+
+// Hostname returns the hostname
+func (c *Client) Hostname() (name types.Hostname, err error) {
+	err = c.do(http.MethodGet, "/hostname", nil, nil, &name)
+	return
+}
+
+// SetHostname sets the hostname
+func (c *Client) SetHostname(name types.Hostname) (set types.Hostname, err error) {
+	err = c.do(http.MethodPut, "/hostname", nil, name, &set)
+	return
+}
+
+// ListRevisions returns the configuration revisions
+func (c *Client) ListRevisions() (list []types.Revision, err error) {
+	err = c.do(http.MethodGet, "/revisions", nil, nil, &list)
+	return
+}
+
+// Rollback stores and applies the configuration of revision n
+func (c *Client) Rollback(n uint64) (revision types.Revision, err error) {
+	err = c.do(http.MethodPost, "/revisions/"+strconv.FormatUint(n, 10)+"/rollback", nil, nil, &revision)
+	return
+}
+
+// Backup exports the configuration
+func (c *Client) Backup() (doc types.Document, err error) {
+	err = c.do(http.MethodGet, "/backup", nil, nil, &doc)
+	return
+}
+
+// Render returns the configuration as the files of a format:
+// "ifupdown", "netplan" or "networkd"
+func (c *Client) Render(format string) (files []types.File, err error) {
+	err = c.do(http.MethodGet, pathf("/render/%s", format), nil, nil, &files)
+	return
+}
+
+// Restore imports a configuration, only returning
+// the changes it would bring when dryRun is set
+func (c *Client) Restore(doc types.Document, dryRun bool) (result types.ImportResult, err error) {
+	query := url.Values{}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+	err = c.do(http.MethodPut, "/backup", query, doc, &result)
+	return
+}
+
+// Snapshot returns the network state of the kernel
+func (c *Client) Snapshot() (s types.Snapshot, err error) {
+	err = c.do(http.MethodGet, "/snapshot", nil, nil, &s)
+	return
+}
+
+// Adopt manages the selected live objects, only returning
+// the changes it would bring when dryRun is set
+func (c *Client) Adopt(adoption types.Adoption, dryRun bool) (result types.ImportResult, err error) {
+	query := url.Values{}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+	err = c.do(http.MethodPost, "/adopt", query, adoption, &result)
+	return
+}
+
+// ListAudit returns the audit records matching the query parameters
+// of GET /v1/audit: "since", "until", "resource" and "user"
+func (c *Client) ListAudit(query url.Values) (records []types.Record, err error) {
+	err = c.do(http.MethodGet, "/audit", query, nil, &records)
+	return
+}
+
+// CreateToken returns a new API token, its secret only being known now
+func (c *Client) CreateToken(name string) (token types.Token, err error) {
+	err = c.do(http.MethodPost, "/tokens", nil, types.Token{Name: name}, &token)
+	return
+}
+
+// DeleteToken revokes an API token
+func (c *Client) DeleteToken(id string) error {
+	return c.do(http.MethodDelete, pathf("/tokens/%s", id), nil, nil, nil)
+}
@@ -0,0 +1,136 @@
+// Package client talks to a tentacool daemon through its REST API
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/guilhem/tentacool/types"
+)
+
+// prefix is the path of the version of the API spoken by the client
+const prefix = "/v1"
+
+// Client is a client of the tentacool API.
+// Errors returned by the daemon are *types.Error, the ones with
+// the types.CodeNotApplied code coming with the stored resource.
+type Client struct {
+	// Token is sent as a bearer token when set, for TCP daemons
+	Token string
+
+	base string
+	http *http.Client
+}
+
+// New returns a client of the daemon bound to addr, either a unix
+// socket path or a TCP "IP:PORT" like its --bind flag.
+// TCP connections use TLS when config is set.
+func New(addr string, config *tls.Config) *Client {
+	transport := &http.Transport{}
+	c := &Client{http: &http.Client{Transport: transport}}
+	if _, err := net.ResolveTCPAddr("tcp", addr); err == nil {
+		c.base = "http://" + addr
+		if config != nil {
+			c.base = "https://" + addr
+			transport.TLSClientConfig = config
+		}
+	} else {
+		c.base = "http://unix"
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}
+	}
+	return c
+}
+
+func (c *Client) request(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	u := c.base + prefix + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return req, nil
+}
+
+// decodeError reads the error sent by the daemon, decoding the stored
+// resource of types.CodeNotApplied errors into out. The owner of
+// types.CodeConflict errors is kept as a json.RawMessage.
+func decodeError(resp *http.Response, out interface{}) error {
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	e := &types.Error{}
+	var resource json.RawMessage
+	e.Resource = &resource
+	if err := json.Unmarshal(data, e); err != nil || e.Code == "" {
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	e.Resource = nil
+	if e.Code == types.CodeNotApplied && out != nil && len(resource) > 0 {
+		if err := json.Unmarshal(resource, out); err != nil {
+			return err
+		}
+		e.Resource = out
+	}
+	if e.Code == types.CodeConflict && len(resource) > 0 {
+		e.Resource = resource
+	}
+	return e
+}
+
+// do sends a request with body as JSON, decoding the response into out
+func (c *Client) do(method, path string, query url.Values, body, out interface{}) error {
+	req, err := c.request(context.Background(), method, path, query, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return decodeError(resp, out)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// pathf builds a path escaping its parameters
+func pathf(format string, params ...string) string {
+	escaped := make([]interface{}, len(params))
+	for i, p := range params {
+		escaped[i] = url.PathEscape(p)
+	}
+	return fmt.Sprintf(format, escaped...)
+}
@@ -0,0 +1,185 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/guilhem/tentacool/addresses"
+	"github.com/guilhem/tentacool/client"
+	"github.com/guilhem/tentacool/hosts"
+	"github.com/guilhem/tentacool/types"
+	"github.com/guilhem/tentacool/web"
+)
+
+// newClient returns a client of a daemon serving the API over the fake
+// backends, with a DB and an /etc/hosts of its own
+func newClient(t *testing.T) (*client.Client, *addresses.FakeBackend, func()) {
+	dir, err := ioutil.TempDir("", "tentacool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts.HostsPath = filepath.Join(dir, "hosts")
+	db, err := bolt.Open(filepath.Join(dir, "db"), 0600, nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+	h := web.NewFakeHandlers(db)
+	if err := h.DBinit(); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	api, err := web.NewAPI(h)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(api.MakeHandler())
+	c := client.New(strings.TrimPrefix(server.URL, "http://"), nil)
+	return c, h.Addresses.Backend.(*addresses.FakeBackend), func() {
+		server.Close()
+		cleanup()
+	}
+}
+
+// code returns the code of an error sent by the daemon
+func code(t *testing.T, err error) types.Code {
+	e, ok := err.(*types.Error)
+	if !ok {
+		t.Fatalf("got %v, expecting a *types.Error", err)
+	}
+	return e.Code
+}
+
+func TestAddresses(t *testing.T) {
+	c, _, cleanup := newClient(t)
+	defer cleanup()
+
+	created, err := c.CreateAddress(types.Address{Link: "eth0", IP: "192.168.32.11/24"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != "1" || created.Status != addresses.StatusApplied {
+		t.Errorf("CreateAddress: got %+v", created)
+	}
+	created.IP = "192.168.32.12/24"
+	if _, err := c.SetAddress(created, false); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetAddress(created.ID)
+	if err != nil || got.IP != "192.168.32.12/24" {
+		t.Errorf("GetAddress: got %+v, %v", got, err)
+	}
+	list, err := c.ListAddresses()
+	if err != nil || len(list) != 1 {
+		t.Errorf("ListAddresses: got %+v, %v", list, err)
+	}
+
+	if _, err := c.CreateAddress(types.Address{Link: "eth0", IP: "invalid"}, false); code(t, err) != types.CodeInvalid {
+		t.Errorf("CreateAddress: got %v", err)
+	}
+	if err := c.DeleteAddress(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetAddress(created.ID); code(t, err) != types.CodeNotFound {
+		t.Errorf("GetAddress: got %v", err)
+	}
+}
+
+func TestNotApplied(t *testing.T) {
+	c, backend, cleanup := newClient(t)
+	defer cleanup()
+
+	backend.Err = errors.New("failing")
+	created, err := c.CreateAddress(types.Address{Link: "eth0", IP: "192.168.32.11/24"}, false)
+	if code(t, err) != types.CodeNotApplied {
+		t.Fatalf("CreateAddress: got %v", err)
+	}
+	// the stored resource comes with the error and as the result
+	if stored, ok := err.(*types.Error).Resource.(*types.Address); !ok || stored.ID != "1" {
+		t.Errorf("CreateAddress: got resource %#v", err.(*types.Error).Resource)
+	}
+	if created.ID != "1" {
+		t.Errorf("CreateAddress: got %+v", created)
+	}
+}
+
+func TestConflict(t *testing.T) {
+	c, _, cleanup := newClient(t)
+	defer cleanup()
+
+	if _, err := c.CreateAddress(types.Address{Link: "eth0", IP: "192.168.32.11/24"}, false); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.CreateAddress(types.Address{Link: "eth1", IP: "192.168.32.11/24"}, false)
+	if code(t, err) != types.CodeConflict {
+		t.Fatalf("CreateAddress: got %v", err)
+	}
+}
+
+func TestHosts(t *testing.T) {
+	c, _, cleanup := newClient(t)
+	defer cleanup()
+
+	created, err := c.CreateHost(types.Host{IP: "10.0.0.2", Names: []string{"db"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetHost(types.Host{ID: "cache", IP: "10.0.0.3", Names: []string{"cache"}}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := c.ListHosts()
+	if err != nil || len(list) != 2 {
+		t.Errorf("ListHosts: got %+v, %v", list, err)
+	}
+	if err := c.DeleteHost(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteHost(created.ID); code(t, err) != types.CodeNotFound {
+		t.Errorf("DeleteHost: got %v", err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	c, _, cleanup := newClient(t)
+	defer cleanup()
+
+	for _, ip := range []string{"192.168.32.11/24", "192.168.32.12/24"} {
+		if _, err := c.CreateAddress(types.Address{Link: "eth0", IP: ip}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := c.ListAudit(nil)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("ListAudit: got %+v, %v", records, err)
+	}
+
+	// resumes after the first record
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var got []types.Record
+	err = c.Events(ctx, records[0].Seq, "addresses", func(r types.Record) error {
+		got = append(got, r)
+		cancel()
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("Events: got %v", err)
+	}
+	if len(got) != 1 || got[0].Seq != records[1].Seq {
+		t.Errorf("Events: got %+v, expecting %+v", got, records[1:])
+	}
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/guilhem/tentacool/types"
+)
+
+// Events calls fn with every change recorded by the daemon, until ctx is
+// done or fn fails. With a non-zero after, the records following that
+// sequence number are sent first, resuming a previous stream. The
+// stream ends with a nil error when the daemon drops a client lagging
+// behind, which resumes from the Seq of the last record received.
+func (c *Client) Events(ctx context.Context, after uint64, resource string, fn func(types.Record) error) error {
+	query := url.Values{}
+	if resource != "" {
+		query.Set("resource", resource)
+	}
+	req, err := c.request(ctx, http.MethodGet, "/events", query, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if after > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(after, 10))
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return decodeError(resp, nil)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		switch {
+		case bytes.HasPrefix(line, []byte("data:")):
+			data = append(data, bytes.TrimSpace(line[len("data:"):])...)
+		case len(line) == 0 && len(data) > 0:
+			record := types.Record{}
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+			data = nil
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,75 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/cli"
+)
+
+var addrCmd = &cobra.Command{
+	Use:   "addr",
+	Short: "Manage the addresses of a running server",
+}
+
+var addrListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List managed addresses",
+	Run:   cli.AddrList,
+}
+
+var addrAddCmd = &cobra.Command{
+	Use:   "add LINK CIDR | --pool POOL",
+	Short: "Add an address",
+	Run:   cli.AddrAdd,
+}
+
+var addrApplyCmd = &cobra.Command{
+	Use:   "apply ID...",
+	Short: "Add addresses to their link again",
+	Run:   cli.AddrApply,
+}
+
+var addrBatchCmd = &cobra.Command{
+	Use:   "batch FILE",
+	Short: "Create, update and delete addresses all together",
+	Long: `Run the operations of a JSON batch, '-' reading it from stdin:
+{"operations":[{"op":"create|update|delete","address":{...}}]}
+Nothing is changed when one of them fails.`,
+	Run: cli.AddrBatch,
+}
+
+var addrDelCmd = &cobra.Command{
+	Use:   "del ID...",
+	Short: "Remove addresses",
+	Run:   cli.AddrDel,
+}
+
+func init() {
+	RootCmd.AddCommand(addrCmd)
+	cli.AddFlags(addrCmd)
+	addrCmd.AddCommand(addrListCmd, addrAddCmd, addrApplyCmd, addrBatchCmd, addrDelCmd)
+
+	addrAddCmd.Flags().String("id", "", "ID of the address, allocated if empty")
+	addrAddCmd.Flags().Int("valid-lft", 0, "Valid lifetime in seconds, forever if 0")
+	addrAddCmd.Flags().Int("preferred-lft", 0, "Preferred lifetime in seconds, forever if 0")
+	addrAddCmd.Flags().String("label", "", "IPv4 label, like LINK:1")
+	addrAddCmd.Flags().String("broadcast", "", "IPv4 broadcast address")
+	addrAddCmd.Flags().String("peer", "", "Address of the other end of a point-to-point link")
+	addrAddCmd.Flags().StringSlice("flag", []string{}, "Flags: nodad, noprefixroute")
+	addrAddCmd.Flags().Bool("probe", false, "Check that no other host uses the IP first")
+	addrAddCmd.Flags().String("pool", "", "Pool to allocate the IP from")
+}
@@ -0,0 +1,38 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/web"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply -f FILE",
+	Short: "Apply a declarative configuration without server",
+	Long: `Apply the links, addresses, routes, DNS and DHCP described by a YAML
+file to the DB and the system, showing the changes first.
+Sections left out are kept as they are. The server must be stopped,
+for instance in an initramfs or a first-boot script.`,
+	Run: web.Apply,
+}
+
+func init() {
+	RootCmd.AddCommand(applyCmd)
+
+	applyCmd.Flags().StringP("file", "f", "", "YAML file to apply, '-' for stdin")
+	applyCmd.Flags().Bool("dry-run", false, "Only show the changes")
+}
@@ -0,0 +1,45 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/cli"
+)
+
+var dhcpCmd = &cobra.Command{
+	Use:   "dhcp",
+	Short: "Show the DHCP client of a running server",
+	Run:   cli.DHCP,
+}
+
+var dhcpEnableCmd = &cobra.Command{
+	Use:   "enable [LINK]",
+	Short: "Start the DHCP client, on eth0 by default",
+	Run:   cli.EnableDHCP,
+}
+
+var dhcpDisableCmd = &cobra.Command{
+	Use:   "disable [LINK]",
+	Short: "Stop the DHCP client, on eth0 by default",
+	Run:   cli.DisableDHCP,
+}
+
+func init() {
+	RootCmd.AddCommand(dhcpCmd)
+	cli.AddFlags(dhcpCmd)
+	dhcpCmd.AddCommand(dhcpEnableCmd, dhcpDisableCmd)
+}
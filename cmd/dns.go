@@ -0,0 +1,45 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/cli"
+)
+
+var dnsCmd = &cobra.Command{
+	Use:   "dns",
+	Short: "Show the resolver configuration of a running server",
+	Run:   cli.DNS,
+}
+
+var dnsSetCmd = &cobra.Command{
+	Use:   "set SERVER...",
+	Short: "Set the resolver configuration",
+	Run:   cli.SetDNS,
+}
+
+func init() {
+	RootCmd.AddCommand(dnsCmd)
+	cli.AddFlags(dnsCmd)
+	dnsCmd.AddCommand(dnsSetCmd)
+
+	dnsSetCmd.Flags().StringSlice("search", []string{}, "Search domains")
+	dnsSetCmd.Flags().Int("ndots", 1, "Dots in a name to be tried as absolute first")
+	dnsSetCmd.Flags().Int("timeout", 5, "Seconds before giving up on a server")
+	dnsSetCmd.Flags().Int("attempts", 2, "Attempts before giving up on a server")
+	dnsSetCmd.Flags().Bool("rotate", false, "Round robin among servers")
+}
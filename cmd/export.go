@@ -0,0 +1,38 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/web"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the configuration stored in DB",
+	Long: `Export the addresses, DHCP, DNS and routes stored in DB
+as a versioned JSON or YAML document, to be restored by import.
+The server must be stopped, GET /v1/backup does the same while running.`,
+	Run: web.Export,
+}
+
+func init() {
+	RootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringP("output", "o", "-", "File to write, '-' for stdout")
+	exportCmd.Flags().String("format", "", "json or yaml, from the extension of --output by default")
+}
@@ -0,0 +1,38 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/web"
+)
+
+var importIfupdownCmd = &cobra.Command{
+	Use:   "import-ifupdown [FILE]",
+	Short: "Take over the configuration of ifupdown",
+	Long: `Convert an ifupdown interfaces file, /etc/network/interfaces by default,
+to addresses, gateway, DNS, DHCP and links, report the directives tentacool
+can't take over, then apply the result like apply does.
+The server must be stopped.`,
+	Run: web.ImportIfupdown,
+}
+
+func init() {
+	RootCmd.AddCommand(importIfupdownCmd)
+
+	importIfupdownCmd.Flags().Bool("dry-run", false, "Only show the changes")
+	importIfupdownCmd.Flags().StringP("output", "o", "", "Write the file for apply instead of applying it")
+}
@@ -0,0 +1,62 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/cli"
+)
+
+var poolCmd = &cobra.Command{
+	Use:   "pool",
+	Short: "Manage the address pools of a running server",
+}
+
+var poolListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List address pools with their usage",
+	Run:   cli.PoolList,
+}
+
+var poolShowCmd = &cobra.Command{
+	Use:   "show ID...",
+	Short: "Show address pools with their usage",
+	Run:   cli.PoolShow,
+}
+
+var poolAddCmd = &cobra.Command{
+	Use:   "add LINK CIDR",
+	Short: "Add an address pool",
+	Long: `Add a range of IPs of a link, allocated by
+tentacool addr add --pool ID`,
+	Run: cli.PoolAdd,
+}
+
+var poolDelCmd = &cobra.Command{
+	Use:   "del ID...",
+	Short: "Remove address pools",
+	Run:   cli.PoolDel,
+}
+
+func init() {
+	RootCmd.AddCommand(poolCmd)
+	cli.AddFlags(poolCmd)
+	poolCmd.AddCommand(poolListCmd, poolShowCmd, poolAddCmd, poolDelCmd)
+
+	poolAddCmd.Flags().String("id", "", "ID of the pool, allocated if empty")
+	poolAddCmd.Flags().Int("prefix", 0, "Prefix length of the addresses, the one of CIDR if 0")
+	poolAddCmd.Flags().StringSlice("exclude", []string{}, "IPs never allocated, like the gateway")
+}
@@ -0,0 +1,37 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/cli"
+)
+
+var renderCmd = &cobra.Command{
+	Use:   "render FORMAT",
+	Short: "Render the configuration of a running server for another network manager",
+	Long: `Render the addresses, gateway, DNS and DHCP settings stored by a running
+server as ifupdown, netplan or networkd files, so the box still boots
+correctly without tentacool. The files are printed, or written under --root.`,
+	Run: cli.Render,
+}
+
+func init() {
+	RootCmd.AddCommand(renderCmd)
+	cli.AddFlags(renderCmd)
+
+	renderCmd.Flags().String("root", "", "Write the files under this directory, '/' to install them")
+}
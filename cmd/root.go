@@ -68,6 +68,15 @@ func init() {
 		log.WithError(err).Fatal("log-level")
 	}
 
+	RootCmd.PersistentFlags().String("db", "/var/lib/"+appName+"/db", "Path for DB")
+	viper.BindPFlag("db", RootCmd.PersistentFlags().Lookup("db"))
+
+	RootCmd.PersistentFlags().String("dns-backend", "auto", "DNS backend: auto, file, resolvconf, resolved or networkmanager")
+	viper.BindPFlag("dns-backend", RootCmd.PersistentFlags().Lookup("dns-backend"))
+
+	RootCmd.PersistentFlags().String("dns-link", "", "Link configured by per-link DNS backends (resolved), the one of the default route if empty")
+	viper.BindPFlag("dns-link", RootCmd.PersistentFlags().Lookup("dns-link"))
+
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.tentacool.yaml)")
 
 	RootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
@@ -0,0 +1,51 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/guilhem/tentacool/cli"
+)
+
+var routeCmd = &cobra.Command{
+	Use:   "route",
+	Short: "Manage the routes of a running server",
+}
+
+var routeListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the routing table",
+	Run:   cli.RouteList,
+}
+
+var routeGatewayCmd = &cobra.Command{
+	Use:   "gateway",
+	Short: "Show the default gateway",
+	Run:   cli.Gateway,
+}
+
+var routeGatewaySetCmd = &cobra.Command{
+	Use:   "set IP [LINK]",
+	Short: "Set the default gateway",
+	Run:   cli.SetGateway,
+}
+
+func init() {
+	RootCmd.AddCommand(routeCmd)
+	cli.AddFlags(routeCmd)
+	routeCmd.AddCommand(routeListCmd, routeGatewayCmd)
+	routeGatewayCmd.AddCommand(routeGatewaySetCmd)
+}
@@ -36,9 +36,6 @@ var serveCmd = &cobra.Command{
 func init() {
 	RootCmd.AddCommand(serveCmd)
 
-	serveCmd.Flags().String("setip", "", "CLI to set an IP without launching the Tentacool server ('ID:CIDR')")
-	viper.BindPFlag("setip", serveCmd.Flags().Lookup("setip"))
-
 	serveCmd.Flags().String("bind", "/var/run/"+appName, "Address to bind. Format Path or IP:PORT")
 	viper.BindPFlag("bind", serveCmd.Flags().Lookup("bind"))
 
@@ -48,8 +45,23 @@ func init() {
 	serveCmd.Flags().Int("group", -1, "Group for socket")
 	viper.BindPFlag("group", serveCmd.Flags().Lookup("group"))
 
-	serveCmd.Flags().String("db", "/var/lib/"+appName+"/db", "Path for DB")
-	viper.BindPFlag("db", serveCmd.Flags().Lookup("db"))
+	serveCmd.Flags().String("tls-cert", "", "TLS certificate served on a TCP bind")
+	viper.BindPFlag("tls-cert", serveCmd.Flags().Lookup("tls-cert"))
+
+	serveCmd.Flags().String("tls-key", "", "TLS private key served on a TCP bind")
+	viper.BindPFlag("tls-key", serveCmd.Flags().Lookup("tls-key"))
+
+	serveCmd.Flags().String("tls-client-ca", "", "CA bundle verifying client certificates on a TCP bind")
+	viper.BindPFlag("tls-client-ca", serveCmd.Flags().Lookup("tls-client-ca"))
+
+	serveCmd.Flags().Bool("insecure-tcp", false, "Serve a TCP bind without TLS, sending bearer tokens in clear")
+	viper.BindPFlag("insecure-tcp", serveCmd.Flags().Lookup("insecure-tcp"))
+
+	serveCmd.Flags().StringSlice("dns-forwarder", []string{}, "Addresses for the DNS forwarder to listen on (disabled if empty)")
+	viper.BindPFlag("dns-forwarder", serveCmd.Flags().Lookup("dns-forwarder"))
+
+	serveCmd.Flags().Int("dns-forwarder-cache", 1000, "Number of answers kept in the DNS forwarder cache")
+	viper.BindPFlag("dns-forwarder-cache", serveCmd.Flags().Lookup("dns-forwarder-cache"))
 
 	serveCmd.Flags().Bool("stdout", false, "Log in stdout for debug purposes")
 	viper.BindPFlag("stdout", serveCmd.Flags().Lookup("stdout"))
@@ -0,0 +1,354 @@
+// Package dbus is a minimal D-Bus client, enough to call methods of
+// system services such as systemd-resolved or NetworkManager.
+package dbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SystemBusPath is the default socket of the system bus
+	SystemBusPath = "/run/dbus/system_bus_socket"
+
+	// PropertiesInterface gives access to the properties of an object
+	PropertiesInterface = "org.freedesktop.DBus.Properties"
+
+	busName  = "org.freedesktop.DBus"
+	busPath  = ObjectPath("/org/freedesktop/DBus")
+	callWait = 5 * time.Second
+
+	// maxMessage and maxArray are the limits of the specification,
+	// messages over them are refused before being read
+	maxMessage = 1 << 27
+	maxArray   = 1 << 26
+
+	typeMethodCall   = 1
+	typeMethodReturn = 2
+	typeError        = 3
+
+	fieldPath        = 1
+	fieldInterface   = 2
+	fieldMember      = 3
+	fieldErrorName   = 4
+	fieldReplySerial = 5
+	fieldDestination = 6
+	fieldSignature   = 8
+)
+
+// Caller invokes methods of D-Bus objects. It is implemented by Conn,
+// and by fakes when testing code talking to services.
+type Caller interface {
+	Call(dest string, path ObjectPath, iface string, method string, sig string, args ...interface{}) ([]interface{}, error)
+}
+
+// Error is the error reply of a method call
+type Error struct {
+	Name string
+	Body []interface{}
+}
+
+func (e Error) Error() string {
+	if len(e.Body) > 0 {
+		if msg, ok := e.Body[0].(string); ok {
+			return e.Name + ": " + msg
+		}
+	}
+	return e.Name
+}
+
+// Conn is a connection to a message bus. It dials the bus again when
+// the connection breaks, like when the bus daemon restarts.
+type Conn struct {
+	sync.Mutex
+	path   string
+	conn   net.Conn
+	r      *bufio.Reader
+	serial uint32
+	closed bool
+}
+
+// SystemBus connects to the system bus, honoring DBUS_SYSTEM_BUS_ADDRESS
+func SystemBus() (*Conn, error) {
+	path := SystemBusPath
+	if addr := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"); addr != "" {
+		for _, part := range strings.Split(strings.TrimPrefix(addr, "unix:"), ",") {
+			if strings.HasPrefix(part, "path=") {
+				path = strings.TrimPrefix(part, "path=")
+			}
+		}
+	}
+	return Dial(path)
+}
+
+// Dial connects and authenticates to the bus listening on path
+func Dial(path string) (*Conn, error) {
+	c := &Conn{path: path}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// connect dials the bus and says hello
+func (c *Conn) connect() error {
+	conn, err := net.DialTimeout("unix", c.path, callWait)
+	if err != nil {
+		return err
+	}
+	c.conn, c.r = conn, bufio.NewReader(conn)
+	if err := c.auth(); err != nil {
+		c.drop()
+		return err
+	}
+	if _, _, err := c.call(busName, busPath, busName, "Hello", ""); err != nil {
+		c.drop()
+		return err
+	}
+	return nil
+}
+
+// drop closes a broken connection, the next call dialing again
+func (c *Conn) drop() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn, c.r = nil, nil
+	}
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	c.Lock()
+	defer c.Unlock()
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn, c.r = nil, nil
+	return err
+}
+
+// auth uses the EXTERNAL mechanism, relying on the credentials of the socket
+func (c *Conn) auth() error {
+	c.conn.SetDeadline(time.Now().Add(callWait))
+	defer c.conn.SetDeadline(time.Time{})
+
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := c.conn.Write([]byte("\x00AUTH EXTERNAL " + uid + "\r\n")); err != nil {
+		return err
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("dbus: authentication refused: %s", strings.TrimSpace(line))
+	}
+	_, err = c.conn.Write([]byte("BEGIN\r\n"))
+	return err
+}
+
+// Call invokes method and waits for its reply. A call failing on a
+// broken connection is made again once on a new one.
+func (c *Conn) Call(dest string, path ObjectPath, iface string, method string, sig string, args ...interface{}) ([]interface{}, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, errors.New("dbus: connection closed")
+	}
+
+	for retry := true; ; retry = false {
+		if c.conn == nil {
+			if err := c.connect(); err != nil {
+				return nil, err
+			}
+		}
+		reply, broken, err := c.call(dest, path, iface, method, sig, args...)
+		if !broken {
+			return reply, err
+		}
+		c.drop()
+		if !retry {
+			return nil, err
+		}
+	}
+}
+
+// call sends a method call and waits for its reply, broken telling
+// that the connection can't be used anymore
+func (c *Conn) call(dest string, path ObjectPath, iface string, method string, sig string, args ...interface{}) (reply []interface{}, broken bool, err error) {
+	c.serial++
+	serial := c.serial
+
+	fields := []interface{}{
+		[]interface{}{byte(fieldPath), Variant{"o", path}},
+		[]interface{}{byte(fieldMember), Variant{"s", method}},
+		[]interface{}{byte(fieldDestination), Variant{"s", dest}},
+	}
+	if iface != "" {
+		fields = append(fields, []interface{}{byte(fieldInterface), Variant{"s", iface}})
+	}
+	msg, err := encodeMessage(typeMethodCall, serial, fields, sig, args)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.conn.SetDeadline(time.Now().Add(callWait))
+	defer c.conn.SetDeadline(time.Time{})
+	if _, err := c.conn.Write(msg); err != nil {
+		return nil, true, err
+	}
+
+	for {
+		m, err := c.readMessage()
+		if err != nil {
+			return nil, true, err
+		}
+		if m.replySerial != serial {
+			// signals and unrelated replies are dropped
+			continue
+		}
+		switch m.typ {
+		case typeMethodReturn:
+			return m.body, false, nil
+		case typeError:
+			return nil, false, Error{Name: m.errorName, Body: m.body}
+		}
+	}
+}
+
+// encodeMessage returns a message with the header fields, its
+// signature field being added for a body
+func encodeMessage(typ byte, serial uint32, fields []interface{}, sig string, args []interface{}) ([]byte, error) {
+	body := &encoder{order: binary.LittleEndian}
+	if err := body.encodeAll(sig, args); err != nil {
+		return nil, err
+	}
+	if sig != "" {
+		fields = append(fields, []interface{}{byte(fieldSignature), Variant{"g", sig}})
+	}
+
+	msg := &encoder{order: binary.LittleEndian, buf: []byte{'l', typ, 0, 1}}
+	msg.uint32(uint32(len(body.buf)))
+	msg.uint32(serial)
+	if err := msg.encode("a(yv)", fields); err != nil {
+		return nil, err
+	}
+	msg.align(8)
+	return append(msg.buf, body.buf...), nil
+}
+
+type message struct {
+	typ         byte
+	serial      uint32
+	replySerial uint32
+	errorName   string
+	body        []interface{}
+}
+
+func (c *Conn) readMessage() (*message, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(c.r, fixed); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("dbus: invalid endianness")
+	}
+	bodyLen, fieldsLen := uint64(order.Uint32(fixed[4:])), uint64(order.Uint32(fixed[12:]))
+	if fieldsLen > maxArray || 16+fieldsLen+bodyLen > maxMessage {
+		return nil, fmt.Errorf("dbus: message of %d bytes too long", 16+fieldsLen+bodyLen)
+	}
+	headerLen := 16 + int(fieldsLen)
+	if pad := headerLen % 8; pad != 0 {
+		headerLen += 8 - pad
+	}
+	rest := make([]byte, headerLen-16+int(bodyLen))
+	if _, err := io.ReadFull(c.r, rest); err != nil {
+		return nil, err
+	}
+	header := append(fixed, rest[:headerLen-16]...)
+
+	msg := &message{typ: fixed[1], serial: order.Uint32(fixed[8:])}
+	d := &decoder{buf: header, pos: 12, order: order}
+	f, err := d.decode("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+	sig := ""
+	fields, _ := f.([]interface{})
+	for _, field := range fields {
+		field, ok := field.([]interface{})
+		if !ok || len(field) != 2 {
+			return nil, errors.New("dbus: invalid header field")
+		}
+		code, _ := field[0].(byte)
+		variant, _ := field[1].(Variant)
+		v := variant.Value
+		switch code {
+		case fieldReplySerial:
+			msg.replySerial, _ = v.(uint32)
+		case fieldErrorName:
+			msg.errorName, _ = v.(string)
+		case fieldSignature:
+			s, _ := v.(Signature)
+			sig = string(s)
+		}
+	}
+
+	if sig != "" {
+		d = &decoder{buf: rest[headerLen-16:], order: order}
+		if msg.body, err = d.decodeAll(sig); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// NameHasOwner tells if a service currently owns name on the bus
+func NameHasOwner(bus Caller, name string) bool {
+	reply, err := bus.Call(busName, busPath, busName, "NameHasOwner", "s", name)
+	if err != nil || len(reply) == 0 {
+		return false
+	}
+	owned, _ := reply[0].(bool)
+	return owned
+}
+
+// GetProperty returns the value of a property of an object
+func GetProperty(bus Caller, dest string, path ObjectPath, iface string, property string) (interface{}, error) {
+	reply, err := bus.Call(dest, path, PropertiesInterface, "Get", "ss", iface, property)
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) == 0 {
+		return nil, errors.New("dbus: empty reply")
+	}
+	v, ok := reply[0].(Variant)
+	if !ok {
+		return nil, fmt.Errorf("dbus: unexpected reply %v", reply)
+	}
+	return v.Value, nil
+}
+
+// SetProperty sets the value of a property of an object
+func SetProperty(bus Caller, dest string, path ObjectPath, iface string, property string, value Variant) error {
+	_, err := bus.Call(dest, path, PropertiesInterface, "Set", "ssv", iface, property, value)
+	return err
+}
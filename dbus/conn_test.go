@@ -0,0 +1,186 @@
+package dbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// bus is a message bus answering every call with a string, after
+// authenticating its clients
+type bus struct {
+	sync.Mutex
+	ln net.Listener
+	// conns counts the connections accepted
+	conns int
+	// serve answers a call on a connection, returning false to close it
+	serve func(conn net.Conn, call *message) bool
+}
+
+func newBus(t *testing.T) (*bus, string, func()) {
+	dir, err := ioutil.TempDir("", "tentacool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "bus")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	b := &bus{ln: ln, serve: func(conn net.Conn, call *message) bool {
+		return reply(conn, call, "pong") == nil
+	}}
+	go b.accept()
+	return b, path, func() {
+		ln.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func (b *bus) accept() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		b.Lock()
+		b.conns++
+		b.Unlock()
+		go b.handle(conn)
+	}
+}
+
+func (b *bus) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if line, err := r.ReadString('\n'); err != nil || !strings.HasPrefix(line, "\x00AUTH EXTERNAL ") {
+		return
+	}
+	conn.Write([]byte("OK 0123456789abcdef\r\n"))
+	if line, err := r.ReadString('\n'); err != nil || line != "BEGIN\r\n" {
+		return
+	}
+	c := &Conn{conn: conn, r: r}
+	hello := true
+	for {
+		call, err := c.readMessage()
+		if err != nil {
+			return
+		}
+		if hello {
+			hello = false
+			if reply(conn, call, ":1.1") != nil {
+				return
+			}
+			continue
+		}
+		b.Lock()
+		serve := b.serve
+		b.Unlock()
+		if !serve(conn, call) {
+			return
+		}
+	}
+}
+
+// reply answers call with a string
+func reply(conn net.Conn, call *message, s string) error {
+	fields := []interface{}{[]interface{}{byte(fieldReplySerial), Variant{"u", call.serial}}}
+	msg, err := encodeMessage(typeMethodReturn, 1, fields, "s", []interface{}{s})
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(msg)
+	return err
+}
+
+func TestCall(t *testing.T) {
+	_, path, cleanup := newBus(t)
+	defer cleanup()
+
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	reply, err := c.Call("org.example", "/org/example", "org.example.Test", "Ping", "")
+	if err != nil || len(reply) != 1 || reply[0] != "pong" {
+		t.Errorf("got %v, %v", reply, err)
+	}
+
+	c.Close()
+	if _, err := c.Call("org.example", "/org/example", "org.example.Test", "Ping", ""); err == nil {
+		t.Errorf("expecting an error once closed")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	b, path, cleanup := newBus(t)
+	defer cleanup()
+
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// the daemon restarting, every connection is closed after a call
+	b.Lock()
+	b.serve = func(conn net.Conn, call *message) bool {
+		reply(conn, call, "pong")
+		return false
+	}
+	b.Unlock()
+	for i := 0; i < 3; i++ {
+		reply, err := c.Call("org.example", "/org/example", "org.example.Test", "Ping", "")
+		if err != nil || len(reply) != 1 || reply[0] != "pong" {
+			t.Fatalf("call %d: got %v, %v", i, reply, err)
+		}
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.conns != 3 {
+		t.Errorf("got %d connections, expecting 3", b.conns)
+	}
+}
+
+func TestTooLong(t *testing.T) {
+	b, path, cleanup := newBus(t)
+	defer cleanup()
+
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// a reply announcing a body of 4GiB
+	b.Lock()
+	b.serve = func(conn net.Conn, call *message) bool {
+		fixed := []byte{'l', typeMethodReturn, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(fixed[4:], 0xffffffff)
+		conn.Write(fixed)
+		return true
+	}
+	b.Unlock()
+	if _, err := c.Call("org.example", "/org/example", "org.example.Test", "Ping", ""); err == nil || !strings.Contains(err.Error(), "too long") {
+		t.Errorf("got %v, expecting a message too long", err)
+	}
+
+	// the next call uses a new connection
+	b.Lock()
+	b.serve = func(conn net.Conn, call *message) bool {
+		return reply(conn, call, "pong") == nil
+	}
+	b.Unlock()
+	if reply, err := c.Call("org.example", "/org/example", "org.example.Test", "Ping", ""); err != nil || reply[0] != "pong" {
+		t.Errorf("got %v, %v", reply, err)
+	}
+}
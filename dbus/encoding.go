@@ -0,0 +1,462 @@
+package dbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// ObjectPath is a D-Bus object path
+type ObjectPath string
+
+// Signature is a D-Bus type signature
+type Signature string
+
+// Variant is a value along with its signature
+type Variant struct {
+	Sig   Signature
+	Value interface{}
+}
+
+var errShort = errors.New("dbus: message too short")
+
+// nextType splits the first complete type of sig
+func nextType(sig string) (string, error) {
+	if sig == "" {
+		return "", errors.New("dbus: empty signature")
+	}
+	switch sig[0] {
+	case 'a':
+		t, err := nextType(sig[1:])
+		if err != nil {
+			return "", err
+		}
+		return "a" + t, nil
+	case '(', '{':
+		closing := byte(')')
+		if sig[0] == '{' {
+			closing = '}'
+		}
+		i := 1
+		for i < len(sig) && sig[i] != closing {
+			t, err := nextType(sig[i:])
+			if err != nil {
+				return "", err
+			}
+			i += len(t)
+		}
+		if i >= len(sig) {
+			return "", fmt.Errorf("dbus: unbalanced signature %s", sig)
+		}
+		return sig[:i+1], nil
+	case 'y', 'b', 'n', 'q', 'i', 'u', 'x', 't', 'd', 's', 'o', 'g', 'v', 'h':
+		return sig[:1], nil
+	}
+	return "", fmt.Errorf("dbus: unsupported signature %s", sig)
+}
+
+// splitTypes splits sig in complete types
+func splitTypes(sig string) (types []string, err error) {
+	for sig != "" {
+		t, err := nextType(sig)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+		sig = sig[len(t):]
+	}
+	return
+}
+
+func alignment(sig string) int {
+	switch sig[0] {
+	case 'y', 'g', 'v':
+		return 1
+	case 'n', 'q':
+		return 2
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+	return 4
+}
+
+type encoder struct {
+	buf   []byte
+	order binary.ByteOrder
+}
+
+func (e *encoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	b := make([]byte, 4)
+	e.order.PutUint32(b, v)
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) encodeAll(sig string, args []interface{}) error {
+	types, err := splitTypes(sig)
+	if err != nil {
+		return err
+	}
+	if len(types) != len(args) {
+		return fmt.Errorf("dbus: signature %s does not match %d arguments", sig, len(args))
+	}
+	for i, t := range types {
+		if err := e.encode(t, args[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encode writes v as the single complete type sig
+func (e *encoder) encode(sig string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	switch sig[0] {
+	case 'y':
+		n, err := toUint(rv)
+		if err != nil {
+			return err
+		}
+		e.buf = append(e.buf, byte(n))
+	case 'b':
+		if rv.Kind() != reflect.Bool {
+			return fmt.Errorf("dbus: %T is not a boolean", v)
+		}
+		b := uint32(0)
+		if rv.Bool() {
+			b = 1
+		}
+		e.uint32(b)
+	case 'n', 'q':
+		n, err := toUint(rv)
+		if err != nil {
+			return err
+		}
+		e.align(2)
+		b := make([]byte, 2)
+		e.order.PutUint16(b, uint16(n))
+		e.buf = append(e.buf, b...)
+	case 'i', 'u', 'h':
+		n, err := toUint(rv)
+		if err != nil {
+			return err
+		}
+		e.uint32(uint32(n))
+	case 'x', 't', 'd':
+		var n uint64
+		if sig[0] == 'd' {
+			if rv.Kind() != reflect.Float64 && rv.Kind() != reflect.Float32 {
+				return fmt.Errorf("dbus: %T is not a float", v)
+			}
+			n = math.Float64bits(rv.Float())
+		} else {
+			var err error
+			if n, err = toUint(rv); err != nil {
+				return err
+			}
+		}
+		e.align(8)
+		b := make([]byte, 8)
+		e.order.PutUint64(b, n)
+		e.buf = append(e.buf, b...)
+	case 's', 'o':
+		if rv.Kind() != reflect.String {
+			return fmt.Errorf("dbus: %T is not a string", v)
+		}
+		e.uint32(uint32(rv.Len()))
+		e.buf = append(e.buf, rv.String()...)
+		e.buf = append(e.buf, 0)
+	case 'g':
+		if rv.Kind() != reflect.String {
+			return fmt.Errorf("dbus: %T is not a signature", v)
+		}
+		e.buf = append(e.buf, byte(rv.Len()))
+		e.buf = append(e.buf, rv.String()...)
+		e.buf = append(e.buf, 0)
+	case 'v':
+		variant, ok := v.(Variant)
+		if !ok {
+			return fmt.Errorf("dbus: %T is not a variant", v)
+		}
+		if _, err := nextType(string(variant.Sig)); err != nil {
+			return err
+		}
+		if err := e.encode("g", string(variant.Sig)); err != nil {
+			return err
+		}
+		return e.encode(string(variant.Sig), variant.Value)
+	case 'a':
+		return e.encodeArray(sig, rv)
+	case '(':
+		fields, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("dbus: %T is not a struct", v)
+		}
+		e.align(8)
+		return e.encodeAll(sig[1:len(sig)-1], fields)
+	default:
+		return fmt.Errorf("dbus: unsupported signature %s", sig)
+	}
+	return nil
+}
+
+func (e *encoder) encodeArray(sig string, rv reflect.Value) error {
+	elem := sig[1:]
+	e.uint32(0)
+	lenPos := len(e.buf) - 4
+	e.align(alignment(elem))
+	start := len(e.buf)
+
+	if elem[0] == '{' {
+		if rv.Kind() != reflect.Map {
+			return fmt.Errorf("dbus: %s is not a map", rv.Type())
+		}
+		types, err := splitTypes(elem[1 : len(elem)-1])
+		if err != nil {
+			return err
+		}
+		if len(types) != 2 {
+			return fmt.Errorf("dbus: invalid dict entry %s", elem)
+		}
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, k := range keys {
+			e.align(8)
+			if err := e.encode(types[0], k.Interface()); err != nil {
+				return err
+			}
+			if err := e.encode(types[1], rv.MapIndex(k).Interface()); err != nil {
+				return err
+			}
+		}
+	} else {
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return fmt.Errorf("dbus: %s is not a slice", rv.Type())
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := e.encode(elem, rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+	}
+	e.order.PutUint32(e.buf[lenPos:], uint32(len(e.buf)-start))
+	return nil
+}
+
+func toUint(rv reflect.Value) (uint64, error) {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), nil
+	}
+	return 0, fmt.Errorf("dbus: %s is not an integer", rv.Kind())
+}
+
+type decoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+func (d *decoder) align(n int) error {
+	for d.pos%n != 0 {
+		d.pos++
+	}
+	if d.pos > len(d.buf) {
+		return errShort
+	}
+	return nil
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if d.pos+n > len(d.buf) {
+		return nil, errShort
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	if err := d.align(4); err != nil {
+		return 0, err
+	}
+	b, err := d.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint32(b), nil
+}
+
+func (d *decoder) decodeAll(sig string) (values []interface{}, err error) {
+	types, err := splitTypes(sig)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range types {
+		v, err := d.decode(t)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return
+}
+
+// decode reads the single complete type sig.
+// Arrays are returned as []interface{} ([]byte for ay), dicts as
+// map[string]interface{} and structs as []interface{}.
+func (d *decoder) decode(sig string) (interface{}, error) {
+	switch sig[0] {
+	case 'y':
+		b, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b':
+		n, err := d.uint32()
+		return n != 0, err
+	case 'n', 'q':
+		if err := d.align(2); err != nil {
+			return nil, err
+		}
+		b, err := d.read(2)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'n' {
+			return int16(d.order.Uint16(b)), nil
+		}
+		return d.order.Uint16(b), nil
+	case 'i':
+		n, err := d.uint32()
+		return int32(n), err
+	case 'u', 'h':
+		return d.uint32()
+	case 'x', 't', 'd':
+		if err := d.align(8); err != nil {
+			return nil, err
+		}
+		b, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		n := d.order.Uint64(b)
+		switch sig[0] {
+		case 'x':
+			return int64(n), nil
+		case 'd':
+			return math.Float64frombits(n), nil
+		}
+		return n, nil
+	case 's', 'o':
+		n, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.read(int(n) + 1)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'o' {
+			return ObjectPath(b[:n]), nil
+		}
+		return string(b[:n]), nil
+	case 'g':
+		l, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.read(int(l[0]) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Signature(b[:l[0]]), nil
+	case 'v':
+		s, err := d.decode("g")
+		if err != nil {
+			return nil, err
+		}
+		sig := string(s.(Signature))
+		if _, err := nextType(sig); err != nil {
+			return nil, err
+		}
+		v, err := d.decode(sig)
+		return Variant{Sig: Signature(sig), Value: v}, err
+	case 'a':
+		return d.decodeArray(sig)
+	case '(':
+		if err := d.align(8); err != nil {
+			return nil, err
+		}
+		return d.decodeAll(sig[1 : len(sig)-1])
+	}
+	return nil, fmt.Errorf("dbus: unsupported signature %s", sig)
+}
+
+func (d *decoder) decodeArray(sig string) (interface{}, error) {
+	elem := sig[1:]
+	n, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.align(alignment(elem)); err != nil {
+		return nil, err
+	}
+	end := d.pos + int(n)
+	if end > len(d.buf) {
+		return nil, errShort
+	}
+
+	if elem == "y" {
+		b, err := d.read(int(n))
+		return append([]byte{}, b...), err
+	}
+	if elem[0] == '{' {
+		types, err := splitTypes(elem[1 : len(elem)-1])
+		if err != nil {
+			return nil, err
+		}
+		if len(types) != 2 {
+			return nil, fmt.Errorf("dbus: invalid dict entry %s", elem)
+		}
+		m := map[string]interface{}{}
+		for d.pos < end {
+			if err := d.align(8); err != nil {
+				return nil, err
+			}
+			k, err := d.decode(types[0])
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decode(types[1])
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = v
+		}
+		return m, nil
+	}
+	values := []interface{}{}
+	for d.pos < end {
+		v, err := d.decode(elem)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
@@ -0,0 +1,57 @@
+package dbus
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		sig  string
+		in   []interface{}
+		want []interface{}
+	}{
+		{"ybnqiuxtd", []interface{}{byte(1), true, int16(-2), uint16(3), int32(-4), uint32(5), int64(-6), uint64(7), 0.5},
+			[]interface{}{byte(1), true, int16(-2), uint16(3), int32(-4), uint32(5), int64(-6), uint64(7), 0.5}},
+		{"sog", []interface{}{"eth0", ObjectPath("/org/freedesktop/resolve1"), "a{sv}"},
+			[]interface{}{"eth0", ObjectPath("/org/freedesktop/resolve1"), Signature("a{sv}")}},
+		{"ayas", []interface{}{[]byte{10, 0, 0, 1}, []string{"a", "b"}},
+			[]interface{}{[]byte{10, 0, 0, 1}, []interface{}{"a", "b"}}},
+		// SetLinkDNS
+		{"ia(iay)", []interface{}{int32(2), []interface{}{[]interface{}{int32(2), []byte{10, 0, 0, 1}}}},
+			[]interface{}{int32(2), []interface{}{[]interface{}{int32(2), []byte{10, 0, 0, 1}}}}},
+		{"a{sv}", []interface{}{map[string]interface{}{"searches": Variant{"as", []string{"example.com"}}}},
+			[]interface{}{map[string]interface{}{"searches": Variant{"as", []interface{}{"example.com"}}}}},
+		{"v", []interface{}{Variant{"(sb)", []interface{}{"example.com", false}}},
+			[]interface{}{Variant{"(sb)", []interface{}{"example.com", false}}}},
+		{"as", []interface{}{[]string{}}, []interface{}{[]interface{}{}}},
+	}
+	for _, test := range tests {
+		got, err := roundTrip(test.sig, test.in)
+		if err != nil {
+			t.Errorf("%s: %s", test.sig, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %#v, expecting %#v", test.sig, got, test.want)
+		}
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	tests := []struct {
+		sig string
+		in  []interface{}
+	}{
+		{"s", []interface{}{1}},
+		{"b", []interface{}{"true"}},
+		{"v", []interface{}{"not a variant"}},
+		{"ss", []interface{}{"one"}},
+		{"a{sv", []interface{}{map[string]interface{}{}}},
+	}
+	for _, test := range tests {
+		if _, err := roundTrip(test.sig, test.in); err == nil {
+			t.Errorf("%s %v: expecting an error", test.sig, test.in)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package dbus
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// FakeBus answers method calls in memory instead of a message bus, for
+// tests. Arguments and replies go through the wire encoding, so both
+// sides see the values as they would be decoded from the bus.
+type FakeBus struct {
+	sync.Mutex
+	// Properties holds the properties read and set through
+	// PropertiesInterface, by "interface.property"
+	Properties map[string]Variant
+	// Owners are the names owned on the bus
+	Owners map[string]bool
+	// Calls holds the arguments of the last call of other methods,
+	// by "interface.method"
+	Calls map[string][]interface{}
+	// Err is returned by every call when set
+	Err error
+}
+
+// NewFakeBus returns an empty FakeBus
+func NewFakeBus() *FakeBus {
+	return &FakeBus{
+		Properties: map[string]Variant{},
+		Owners:     map[string]bool{},
+		Calls:      map[string][]interface{}{},
+	}
+}
+
+// roundTrip encodes values as sig and decodes them back
+func roundTrip(sig string, values []interface{}) ([]interface{}, error) {
+	e := &encoder{order: binary.LittleEndian}
+	if err := e.encodeAll(sig, values); err != nil {
+		return nil, err
+	}
+	d := &decoder{buf: e.buf, order: binary.LittleEndian}
+	return d.decodeAll(sig)
+}
+
+// Call records the call, answering the properties and bus methods
+func (f *FakeBus) Call(dest string, path ObjectPath, iface string, method string, sig string, args ...interface{}) ([]interface{}, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	args, err := roundTrip(sig, args)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case iface == PropertiesInterface && method == "Get":
+		v, ok := f.Properties[args[0].(string)+"."+args[1].(string)]
+		if !ok {
+			return nil, Error{Name: "org.freedesktop.DBus.Error.UnknownProperty"}
+		}
+		return roundTrip("v", []interface{}{v})
+	case iface == PropertiesInterface && method == "Set":
+		f.Properties[args[0].(string)+"."+args[1].(string)] = args[2].(Variant)
+		return nil, nil
+	case iface == busName && method == "NameHasOwner":
+		return roundTrip("b", []interface{}{f.Owners[args[0].(string)]})
+	}
+	f.Calls[iface+"."+method] = args
+	return nil, nil
+}
@@ -0,0 +1,24 @@
+// Package dbutil holds helpers shared by the handlers storing their
+// resources in bolt buckets
+package dbutil
+
+import (
+	"strconv"
+
+	"github.com/boltdb/bolt"
+)
+
+// NextID returns a new integer ID of the bucket, skipping the ones
+// of entries restored or imported after the sequence passed them
+func NextID(b *bolt.Bucket) (string, error) {
+	for {
+		seq, err := b.NextSequence()
+		if err != nil {
+			return "", err
+		}
+		id := strconv.FormatUint(seq, 10)
+		if b.Get([]byte(id)) == nil {
+			return id, nil
+		}
+	}
+}
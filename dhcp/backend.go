@@ -0,0 +1,30 @@
+package dhcp
+
+import (
+	"os/exec"
+)
+
+// Backend runs the DHCP client of the system
+type Backend interface {
+	Start(iface string) error
+	Stop(iface string) error
+}
+
+// DhclientBackend drives ISC dhclient
+type DhclientBackend struct{}
+
+// Start launches dhclient in background on iface
+func (DhclientBackend) Start(iface string) error {
+	cmd := exec.Command("/sbin/dhclient", iface)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// reaped once it daemonizes
+	go cmd.Wait()
+	return nil
+}
+
+// Stop releases the lease and stops dhclient
+func (DhclientBackend) Stop(iface string) error {
+	return exec.Command("/sbin/dhclient", "-x").Run()
+}
@@ -2,20 +2,21 @@ package dhcp
 
 import (
 	"encoding/json"
-	"fmt"
-	"net/http"
-	"os/exec"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/boltdb/bolt"
+
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/types"
 )
 
-type dhcpStruct struct {
-	Active    bool   `json:"active"`
-	Interface string `json:"interface"`
-}
+type dhcpStruct = types.DHCP
+
+// Config is the state of the DHCP client
+type Config = dhcpStruct
 
 const (
 	defaultIface = "eth0"
@@ -23,12 +24,25 @@ const (
 	activeKey    = "active"
 )
 
-var db *bolt.DB
+// validLink tells whether name may be the name of a network interface,
+// as checked by the kernel, and is not taken for an option of dhclient
+func validLink(name string) bool {
+	if name == "" || len(name) > 15 || name == "." || name == ".." || name[0] == '-' {
+		return false
+	}
+	return !strings.ContainsAny(name, "/: \t\n\v\f\r")
+}
+
+// Handler serves the DHCP API
+type Handler struct {
+	DB      *bolt.DB
+	Backend Backend
+}
 
 // GetDhcp returns the current status of the DHCP client
-func GetDhcp(w rest.ResponseWriter, req *rest.Request) {
+func (h *Handler) GetDhcp(w rest.ResponseWriter, req *rest.Request) {
 	dhcp := dhcpStruct{}
-	err := db.View(func(tx *bolt.Tx) (err error) {
+	err := h.DB.View(func(tx *bolt.Tx) (err error) {
 		tmp := tx.Bucket([]byte(dhcpBucket)).Get([]byte(activeKey))
 		if tmp != nil {
 			err = json.Unmarshal(tmp, &dhcp)
@@ -39,8 +53,7 @@ func GetDhcp(w rest.ResponseWriter, req *rest.Request) {
 		return
 	})
 	if err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, err)
 		return
 	}
 	log.Printf("GetDhcp requested: %v", dhcp)
@@ -48,28 +61,23 @@ func GetDhcp(w rest.ResponseWriter, req *rest.Request) {
 }
 
 // PostDhcp set or unset the DHCP client via RESTful request
-func PostDhcp(w rest.ResponseWriter, req *rest.Request) {
+func (h *Handler) PostDhcp(w rest.ResponseWriter, req *rest.Request) {
 	// Parameters
 	dhcp := dhcpStruct{}
 	if err := req.DecodeJsonPayload(&dhcp); err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusBadRequest)
+		apierror.Write(w, apierror.BadRequest(err))
 		return
 	}
 	if dhcp.Interface == "" {
 		dhcp.Interface = defaultIface
-		return
 	}
-
-	// Activate/deactivate dhcp client
-	if err := SetDhcp(dhcp.Active, dhcp.Interface); err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+	if !validLink(dhcp.Interface) {
+		apierror.Write(w, apierror.Invalid("interface", "Invalid interface name %q", dhcp.Interface))
 		return
 	}
 
 	// Update DB
-	err := db.Update(func(tx *bolt.Tx) (err error) {
+	err := h.DB.Update(func(tx *bolt.Tx) (err error) {
 		b := tx.Bucket([]byte(dhcpBucket))
 		data, err := json.Marshal(dhcp)
 		if err != nil {
@@ -79,35 +87,61 @@ func PostDhcp(w rest.ResponseWriter, req *rest.Request) {
 		return
 	})
 	if err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	// Activate/deactivate dhcp client
+	if err := h.SetDhcp(dhcp.Active, dhcp.Interface); err != nil {
+		apierror.NotApplied(w, dhcp, err)
+		return
+	}
 	w.WriteJson(dhcp)
 }
 
-// SetDhcp set or unset the DHCP client (using system)
-func SetDhcp(active bool, iface string) (err error) {
+// SetDhcp set or unset the DHCP client
+func (h *Handler) SetDhcp(active bool, iface string) (err error) {
+	// imports and rollbacks come here unchecked
+	if !validLink(iface) {
+		return apierror.Invalid("interface", "Invalid interface name %q", iface)
+	}
 	if active {
 		log.Printf("Starting DHCP client")
-		err = exec.Command("sh", "-c", fmt.Sprintf("/sbin/dhclient %s &", iface)).Run()
+		err = h.Backend.Start(iface)
 	} else {
 		log.Printf("Stopping DHCP client")
-		err = exec.Command("sh", "-c", "/sbin/dhclient -x").Run()
+		err = h.Backend.Stop(iface)
 	}
 	if err != nil {
-		log.Printf(err.Error())
+		log.Print(err)
 		return err
 	}
 	return nil
 }
 
+// Restore applies to the system the change of the DHCP bucket
+// from one content to another, the database already holding the latter
+func (h *Handler) Restore(from, to map[string][]byte) (err error) {
+	dhcp := dhcpStruct{}
+	if v, ok := to[activeKey]; ok {
+		if err = json.Unmarshal(v, &dhcp); err != nil {
+			return
+		}
+	} else if v, ok := from[activeKey]; ok {
+		// no longer managed, stop the client we started
+		if err = json.Unmarshal(v, &dhcp); err != nil {
+			return
+		}
+		dhcp.Active = false
+	} else {
+		return
+	}
+	return h.SetDhcp(dhcp.Active, dhcp.Interface)
+}
+
 // DBinit initializes the DHCP database at startup
-func DBinit(d *bolt.DB) (err error) {
-	db = d
-	err = db.Update(func(tx *bolt.Tx) (err error) {
+func (h *Handler) DBinit() (err error) {
+	err = h.DB.Update(func(tx *bolt.Tx) (err error) {
 		_, err = tx.CreateBucketIfNotExists([]byte(dhcpBucket))
 		return
 	})
@@ -115,7 +149,7 @@ func DBinit(d *bolt.DB) (err error) {
 		return err
 	}
 
-	err = db.View(func(tx *bolt.Tx) (err error) {
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
 		b := tx.Bucket([]byte(dhcpBucket))
 
 		log.Printf("Restore DHCP from DB")
@@ -123,9 +157,9 @@ func DBinit(d *bolt.DB) (err error) {
 		tmp := b.Get([]byte(activeKey))
 		if tmp != nil {
 			if err := json.Unmarshal(tmp, &dhcp); err != nil {
-				log.Printf(err.Error())
-			} else if err := SetDhcp(dhcp.Active, dhcp.Interface); err != nil {
-				log.Printf(err.Error())
+				log.Print(err)
+			} else if err := h.SetDhcp(dhcp.Active, dhcp.Interface); err != nil {
+				log.Print(err)
 			}
 		}
 		return
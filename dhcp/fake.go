@@ -0,0 +1,38 @@
+package dhcp
+
+import (
+	"sync"
+)
+
+// FakeBackend records the state of DHCP clients, for tests
+type FakeBackend struct {
+	sync.Mutex
+	Running map[string]bool
+	// Err is returned by every operation when set
+	Err error
+}
+
+// NewFakeBackend returns a FakeBackend without running client
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{Running: map[string]bool{}}
+}
+
+// Start marks the client of iface as running
+func (f *FakeBackend) Start(iface string) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err == nil {
+		f.Running[iface] = true
+	}
+	return f.Err
+}
+
+// Stop marks the client of iface as stopped
+func (f *FakeBackend) Stop(iface string) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err == nil {
+		delete(f.Running, iface)
+	}
+	return f.Err
+}
@@ -0,0 +1,114 @@
+package dns
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/guilhem/dnsconfig"
+	"github.com/guilhem/dnsconfig/resolvconf"
+
+	"github.com/guilhem/tentacool/dbus"
+)
+
+// stubResolver is the address systemd-resolved listens on
+const stubResolver = "127.0.0.53"
+
+// Backend reads and applies the DNS configuration of the system
+type Backend interface {
+	Name() string
+	Read() (*dnsconfig.DnsConfig, error)
+	Write(*dnsconfig.DnsConfig) error
+}
+
+// fileBackend writes a resolv.conf formatted file
+type fileBackend struct {
+	name string
+	path string
+}
+
+func (b fileBackend) Name() string {
+	return b.name
+}
+
+func (b fileBackend) Read() (*dnsconfig.DnsConfig, error) {
+	return dnsconfig.DnsReadConfig(b.path)
+}
+
+func (b fileBackend) Write(conf *dnsconfig.DnsConfig) error {
+	return dnsconfig.DnsWriteConfig(conf, b.path)
+}
+
+// NewBackend returns the backend called name, "auto" detecting the one
+// managing resolv.conf. link is used by backends configuring a single link.
+func NewBackend(name string, link string) (Backend, error) {
+	switch name {
+	case "file":
+		return fileBackend{name: name, path: dnsconfig.ResolvPath}, nil
+	case "resolvconf":
+		return fileBackend{name: name, path: resolvconf.ResolvPath}, nil
+	case "resolved", "networkmanager":
+		bus, err := dbus.SystemBus()
+		if err != nil {
+			return nil, err
+		}
+		if name == "resolved" {
+			return &resolvedBackend{bus: bus, link: link}, nil
+		}
+		return &networkManagerBackend{bus: bus}, nil
+	case "", "auto":
+		b := detect(link)
+		log.Printf("Use %s DNS backend", b.Name())
+		return b, nil
+	}
+	return nil, fmt.Errorf("Unknown DNS backend %s", name)
+}
+
+// detect finds out which service owns resolv.conf
+func detect(link string) Backend {
+	target, _ := filepath.EvalSymlinks(dnsconfig.ResolvPath)
+	conf, _ := dnsconfig.DnsReadConfig(dnsconfig.ResolvPath)
+	stub := strings.Contains(target, "systemd/resolve")
+	if conf != nil {
+		for _, server := range conf.Servers {
+			stub = stub || server == stubResolver
+		}
+	}
+	nm := strings.Contains(target, "NetworkManager") || generatedBy(dnsconfig.ResolvPath, "NetworkManager")
+
+	if stub || nm {
+		if bus, err := dbus.SystemBus(); err == nil {
+			switch {
+			case nm && dbus.NameHasOwner(bus, networkManagerDest):
+				return &networkManagerBackend{bus: bus}
+			case stub && dbus.NameHasOwner(bus, resolvedDest):
+				return &resolvedBackend{bus: bus, link: link}
+			case stub && dbus.NameHasOwner(bus, networkManagerDest):
+				// NetworkManager pushes its configuration to resolved
+				return &networkManagerBackend{bus: bus}
+			}
+			bus.Close()
+		} else {
+			log.WithError(err).Warn("resolv.conf is managed by a service but the system bus is unreachable")
+		}
+	}
+	if resolvconf.IsResolvconf() {
+		return fileBackend{name: "resolvconf", path: resolvconf.ResolvPath}
+	}
+	return fileBackend{name: "file", path: dnsconfig.ResolvPath}
+}
+
+// generatedBy looks for the header comment written by a resolv.conf manager
+func generatedBy(path string, manager string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := f.Read(head)
+	return strings.Contains(string(head[:n]), "Generated by "+manager)
+}
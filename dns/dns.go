@@ -2,29 +2,34 @@ package dns
 
 import (
 	"encoding/json"
-	"net/http"
+	"net"
 
 	log "github.com/Sirupsen/logrus"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/boltdb/bolt"
 	"github.com/guilhem/dnsconfig"
-	"github.com/guilhem/dnsconfig/resolvconf"
+
+	"github.com/guilhem/tentacool/apierror"
 )
 
 const (
-	dnsBucket = "dns"
-	key       = "dns"
+	dnsBucket    = "dns"
+	key          = "dns"
+	defaultIface = "eth0"
 )
 
-var db *bolt.DB
+// Handler serves the DNS API
+type Handler struct {
+	DB      *bolt.DB
+	Backend Backend
+}
 
 // GetDNS returns all registered DNS
-func GetDNS(w rest.ResponseWriter, req *rest.Request) {
-	dns, err := dnsconfig.DnsReadConfig(useResolvPath())
+func (h *Handler) GetDNS(w rest.ResponseWriter, req *rest.Request) {
+	dns, err := h.Backend.Read()
 	if err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, err)
 		return
 	}
 	log.Printf("Request DNS list : %v", dns)
@@ -32,14 +37,19 @@ func GetDNS(w rest.ResponseWriter, req *rest.Request) {
 }
 
 // PostDNS register the specified list of DNS
-func PostDNS(w rest.ResponseWriter, req *rest.Request) {
+func (h *Handler) PostDNS(w rest.ResponseWriter, req *rest.Request) {
 	dns := dnsconfig.DnsConfig{}
 	if err := req.DecodeJsonPayload(&dns); err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, apierror.BadRequest(err))
 		return
 	}
-	db.Update(func(tx *bolt.Tx) (err error) {
+	for _, server := range dns.Servers {
+		if net.ParseIP(server) == nil {
+			apierror.Write(w, apierror.Invalid("servers", "Invalid IP %s", server))
+			return
+		}
+	}
+	err := h.DB.Update(func(tx *bolt.Tx) (err error) {
 		b := tx.Bucket([]byte(dnsBucket))
 		data, err := json.Marshal(dns)
 		if err != nil {
@@ -48,26 +58,64 @@ func PostDNS(w rest.ResponseWriter, req *rest.Request) {
 		err = b.Put([]byte(key), []byte(data))
 		return
 	})
-	if err := dnsconfig.DnsWriteConfig(&dns, useResolvPath()); err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	if err := h.Backend.Write(&dns); err != nil {
+		apierror.NotApplied(w, &dns, err)
 		return
 	}
 	w.WriteJson(&dns)
 }
 
-func useResolvPath() string {
-	if resolvconf.IsResolvconf() {
-		log.Printf("use Resolvconf")
-		return resolvconf.ResolvPath
+// Upstreams returns the nameservers registered in DB,
+// falling back on the ones currently used by the system
+func (h *Handler) Upstreams() (servers []string, err error) {
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
+		v := tx.Bucket([]byte(dnsBucket)).Get([]byte(key))
+		if v == nil {
+			return
+		}
+		dns := dnsconfig.DnsConfig{}
+		if err = json.Unmarshal(v, &dns); err != nil {
+			return
+		}
+		servers = dns.Servers
+		return
+	})
+	if err != nil || len(servers) > 0 {
+		return
 	}
-	return dnsconfig.ResolvPath
+	dns, err := h.Backend.Read()
+	if err != nil {
+		return
+	}
+	return dns.Servers, nil
+}
+
+// Restore applies to the system the change of the DNS bucket
+// from one content to another, the database already holding the latter.
+// A configuration no longer managed is left as is.
+func (h *Handler) Restore(from, to map[string][]byte) (err error) {
+	v, ok := to[key]
+	if !ok {
+		return
+	}
+	dns := dnsconfig.DnsConfig{}
+	if err = json.Unmarshal(v, &dns); err != nil {
+		return
+	}
+	return h.Backend.Write(&dns)
 }
 
 // DBinit initializes the DNS database at startup
-func DBinit(d *bolt.DB) (err error) {
-	db = d
-	err = db.Update(func(tx *bolt.Tx) (err error) {
+func (h *Handler) DBinit() (err error) {
+	if h.Backend == nil {
+		h.Backend = detect(defaultIface)
+		log.Printf("Use %s DNS backend", h.Backend.Name())
+	}
+	err = h.DB.Update(func(tx *bolt.Tx) (err error) {
 		_, err = tx.CreateBucketIfNotExists([]byte(dnsBucket))
 		return
 	})
@@ -76,16 +124,16 @@ func DBinit(d *bolt.DB) (err error) {
 	}
 
 	log.Printf("Reinstall previous dns from DB")
-	err = db.View(func(tx *bolt.Tx) (err error) {
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
 		b := tx.Bucket([]byte(dnsBucket))
 		dns := dnsconfig.DnsConfig{}
 		v := b.Get([]byte(key))
 		if v != nil {
 			if err := json.Unmarshal(v, &dns); err != nil {
-				log.Printf(err.Error())
+				log.Print(err)
 			}
-			if err := dnsconfig.DnsWriteConfig(&dns, useResolvPath()); err != nil {
-				log.Printf(err.Error())
+			if err := h.Backend.Write(&dns); err != nil {
+				log.Print(err)
 			}
 		}
 		return
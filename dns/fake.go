@@ -0,0 +1,41 @@
+package dns
+
+import (
+	"sync"
+
+	"github.com/guilhem/dnsconfig"
+)
+
+// FakeBackend keeps the DNS configuration in memory, for tests
+type FakeBackend struct {
+	sync.Mutex
+	Config dnsconfig.DnsConfig
+	// Err is returned by every operation when set
+	Err error
+}
+
+// Name returns "fake"
+func (f *FakeBackend) Name() string {
+	return "fake"
+}
+
+// Read returns a copy of Config
+func (f *FakeBackend) Read() (*dnsconfig.DnsConfig, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	conf := f.Config
+	return &conf, nil
+}
+
+// Write replaces Config
+func (f *FakeBackend) Write(conf *dnsconfig.DnsConfig) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err == nil {
+		f.Config = *conf
+	}
+	return f.Err
+}
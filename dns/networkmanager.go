@@ -0,0 +1,99 @@
+package dns
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/guilhem/dnsconfig"
+
+	"github.com/guilhem/tentacool/dbus"
+)
+
+const (
+	networkManagerDest = "org.freedesktop.NetworkManager"
+	networkManagerPath = dbus.ObjectPath("/org/freedesktop/NetworkManager")
+)
+
+// networkManagerBackend sets the global DNS configuration of NetworkManager,
+// which takes precedence over the one of connections
+type networkManagerBackend struct {
+	bus dbus.Caller
+}
+
+func (b *networkManagerBackend) Name() string {
+	return "networkmanager"
+}
+
+func (b *networkManagerBackend) Read() (*dnsconfig.DnsConfig, error) {
+	v, err := dbus.GetProperty(b.bus, networkManagerDest, networkManagerPath, networkManagerDest, "GlobalDnsConfiguration")
+	if err != nil {
+		return nil, err
+	}
+	conf := &dnsconfig.DnsConfig{}
+	global, _ := v.(map[string]interface{})
+
+	conf.Search = stringsOf(global["searches"])
+	for _, option := range stringsOf(global["options"]) {
+		switch {
+		case strings.HasPrefix(option, "ndots:"):
+			conf.Ndots, _ = strconv.Atoi(strings.TrimPrefix(option, "ndots:"))
+		case strings.HasPrefix(option, "timeout:"):
+			conf.Timeout, _ = strconv.Atoi(strings.TrimPrefix(option, "timeout:"))
+		case strings.HasPrefix(option, "attempts:"):
+			conf.Attempts, _ = strconv.Atoi(strings.TrimPrefix(option, "attempts:"))
+		case option == "rotate":
+			conf.Rotate = true
+		}
+	}
+	if domains, ok := variantValue(global["domains"]).(map[string]interface{}); ok {
+		if all, ok := variantValue(domains["*"]).(map[string]interface{}); ok {
+			conf.Servers = stringsOf(all["servers"])
+		}
+	}
+	return conf, nil
+}
+
+func (b *networkManagerBackend) Write(conf *dnsconfig.DnsConfig) error {
+	global := map[string]interface{}{}
+	if len(conf.Servers) > 0 {
+		options := []string{}
+		if conf.Ndots != 0 {
+			options = append(options, "ndots:"+strconv.Itoa(conf.Ndots))
+		}
+		if conf.Timeout != 0 {
+			options = append(options, "timeout:"+strconv.Itoa(conf.Timeout))
+		}
+		if conf.Attempts != 0 {
+			options = append(options, "attempts:"+strconv.Itoa(conf.Attempts))
+		}
+		if conf.Rotate {
+			options = append(options, "rotate")
+		}
+		servers := map[string]interface{}{"servers": dbus.Variant{Sig: "as", Value: conf.Servers}}
+		global["searches"] = dbus.Variant{Sig: "as", Value: append([]string{}, conf.Search...)}
+		global["options"] = dbus.Variant{Sig: "as", Value: options}
+		global["domains"] = dbus.Variant{Sig: "a{sv}", Value: map[string]interface{}{
+			"*": dbus.Variant{Sig: "a{sv}", Value: servers},
+		}}
+	}
+	// an empty configuration gives control back to connections
+	return dbus.SetProperty(b.bus, networkManagerDest, networkManagerPath, networkManagerDest,
+		"GlobalDnsConfiguration", dbus.Variant{Sig: "a{sv}", Value: global})
+}
+
+func variantValue(v interface{}) interface{} {
+	if variant, ok := v.(dbus.Variant); ok {
+		return variant.Value
+	}
+	return v
+}
+
+func stringsOf(v interface{}) (res []string) {
+	list, _ := variantValue(v).([]interface{})
+	for _, s := range list {
+		if s, ok := s.(string); ok {
+			res = append(res, s)
+		}
+	}
+	return
+}
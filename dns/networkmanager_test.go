@@ -0,0 +1,67 @@
+package dns
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/guilhem/dnsconfig"
+
+	"github.com/guilhem/tentacool/dbus"
+)
+
+func TestNetworkManagerRoundTrip(t *testing.T) {
+	bus := dbus.NewFakeBus()
+	b := &networkManagerBackend{bus: bus}
+	conf := &dnsconfig.DnsConfig{
+		Servers:  []string{"10.0.0.1", "10.0.0.2"},
+		Search:   []string{"example.com"},
+		Ndots:    2,
+		Timeout:  3,
+		Attempts: 4,
+		Rotate:   true,
+	}
+	if err := b.Write(conf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, conf) {
+		t.Errorf("got %+v, expecting %+v", got, conf)
+	}
+
+	// giving control back to connections
+	if err := b.Write(&dnsconfig.DnsConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	global := bus.Properties[networkManagerDest+".GlobalDnsConfiguration"]
+	if m, ok := global.Value.(map[string]interface{}); !ok || len(m) != 0 {
+		t.Errorf("got %#v, expecting an empty configuration", global)
+	}
+}
+
+func TestNetworkManagerErrors(t *testing.T) {
+	bus := dbus.NewFakeBus()
+	b := &networkManagerBackend{bus: bus}
+	// no global configuration yet
+	if _, err := b.Read(); err == nil {
+		t.Error("expecting an error for a missing property")
+	}
+	bus.Err = errors.New("bus down")
+	if err := b.Write(&dnsconfig.DnsConfig{Servers: []string{"10.0.0.1"}}); err != bus.Err {
+		t.Errorf("got %v, expecting %v", err, bus.Err)
+	}
+}
+
+func TestNameHasOwner(t *testing.T) {
+	bus := dbus.NewFakeBus()
+	bus.Owners[resolvedDest] = true
+	if !dbus.NameHasOwner(bus, resolvedDest) {
+		t.Errorf("%s is owned", resolvedDest)
+	}
+	if dbus.NameHasOwner(bus, networkManagerDest) {
+		t.Errorf("%s is not owned", networkManagerDest)
+	}
+}
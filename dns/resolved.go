@@ -0,0 +1,147 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/guilhem/dnsconfig"
+	"github.com/vishvananda/netlink"
+
+	"github.com/guilhem/tentacool/dbus"
+)
+
+const (
+	resolvedDest  = "org.freedesktop.resolve1"
+	resolvedPath  = dbus.ObjectPath("/org/freedesktop/resolve1")
+	resolvedIface = "org.freedesktop.resolve1.Manager"
+)
+
+// resolvedBackend configures the DNS of a link in systemd-resolved,
+// the one of the default route when link is empty
+type resolvedBackend struct {
+	bus  dbus.Caller
+	link string
+}
+
+func (b *resolvedBackend) Name() string {
+	return "resolved"
+}
+
+func (b *resolvedBackend) index() (int32, error) {
+	if b.link == "" {
+		// IPv4 first
+		routes, err := netlink.RouteList(nil, netlink.FAMILY_V4)
+		if err != nil {
+			return 0, err
+		}
+		v6, err := netlink.RouteList(nil, netlink.FAMILY_V6)
+		if err != nil {
+			return 0, err
+		}
+		index, ok := defaultIndex(append(routes, v6...))
+		if !ok {
+			return 0, fmt.Errorf("No default route to pick the link of, set --dns-link")
+		}
+		return int32(index), nil
+	}
+	iface, err := net.InterfaceByName(b.link)
+	if err != nil {
+		return 0, err
+	}
+	return int32(iface.Index), nil
+}
+
+// defaultIndex returns the link of the default route of the main table
+// with the lowest metric, the first one among equals
+func defaultIndex(routes []netlink.Route) (index int, ok bool) {
+	var best *netlink.Route
+	for i, r := range routes {
+		if r.Dst != nil || r.LinkIndex == 0 || (r.Table != 0 && r.Table != syscall.RT_TABLE_MAIN) {
+			continue
+		}
+		if best == nil || r.Priority < best.Priority {
+			best = &routes[i]
+		}
+	}
+	if best == nil {
+		return 0, false
+	}
+	return best.LinkIndex, true
+}
+
+func (b *resolvedBackend) Read() (*dnsconfig.DnsConfig, error) {
+	index, err := b.index()
+	if err != nil {
+		return nil, err
+	}
+	conf := &dnsconfig.DnsConfig{}
+
+	servers, err := dbus.GetProperty(b.bus, resolvedDest, resolvedPath, resolvedIface, "DNS")
+	if err != nil {
+		return nil, err
+	}
+	list, _ := servers.([]interface{})
+	for _, s := range list {
+		// (ifindex, family, address)
+		s, ok := s.([]interface{})
+		if !ok || len(s) != 3 || s[0] != index {
+			continue
+		}
+		if ip, ok := s[2].([]byte); ok {
+			conf.Servers = append(conf.Servers, net.IP(ip).String())
+		}
+	}
+
+	domains, err := dbus.GetProperty(b.bus, resolvedDest, resolvedPath, resolvedIface, "Domains")
+	if err != nil {
+		return nil, err
+	}
+	list, _ = domains.([]interface{})
+	for _, d := range list {
+		// (ifindex, domain, routing only)
+		d, ok := d.([]interface{})
+		if !ok || len(d) != 3 || d[0] != index {
+			continue
+		}
+		if domain, ok := d[1].(string); ok {
+			conf.Search = append(conf.Search, domain)
+		}
+	}
+	return conf, nil
+}
+
+func (b *resolvedBackend) Write(conf *dnsconfig.DnsConfig) error {
+	index, err := b.index()
+	if err != nil {
+		return err
+	}
+	if conf.Ndots != 0 || conf.Timeout != 0 || conf.Attempts != 0 || conf.Rotate {
+		log.Printf("systemd-resolved ignores resolver options")
+	}
+
+	servers := []interface{}{}
+	for _, server := range conf.Servers {
+		ip := net.ParseIP(server)
+		if ip == nil {
+			return fmt.Errorf("Invalid DNS server %s", server)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			servers = append(servers, []interface{}{int32(syscall.AF_INET), []byte(ip4)})
+		} else {
+			servers = append(servers, []interface{}{int32(syscall.AF_INET6), []byte(ip.To16())})
+		}
+	}
+	if _, err := b.bus.Call(resolvedDest, resolvedPath, resolvedIface, "SetLinkDNS", "ia(iay)", index, servers); err != nil {
+		return err
+	}
+
+	domains := []interface{}{}
+	for _, domain := range conf.Search {
+		domains = append(domains, []interface{}{domain, false})
+	}
+	_, err = b.bus.Call(resolvedDest, resolvedPath, resolvedIface, "SetLinkDomains", "ia(sb)", index, domains)
+	return err
+}
@@ -0,0 +1,91 @@
+package dns
+
+import (
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/guilhem/dnsconfig"
+	"github.com/vishvananda/netlink"
+
+	"github.com/guilhem/tentacool/dbus"
+)
+
+// loopback returns the index of the loopback link, the one configured
+func loopback(t *testing.T) int32 {
+	iface, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip(err)
+	}
+	return int32(iface.Index)
+}
+
+func TestResolvedRead(t *testing.T) {
+	index := loopback(t)
+	bus := dbus.NewFakeBus()
+	bus.Properties[resolvedIface+".DNS"] = dbus.Variant{Sig: "a(iiay)", Value: []interface{}{
+		[]interface{}{index, int32(syscall.AF_INET), []byte{10, 0, 0, 1}},
+		[]interface{}{index + 1, int32(syscall.AF_INET), []byte{10, 0, 0, 2}},
+		[]interface{}{index, int32(syscall.AF_INET6), []byte(net.ParseIP("fd00::1"))},
+	}}
+	bus.Properties[resolvedIface+".Domains"] = dbus.Variant{Sig: "a(isb)", Value: []interface{}{
+		[]interface{}{index + 1, "other.example", false},
+		[]interface{}{index, "example.com", false},
+	}}
+
+	b := &resolvedBackend{bus: bus, link: "lo"}
+	conf, err := b.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &dnsconfig.DnsConfig{Servers: []string{"10.0.0.1", "fd00::1"}, Search: []string{"example.com"}}
+	if !reflect.DeepEqual(conf, want) {
+		t.Errorf("got %+v, expecting %+v", conf, want)
+	}
+}
+
+func TestResolvedWrite(t *testing.T) {
+	index := loopback(t)
+	bus := dbus.NewFakeBus()
+	b := &resolvedBackend{bus: bus, link: "lo"}
+	if err := b.Write(&dnsconfig.DnsConfig{Servers: []string{"10.0.0.1", "fd00::1"}, Search: []string{"example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	servers := []interface{}{index, []interface{}{
+		[]interface{}{int32(syscall.AF_INET), []byte{10, 0, 0, 1}},
+		[]interface{}{int32(syscall.AF_INET6), []byte(net.ParseIP("fd00::1"))},
+	}}
+	if got := bus.Calls[resolvedIface+".SetLinkDNS"]; !reflect.DeepEqual(got, servers) {
+		t.Errorf("SetLinkDNS: got %#v, expecting %#v", got, servers)
+	}
+	domains := []interface{}{index, []interface{}{[]interface{}{"example.com", false}}}
+	if got := bus.Calls[resolvedIface+".SetLinkDomains"]; !reflect.DeepEqual(got, domains) {
+		t.Errorf("SetLinkDomains: got %#v, expecting %#v", got, domains)
+	}
+
+	if err := b.Write(&dnsconfig.DnsConfig{Servers: []string{"invalid"}}); err == nil {
+		t.Error("expecting an error for an invalid server")
+	}
+}
+
+func TestDefaultIndex(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.32.0/24")
+	for _, test := range []struct {
+		name   string
+		routes []netlink.Route
+		index  int
+		ok     bool
+	}{
+		{"none", nil, 0, false},
+		{"no default", []netlink.Route{{LinkIndex: 2, Dst: lan}}, 0, false},
+		{"default", []netlink.Route{{LinkIndex: 2, Dst: lan}, {LinkIndex: 3, Gw: net.ParseIP("192.168.32.1")}}, 3, true},
+		{"lowest metric", []netlink.Route{{LinkIndex: 2, Priority: 600}, {LinkIndex: 3, Priority: 100}, {LinkIndex: 4, Priority: 100}}, 3, true},
+		{"other table", []netlink.Route{{LinkIndex: 2, Table: 100}, {LinkIndex: 3, Table: syscall.RT_TABLE_MAIN, Priority: 10}}, 3, true},
+	} {
+		if index, ok := defaultIndex(test.routes); index != test.index || ok != test.ok {
+			t.Errorf("%s: got %d, %v, expecting %d, %v", test.name, index, ok, test.index, test.ok)
+		}
+	}
+}
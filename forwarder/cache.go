@@ -0,0 +1,125 @@
+package forwarder
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// negativeTTL caps the time a failed lookup is kept
+const negativeTTL = 60 * time.Second
+
+type cacheEntry struct {
+	msg     []byte
+	ttls    []int
+	stored  time.Time
+	expires time.Time
+}
+
+// cache keeps upstream answers until their smallest TTL expires
+type cache struct {
+	sync.Mutex
+	size    int
+	entries map[string]cacheEntry
+}
+
+func newCache(size int) *cache {
+	return &cache{size: size, entries: map[string]cacheEntry{}}
+}
+
+// get returns a copy of the cached answer, with its ID and TTLs adjusted
+func (c *cache) get(key string, id uint16, now time.Time) []byte {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if !now.Before(e.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	msg := make([]byte, len(e.msg))
+	copy(msg, e.msg)
+	binary.BigEndian.PutUint16(msg, id)
+	elapsed := uint32(now.Sub(e.stored) / time.Second)
+	for _, off := range e.ttls {
+		ttl := binary.BigEndian.Uint32(msg[off:])
+		if ttl > elapsed {
+			ttl -= elapsed
+		} else {
+			ttl = 0
+		}
+		binary.BigEndian.PutUint32(msg[off:], ttl)
+	}
+	return msg
+}
+
+// put stores an upstream answer if it is worth caching
+func (c *cache) put(key string, msg []byte, now time.Time) {
+	if c.size <= 0 || truncated(msg) {
+		return
+	}
+	code := rcode(msg)
+	if code != rcodeNoError && code != rcodeNXDomain {
+		return
+	}
+	offsets, err := ttlOffsets(msg)
+	if err != nil {
+		return
+	}
+	ttl := time.Duration(-1)
+	for _, off := range offsets {
+		if t := time.Duration(binary.BigEndian.Uint32(msg[off:])) * time.Second; ttl < 0 || t < ttl {
+			ttl = t
+		}
+	}
+	if ttl < 0 || code == rcodeNXDomain && ttl > negativeTTL {
+		ttl = negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	e := cacheEntry{
+		msg:     make([]byte, len(msg)),
+		ttls:    offsets,
+		stored:  now,
+		expires: now.Add(ttl),
+	}
+	copy(e.msg, msg)
+
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		c.evict(now)
+	}
+	c.entries[key] = e
+}
+
+// evict drops expired entries, or an arbitrary one when none is
+func (c *cache) evict(now time.Time) {
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	for k := range c.entries {
+		if len(c.entries) < c.size {
+			return
+		}
+		delete(c.entries, k)
+	}
+}
+
+func (c *cache) len() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.entries)
+}
+
+func (c *cache) flush() {
+	c.Lock()
+	defer c.Unlock()
+	c.entries = map[string]cacheEntry{}
+}
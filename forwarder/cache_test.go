@@ -0,0 +1,133 @@
+package forwarder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	q := query("example.com", typeA)
+	ok := answer(q, rcodeNoError, record(typeA, 300, []byte{10, 0, 0, 1}), record(typeA, 60, []byte{10, 0, 0, 2}))
+	truncatedAnswer := answer(q, rcodeNoError, record(typeA, 300, []byte{10, 0, 0, 1}))
+	binary.BigEndian.PutUint16(truncatedAnswer[2:], binary.BigEndian.Uint16(truncatedAnswer[2:])|flagTC)
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		msg  []byte
+		// ttl is how long the answer is kept, 0 when not cached
+		ttl time.Duration
+	}{
+		{"smallest ttl", ok, 60 * time.Second},
+		{"no answer", answer(q, rcodeNoError), negativeTTL},
+		{"nxdomain", answer(q, rcodeNXDomain, record(typeA, 3600, []byte{10, 0, 0, 1})), negativeTTL},
+		{"zero ttl", answer(q, rcodeNoError, record(typeA, 0, []byte{10, 0, 0, 1})), 0},
+		{"servfail", answer(q, rcodeServFail), 0},
+		{"truncated", truncatedAnswer, 0},
+		{"malformed", ok[:len(ok)-1], 0},
+	}
+	for _, test := range tests {
+		c := newCache(10)
+		c.put("key", test.msg, now)
+		if test.ttl == 0 {
+			if c.len() != 0 {
+				t.Errorf("%s: cached", test.name)
+			}
+			continue
+		}
+		if c.get("key", 1, now.Add(test.ttl-time.Second)) == nil {
+			t.Errorf("%s: not cached", test.name)
+		}
+		if c.get("key", 1, now.Add(test.ttl)) != nil {
+			t.Errorf("%s: cached beyond %s", test.name, test.ttl)
+		}
+	}
+}
+
+func TestCacheGet(t *testing.T) {
+	q := query("example.com", typeA)
+	msg := answer(q, rcodeNoError, record(typeA, 300, []byte{10, 0, 0, 1}), record(typeA, 60, []byte{10, 0, 0, 2}))
+	now := time.Now()
+	c := newCache(10)
+	c.put("key", msg, now)
+
+	got := c.get("key", 0xABCD, now.Add(45*time.Second))
+	if binary.BigEndian.Uint16(got) != 0xABCD {
+		t.Errorf("got ID %x", binary.BigEndian.Uint16(got))
+	}
+	for i, want := range []uint32{255, 15} {
+		if ttl := binary.BigEndian.Uint32(got[len(q)+6+i*16:]); ttl != want {
+			t.Errorf("got TTL %d, expecting %d", ttl, want)
+		}
+	}
+	// the stored answer is left untouched
+	if got = c.get("key", 0x1234, now); binary.BigEndian.Uint32(got[len(q)+6:]) != 300 {
+		t.Errorf("got TTL %d", binary.BigEndian.Uint32(got[len(q)+6:]))
+	}
+	if c.get("other", 1, now) != nil {
+		t.Errorf("got an answer for another key")
+	}
+}
+
+func TestCacheEvict(t *testing.T) {
+	now := time.Now()
+	c := newCache(3)
+	for i, ttl := range []uint32{10, 300, 300} {
+		q := query(fmt.Sprintf("host%d.example.com", i), typeA)
+		c.put(keyOf(q), answer(q, rcodeNoError, record(typeA, ttl, []byte{10, 0, 0, byte(i)})), now)
+	}
+
+	// the expired entry goes first
+	later := now.Add(time.Minute)
+	q := query("host3.example.com", typeA)
+	c.put(keyOf(q), answer(q, rcodeNoError, record(typeA, 300, []byte{10, 0, 0, 3})), later)
+	if c.len() != 3 {
+		t.Errorf("got %d entries", c.len())
+	}
+	if c.get(keyOf(query("host0.example.com", typeA)), 1, now) != nil {
+		t.Errorf("expired entry kept")
+	}
+
+	// then any
+	q = query("host4.example.com", typeA)
+	c.put(keyOf(q), answer(q, rcodeNoError, record(typeA, 300, []byte{10, 0, 0, 4})), later)
+	if c.len() != 3 || c.get(keyOf(q), 1, later) == nil {
+		t.Errorf("got %d entries", c.len())
+	}
+
+	c.flush()
+	if c.len() != 0 {
+		t.Errorf("got %d entries after a flush", c.len())
+	}
+	disabled := newCache(0)
+	disabled.put("key", answer(q, rcodeNoError, record(typeA, 300, []byte{10, 0, 0, 4})), now)
+	if disabled.len() != 0 {
+		t.Errorf("disabled cache kept an entry")
+	}
+}
+
+// keyOf returns the cache key of a query
+func keyOf(msg []byte) string {
+	q, _ := parseQuestion(msg)
+	return q.key(udpSize(msg, q))
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		a, b []byte
+		same bool
+	}{
+		{query("Example.COM", typeA), query("example.com", typeA), true},
+		{query("example.com", typeA), query("example.com", typeAAAA), false},
+		{query("example.com", typeA), query("example.com", typeA, opt(256)), true},
+		{query("example.com", typeA), query("example.com", typeA, opt(4096)), false},
+		{query("example.com", typeA, opt(1232)), query("example.com", typeA, opt(4096)), false},
+	}
+	for _, test := range tests {
+		if a, b := keyOf(test.a), keyOf(test.b); (a == b) != test.same {
+			t.Errorf("%s and %s: same is %v", a, b, a == b)
+		}
+	}
+}
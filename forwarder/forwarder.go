@@ -0,0 +1,267 @@
+package forwarder
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/boltdb/bolt"
+
+	"github.com/guilhem/tentacool/apierror"
+)
+
+const (
+	hostsBucket  = "forwarder-hosts"
+	leasesBucket = "leases"
+)
+
+// Handler serves the forwarder API and answers DNS queries
+type Handler struct {
+	DB *bolt.DB
+	// Upstreams returns the servers queries are forwarded to
+	Upstreams func() ([]string, error)
+
+	// mu guards srv, set and cleared while the API is served
+	mu  sync.Mutex
+	srv *server
+}
+
+// hostStruct is a static override served before asking upstreams
+type hostStruct struct {
+	Name string   `json:"name"`
+	IPs  []string `json:"ips"`
+}
+
+// Host is a static name of the forwarder
+type Host = hostStruct
+
+// leaseStruct is a hostname registered by the DHCP server of the LAN
+type leaseStruct struct {
+	Hostname string    `json:"hostname"`
+	IP       string    `json:"ip"`
+	MAC      string    `json:"mac,omitempty"`
+	Expires  time.Time `json:"expires,omitempty"`
+}
+
+// Lease is a hostname leased on the LAN
+type Lease = leaseStruct
+
+type forwarderStruct struct {
+	Enabled bool     `json:"enabled"`
+	Listen  []string `json:"listen"`
+	Stats   *Stats   `json:"stats,omitempty"`
+}
+
+// Status is the state of the forwarder
+type Status = forwarderStruct
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// GetForwarder returns the forwarder state and its cache statistics
+func (h *Handler) GetForwarder(w rest.ResponseWriter, req *rest.Request) {
+	forwarder := forwarderStruct{Listen: []string{}}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.srv != nil {
+		stats := h.srv.stats()
+		forwarder.Enabled = true
+		forwarder.Listen = h.srv.listen
+		forwarder.Stats = &stats
+	}
+	w.WriteJson(forwarder)
+}
+
+// GetHosts returns all static overrides
+func (h *Handler) GetHosts(w rest.ResponseWriter, req *rest.Request) {
+	hosts := []hostStruct{}
+	err := h.DB.View(func(tx *bolt.Tx) (err error) {
+		return tx.Bucket([]byte(hostsBucket)).ForEach(func(k, v []byte) (err error) {
+			host := hostStruct{}
+			if err = json.Unmarshal(v, &host); err != nil {
+				return
+			}
+			hosts = append(hosts, host)
+			return
+		})
+	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(hosts)
+}
+
+// PutHost registers a static override for the given name
+func (h *Handler) PutHost(w rest.ResponseWriter, req *rest.Request) {
+	host := hostStruct{}
+	if err := req.DecodeJsonPayload(&host); err != nil {
+		apierror.Write(w, apierror.BadRequest(err))
+		return
+	}
+	host.Name = normalize(req.PathParam("name"))
+	if len(host.IPs) == 0 {
+		apierror.Write(w, apierror.Invalid("ips", "IPs are empty"))
+		return
+	}
+	for _, ip := range host.IPs {
+		if net.ParseIP(ip) == nil {
+			apierror.Write(w, apierror.Invalid("ips", "Invalid IP %s", ip))
+			return
+		}
+	}
+	if err := h.put(hostsBucket, host.Name, host); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(host)
+}
+
+// DeleteHost removes the static override for the given name
+func (h *Handler) DeleteHost(w rest.ResponseWriter, req *rest.Request) {
+	if err := h.remove(hostsBucket, normalize(req.PathParam("name"))); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetLeases returns all registered DHCP leases
+func (h *Handler) GetLeases(w rest.ResponseWriter, req *rest.Request) {
+	leases := []leaseStruct{}
+	err := h.DB.View(func(tx *bolt.Tx) (err error) {
+		return tx.Bucket([]byte(leasesBucket)).ForEach(func(k, v []byte) (err error) {
+			lease := leaseStruct{}
+			if err = json.Unmarshal(v, &lease); err != nil {
+				return
+			}
+			leases = append(leases, lease)
+			return
+		})
+	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(leases)
+}
+
+// PutLease registers the hostname of a DHCP lease,
+// usually from the lease script of the DHCP server
+func (h *Handler) PutLease(w rest.ResponseWriter, req *rest.Request) {
+	lease := leaseStruct{}
+	if err := req.DecodeJsonPayload(&lease); err != nil {
+		apierror.Write(w, apierror.BadRequest(err))
+		return
+	}
+	lease.Hostname = normalize(req.PathParam("hostname"))
+	if net.ParseIP(lease.IP) == nil {
+		apierror.Write(w, apierror.Invalid("ip", "Invalid IP %s", lease.IP))
+		return
+	}
+	if err := h.put(leasesBucket, lease.Hostname, lease); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(lease)
+}
+
+// DeleteLease removes the hostname of a released DHCP lease
+func (h *Handler) DeleteLease(w rest.ResponseWriter, req *rest.Request) {
+	if err := h.remove(leasesBucket, normalize(req.PathParam("hostname"))); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) put(bucket string, key string, v interface{}) error {
+	if key == "" {
+		return apierror.Invalid("name", "Name is empty")
+	}
+	return h.DB.Update(func(tx *bolt.Tx) (err error) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+		log.Printf("Updating key %s with value %s", key, data)
+		return tx.Bucket([]byte(bucket)).Put([]byte(key), data)
+	})
+}
+
+func (h *Handler) remove(bucket string, key string) error {
+	return h.DB.Update(func(tx *bolt.Tx) (err error) {
+		return tx.Bucket([]byte(bucket)).Delete([]byte(key))
+	})
+}
+
+// lookup returns the local addresses for name, static overrides first
+func (h *Handler) lookup(name string) (ips []net.IP, found bool) {
+	name = normalize(name)
+	h.DB.View(func(tx *bolt.Tx) (err error) {
+		if v := tx.Bucket([]byte(hostsBucket)).Get([]byte(name)); v != nil {
+			host := hostStruct{}
+			if json.Unmarshal(v, &host) == nil {
+				for _, ip := range host.IPs {
+					ips = append(ips, net.ParseIP(ip))
+				}
+				found = true
+				return
+			}
+		}
+		if v := tx.Bucket([]byte(leasesBucket)).Get([]byte(name)); v != nil {
+			lease := leaseStruct{}
+			if json.Unmarshal(v, &lease) == nil {
+				if lease.Expires.IsZero() || time.Now().Before(lease.Expires) {
+					ips = append(ips, net.ParseIP(lease.IP))
+					found = true
+				}
+			}
+		}
+		return
+	})
+	return
+}
+
+// Start listens for DNS queries on the given addresses
+func (h *Handler) Start(listen []string, cacheSize int) (err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.srv != nil {
+		return errors.New("forwarder already started")
+	}
+	if h.srv, err = newServer(h, listen, cacheSize); err != nil {
+		return
+	}
+	log.Printf("DNS forwarder listening on %s", strings.Join(h.srv.listen, ", "))
+	return
+}
+
+// Stop closes the forwarder listeners
+func (h *Handler) Stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.srv != nil {
+		h.srv.close()
+		h.srv = nil
+	}
+}
+
+// DBinit initializes the forwarder database at startup
+func (h *Handler) DBinit() (err error) {
+	return h.DB.Update(func(tx *bolt.Tx) (err error) {
+		if _, err = tx.CreateBucketIfNotExists([]byte(hostsBucket)); err != nil {
+			return
+		}
+		_, err = tx.CreateBucketIfNotExists([]byte(leasesBucket))
+		return
+	})
+}
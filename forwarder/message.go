@@ -0,0 +1,202 @@
+package forwarder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	headerLen = 12
+	// minUDPSize is the answer size accepted by clients without EDNS
+	minUDPSize = 512
+
+	typeA    = 1
+	typeAAAA = 28
+	typeOPT  = 41
+	classIN  = 1
+
+	flagQR = 1 << 15
+	flagAA = 1 << 10
+	flagTC = 1 << 9
+	flagRD = 1 << 8
+	flagRA = 1 << 7
+
+	rcodeNoError  = 0
+	rcodeServFail = 2
+	rcodeNXDomain = 3
+)
+
+var errMalformed = errors.New("malformed DNS message")
+
+// question is the single question of a DNS query
+type question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	// end is the offset of the first byte after the question section
+	end int
+}
+
+// key identifies the answers to q that fit in size bytes
+func (q question) key(size int) string {
+	return fmt.Sprintf("%s/%d/%d/%d", strings.ToLower(q.Name), q.Type, q.Class, size)
+}
+
+// parseQuestion reads the question of a query holding exactly one
+func parseQuestion(msg []byte) (q question, err error) {
+	if len(msg) < headerLen {
+		return q, errMalformed
+	}
+	if binary.BigEndian.Uint16(msg[4:]) != 1 {
+		return q, errors.New("only one question is supported")
+	}
+	labels := []string{}
+	off := headerLen
+	for {
+		if off >= len(msg) {
+			return q, errMalformed
+		}
+		l := int(msg[off])
+		off++
+		if l == 0 {
+			break
+		}
+		// compression pointers are not expected in questions
+		if l&0xC0 != 0 || off+l > len(msg) {
+			return q, errMalformed
+		}
+		labels = append(labels, string(msg[off:off+l]))
+		off += l
+	}
+	if off+4 > len(msg) {
+		return q, errMalformed
+	}
+	q.Name = strings.Join(labels, ".")
+	q.Type = binary.BigEndian.Uint16(msg[off:])
+	q.Class = binary.BigEndian.Uint16(msg[off+2:])
+	q.end = off + 4
+	return q, nil
+}
+
+// skipName returns the offset following the (maybe compressed) name at off
+func skipName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errMalformed
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1, nil
+		case l&0xC0 == 0xC0:
+			if off+2 > len(msg) {
+				return 0, errMalformed
+			}
+			return off + 2, nil
+		case l&0xC0 != 0:
+			return 0, errMalformed
+		default:
+			off += l + 1
+		}
+	}
+}
+
+// ttlOffsets returns the offsets of every TTL field in the answer, authority
+// and additional sections, OPT pseudo-records excluded
+func ttlOffsets(msg []byte) (offsets []int, err error) {
+	if len(msg) < headerLen {
+		return nil, errMalformed
+	}
+	qd := int(binary.BigEndian.Uint16(msg[4:]))
+	rr := int(binary.BigEndian.Uint16(msg[6:])) +
+		int(binary.BigEndian.Uint16(msg[8:])) +
+		int(binary.BigEndian.Uint16(msg[10:]))
+
+	off := headerLen
+	for i := 0; i < qd; i++ {
+		if off, err = skipName(msg, off); err != nil {
+			return
+		}
+		off += 4
+	}
+	for i := 0; i < rr; i++ {
+		if off, err = skipName(msg, off); err != nil {
+			return
+		}
+		if off+10 > len(msg) {
+			return nil, errMalformed
+		}
+		if binary.BigEndian.Uint16(msg[off:]) != typeOPT {
+			offsets = append(offsets, off+4)
+		}
+		off += 10 + int(binary.BigEndian.Uint16(msg[off+8:]))
+	}
+	if off > len(msg) {
+		return nil, errMalformed
+	}
+	return
+}
+
+// udpSize returns the largest UDP answer the sender of query accepts,
+// as advertised by its EDNS OPT pseudo-record
+func udpSize(query []byte, q question) int {
+	rr := int(binary.BigEndian.Uint16(query[6:])) +
+		int(binary.BigEndian.Uint16(query[8:])) +
+		int(binary.BigEndian.Uint16(query[10:]))
+	off := q.end
+	for i := 0; i < rr; i++ {
+		var err error
+		if off, err = skipName(query, off); err != nil || off+10 > len(query) {
+			break
+		}
+		if binary.BigEndian.Uint16(query[off:]) == typeOPT {
+			if size := int(binary.BigEndian.Uint16(query[off+2:])); size > minUDPSize {
+				return size
+			}
+			break
+		}
+		off += 10 + int(binary.BigEndian.Uint16(query[off+8:]))
+	}
+	return minUDPSize
+}
+
+func rcode(msg []byte) int {
+	return int(binary.BigEndian.Uint16(msg[2:]) & 0xF)
+}
+
+func truncated(msg []byte) bool {
+	return binary.BigEndian.Uint16(msg[2:])&flagTC != 0
+}
+
+// reply builds an authoritative answer to query holding the given addresses
+func reply(query []byte, q question, code int, ips []net.IP, ttl uint32) []byte {
+	msg := make([]byte, q.end, q.end+len(ips)*28)
+	copy(msg, query[:q.end])
+
+	flags := binary.BigEndian.Uint16(query[2:])
+	flags = flags&(0xF<<11|flagRD) | flagQR | flagAA | flagRA | uint16(code)
+	binary.BigEndian.PutUint16(msg[2:], flags)
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(ips)))
+	binary.BigEndian.PutUint16(msg[8:], 0)
+	binary.BigEndian.PutUint16(msg[10:], 0)
+
+	for _, ip := range ips {
+		rdata := []byte(ip.To4())
+		if q.Type == typeAAAA {
+			rdata = ip.To16()
+		}
+		rr := make([]byte, 12)
+		// pointer to the question name
+		binary.BigEndian.PutUint16(rr[0:], 0xC000|headerLen)
+		binary.BigEndian.PutUint16(rr[2:], q.Type)
+		binary.BigEndian.PutUint16(rr[4:], classIN)
+		binary.BigEndian.PutUint32(rr[6:], ttl)
+		binary.BigEndian.PutUint16(rr[10:], uint16(len(rdata)))
+		msg = append(msg, rr...)
+		msg = append(msg, rdata...)
+	}
+	return msg
+}
@@ -0,0 +1,215 @@
+package forwarder
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+// query builds a query for name with the given extra records
+func query(name string, typ uint16, records ...[]byte) []byte {
+	msg := make([]byte, headerLen)
+	binary.BigEndian.PutUint16(msg, 0x1234)
+	binary.BigEndian.PutUint16(msg[2:], flagRD)
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	binary.BigEndian.PutUint16(msg[10:], uint16(len(records)))
+	msg = append(msg, encodeName(name)...)
+	msg = append(msg, byte(typ>>8), byte(typ), 0, classIN)
+	for _, r := range records {
+		msg = append(msg, r...)
+	}
+	return msg
+}
+
+func encodeName(name string) (b []byte) {
+	for _, label := range strings.Split(name, ".") {
+		if label != "" {
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0)
+}
+
+// opt builds an EDNS OPT pseudo-record advertising size
+func opt(size uint16) []byte {
+	return []byte{0, 0, typeOPT, byte(size >> 8), byte(size), 0, 0, 0, 0, 0, 0}
+}
+
+// record builds a record named by a pointer to the question
+func record(typ uint16, ttl uint32, rdata []byte) []byte {
+	r := make([]byte, 12, 12+len(rdata))
+	binary.BigEndian.PutUint16(r, 0xC000|headerLen)
+	binary.BigEndian.PutUint16(r[2:], typ)
+	binary.BigEndian.PutUint16(r[4:], classIN)
+	binary.BigEndian.PutUint32(r[6:], ttl)
+	binary.BigEndian.PutUint16(r[10:], uint16(len(rdata)))
+	return append(r, rdata...)
+}
+
+// answer builds an upstream answer to q holding the given records
+// in the answer section
+func answer(q []byte, code int, records ...[]byte) []byte {
+	msg := append([]byte{}, q...)
+	binary.BigEndian.PutUint16(msg[2:], flagQR|flagRD|flagRA|uint16(code))
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(records)))
+	for _, r := range records {
+		msg = append(msg, r...)
+	}
+	return msg
+}
+
+func TestParseQuestion(t *testing.T) {
+	valid := query("Host.example.com", typeAAAA)
+	twice := query("example.com", typeA)
+	twice[5] = 2
+	tests := []struct {
+		name string
+		msg  []byte
+		want question
+		err  bool
+	}{
+		{"valid", valid, question{"Host.example.com", typeAAAA, classIN, len(valid)}, false},
+		{"root", query("", typeA), question{"", typeA, classIN, headerLen + 5}, false},
+		{"edns", query("example.com", typeA, opt(4096)), question{"example.com", typeA, classIN, len(query("example.com", typeA))}, false},
+		{"empty", nil, question{}, true},
+		{"short header", valid[:headerLen-1], question{}, true},
+		{"no name", valid[:headerLen], question{}, true},
+		{"truncated label", valid[:headerLen+3], question{}, true},
+		{"no terminator", valid[:headerLen+len(encodeName("Host.example.com"))-1], question{}, true},
+		{"truncated type", valid[:len(valid)-1], question{}, true},
+		{"two questions", twice, question{}, true},
+		{"label too long", append(query("", typeA)[:headerLen], 0x3F, 'a', 0), question{}, true},
+		{"pointer", append(query("", typeA)[:headerLen], 0xC0, headerLen, 0, typeA, 0, classIN), question{}, true},
+		{"reserved label", append(query("", typeA)[:headerLen], 0x41, 'a', 0, 0, typeA, 0, classIN), question{}, true},
+	}
+	for _, test := range tests {
+		got, err := parseQuestion(test.msg)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: got %+v, expecting an error", test.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %+v, expecting %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTTLOffsets(t *testing.T) {
+	q := query("example.com", typeA)
+	a := answer(q, rcodeNoError, record(typeA, 300, []byte{10, 0, 0, 1}), record(typeA, 60, []byte{10, 0, 0, 2}))
+	// a pointer to itself is skipped without being followed
+	loop := answer(q, rcodeNoError, record(typeA, 300, []byte{10, 0, 0, 1}))
+	binary.BigEndian.PutUint16(loop[len(q):], 0xC000|uint16(len(q)))
+	withOPT := answer(q, rcodeNoError, record(typeA, 300, []byte{10, 0, 0, 1}))
+	binary.BigEndian.PutUint16(withOPT[10:], 1)
+	withOPT = append(withOPT, opt(1232)...)
+	truncatedPointer := answer(q, rcodeNoError)
+	binary.BigEndian.PutUint16(truncatedPointer[6:], 1)
+	truncatedPointer = append(truncatedPointer, 0xC0)
+	reserved := answer(q, rcodeNoError)
+	binary.BigEndian.PutUint16(reserved[6:], 1)
+	reserved = append(reserved, 0x80, 0, 0, typeA, 0, classIN, 0, 0, 0, 0, 0, 0)
+
+	tests := []struct {
+		name string
+		msg  []byte
+		want []int
+		err  bool
+	}{
+		{"answers", a, []int{len(q) + 6, len(q) + 22}, false},
+		{"none", answer(q, rcodeNXDomain), nil, false},
+		{"pointer loop", loop, []int{len(q) + 6}, false},
+		{"opt", withOPT, []int{len(q) + 6}, false},
+		{"short header", a[:headerLen-1], nil, true},
+		{"truncated question", a[:len(q)-2], nil, true},
+		{"truncated record", a[:len(a)-1], nil, true},
+		{"truncated header", a[:len(q)+8], nil, true},
+		{"truncated pointer", truncatedPointer, nil, true},
+		{"reserved label", reserved, nil, true},
+	}
+	for _, test := range tests {
+		got, err := ttlOffsets(test.msg)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: got %v, expecting an error", test.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v, expecting %v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got %v, expecting %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestUDPSize(t *testing.T) {
+	truncated := query("example.com", typeA, opt(4096))
+	truncated = truncated[:len(truncated)-4]
+	tests := []struct {
+		name string
+		msg  []byte
+		want int
+	}{
+		{"no edns", query("example.com", typeA), minUDPSize},
+		{"edns", query("example.com", typeA, opt(4096)), 4096},
+		{"below minimum", query("example.com", typeA, opt(256)), minUDPSize},
+		{"truncated", truncated, minUDPSize},
+		{"after a record", query("example.com", typeA, record(typeA, 0, []byte{10, 0, 0, 1}), opt(1232)), 1232},
+	}
+	for _, test := range tests {
+		q, err := parseQuestion(test.msg)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if got := udpSize(test.msg, q); got != test.want {
+			t.Errorf("%s: got %d, expecting %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		typ   uint16
+		ips   []net.IP
+		rdata int
+	}{
+		{"a", typeA, []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}, 4},
+		{"aaaa", typeAAAA, []net.IP{net.ParseIP("fd00::1")}, 16},
+		{"empty", typeA, nil, 0},
+	}
+	for _, test := range tests {
+		msg := query("host.lan", test.typ)
+		q, _ := parseQuestion(msg)
+		resp := reply(msg, q, rcodeNoError, test.ips, localTTL)
+		if binary.BigEndian.Uint16(resp) != 0x1234 || binary.BigEndian.Uint16(resp[2:])&(flagQR|flagAA|flagRD) != flagQR|flagAA|flagRD {
+			t.Errorf("%s: got header %x", test.name, resp[:4])
+		}
+		if len(resp) != len(msg)+len(test.ips)*(12+test.rdata) {
+			t.Errorf("%s: got %d bytes", test.name, len(resp))
+		}
+		offsets, err := ttlOffsets(resp)
+		if err != nil || len(offsets) != len(test.ips) {
+			t.Errorf("%s: got TTLs at %v, %v", test.name, offsets, err)
+		}
+	}
+}
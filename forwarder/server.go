@@ -0,0 +1,298 @@
+package forwarder
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	dnsPort         = "53"
+	localTTL        = 60
+	upstreamTimeout = 2 * time.Second
+	maxMessageSize  = 65535
+	// maxUDPQueries caps the UDP queries answered at once, the next ones
+	// waiting in the socket buffer
+	maxUDPQueries = 256
+)
+
+// Stats are the counters exposed on the API
+type Stats struct {
+	Queries     uint64 `json:"queries"`
+	Local       uint64 `json:"local"`
+	CacheHits   uint64 `json:"cache_hits"`
+	CacheMisses uint64 `json:"cache_misses"`
+	Failures    uint64 `json:"failures"`
+	Entries     int    `json:"entries"`
+	Size        int    `json:"size"`
+}
+
+type server struct {
+	handler *Handler
+	listen  []string
+	cache   *cache
+	udp     []net.PacketConn
+	tcp     []net.Listener
+	// pending holds a token per UDP query being answered
+	pending chan struct{}
+
+	queries  uint64
+	local    uint64
+	hits     uint64
+	misses   uint64
+	failures uint64
+}
+
+// listenAddr appends the DNS port to addresses given without one
+func listenAddr(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(addr, dnsPort)
+}
+
+func newServer(h *Handler, listen []string, size int) (s *server, err error) {
+	s = &server{handler: h, cache: newCache(size), pending: make(chan struct{}, maxUDPQueries)}
+	for _, addr := range listen {
+		addr = listenAddr(addr)
+		s.listen = append(s.listen, addr)
+
+		pc, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		s.udp = append(s.udp, pc)
+
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		s.tcp = append(s.tcp, ln)
+	}
+	for _, pc := range s.udp {
+		go s.serveUDP(pc)
+	}
+	for _, ln := range s.tcp {
+		go s.serveTCP(ln)
+	}
+	return s, nil
+}
+
+func (s *server) close() {
+	for _, pc := range s.udp {
+		pc.Close()
+	}
+	for _, ln := range s.tcp {
+		ln.Close()
+	}
+}
+
+func (s *server) stats() Stats {
+	return Stats{
+		Queries:     atomic.LoadUint64(&s.queries),
+		Local:       atomic.LoadUint64(&s.local),
+		CacheHits:   atomic.LoadUint64(&s.hits),
+		CacheMisses: atomic.LoadUint64(&s.misses),
+		Failures:    atomic.LoadUint64(&s.failures),
+		Entries:     s.cache.len(),
+		Size:        s.cache.size,
+	}
+}
+
+func (s *server) serveUDP(pc net.PacketConn) {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		query := make([]byte, n)
+		copy(query, buf[:n])
+		s.pending <- struct{}{}
+		go func() {
+			defer func() { <-s.pending }()
+			if resp := s.handle(query, "udp"); resp != nil {
+				pc.WriteTo(resp, addr)
+			}
+		}()
+	}
+}
+
+func (s *server) serveTCP(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			for {
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				query, err := readTCP(conn)
+				if err != nil {
+					return
+				}
+				resp := s.handle(query, "tcp")
+				if resp == nil {
+					return
+				}
+				if err := writeTCP(conn, resp); err != nil {
+					return
+				}
+			}
+		}(conn)
+	}
+}
+
+func readTCP(r io.Reader) ([]byte, error) {
+	l := make([]byte, 2)
+	if _, err := io.ReadFull(r, l); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(l))
+	_, err := io.ReadFull(r, msg)
+	return msg, err
+}
+
+func writeTCP(w io.Writer, msg []byte) error {
+	l := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(l, uint16(len(msg)))
+	_, err := w.Write(append(l, msg...))
+	return err
+}
+
+// handle answers a query from local records, the cache or the upstreams
+func (s *server) handle(query []byte, network string) []byte {
+	q, err := parseQuestion(query)
+	if err != nil {
+		log.WithError(err).Debug("Forwarder: dropping query")
+		return nil
+	}
+	atomic.AddUint64(&s.queries, 1)
+
+	if ips, ok := s.handler.lookup(q.Name); ok {
+		atomic.AddUint64(&s.local, 1)
+		return reply(query, q, rcodeNoError, filter(ips, q), localTTL)
+	}
+
+	// answers are cached by the size they fit in, as UDP clients
+	// without EDNS do not accept more than 512 bytes
+	size := maxMessageSize
+	if network == "udp" {
+		size = udpSize(query, q)
+	}
+	key := q.key(size)
+	now := time.Now()
+	if resp := s.cache.get(key, binary.BigEndian.Uint16(query), now); resp != nil {
+		atomic.AddUint64(&s.hits, 1)
+		return resp
+	}
+	atomic.AddUint64(&s.misses, 1)
+
+	resp, err := s.forward(query, network)
+	if err != nil {
+		atomic.AddUint64(&s.failures, 1)
+		log.WithError(err).Warnf("Forwarder: %s", q.Name)
+		return reply(query, q, rcodeServFail, nil, 0)
+	}
+	s.cache.put(key, resp, now)
+	return resp
+}
+
+// filter keeps the addresses matching the question type
+func filter(ips []net.IP, q question) (res []net.IP) {
+	if q.Class != classIN {
+		return
+	}
+	for _, ip := range ips {
+		switch {
+		case q.Type == typeA && ip.To4() != nil:
+			res = append(res, ip)
+		case q.Type == typeAAAA && ip.To4() == nil:
+			res = append(res, ip)
+		}
+	}
+	return
+}
+
+// forward tries each upstream in turn until one answers
+func (s *server) forward(query []byte, network string) (resp []byte, err error) {
+	upstreams, err := s.handler.Upstreams()
+	if err != nil {
+		return nil, err
+	}
+	err = errors.New("no upstream available")
+	for _, upstream := range upstreams {
+		addr := net.JoinHostPort(upstream, dnsPort)
+		if s.isSelf(addr) {
+			continue
+		}
+		if resp, err = exchange(query, network, addr); err == nil {
+			return
+		}
+	}
+	return nil, err
+}
+
+// isSelf detects upstreams pointing back to the forwarder
+func (s *server) isSelf(upstream string) bool {
+	uhost, uport, _ := net.SplitHostPort(upstream)
+	uip := net.ParseIP(uhost)
+	for _, addr := range s.listen {
+		host, port, _ := net.SplitHostPort(addr)
+		if port != uport {
+			continue
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || ip.IsUnspecified() {
+			if uip != nil && uip.IsLoopback() {
+				return true
+			}
+			continue
+		}
+		if ip.Equal(uip) {
+			return true
+		}
+	}
+	return false
+}
+
+func exchange(query []byte, network string, addr string) ([]byte, error) {
+	conn, err := net.DialTimeout(network, addr, upstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(upstreamTimeout))
+
+	var resp []byte
+	if network == "tcp" {
+		if err = writeTCP(conn, query); err != nil {
+			return nil, err
+		}
+		if resp, err = readTCP(conn); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err = conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, maxMessageSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		resp = buf[:n]
+	}
+	if len(resp) < headerLen || binary.BigEndian.Uint16(resp) != binary.BigEndian.Uint16(query) {
+		return nil, errMalformed
+	}
+	return resp, nil
+}
@@ -0,0 +1,43 @@
+package gateway
+
+import (
+	"net"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/guilhem/tentacool/linkwatch"
+)
+
+// Backend reads and applies routes of the system
+type Backend interface {
+	Routes() ([]netlink.Route, error)
+	SetDefault(ip string, link string) error
+}
+
+// NetlinkBackend manages kernel routes with netlink
+type NetlinkBackend struct{}
+
+// Routes returns the routes of every family
+func (NetlinkBackend) Routes() ([]netlink.Route, error) {
+	return netlink.RouteList(nil, netlink.FAMILY_ALL)
+}
+
+// SetDefault replaces the default route
+func (NetlinkBackend) SetDefault(ip string, linkName string) error {
+	log.Printf("Set default gateway %s on %s", ip, linkName)
+	gw := net.ParseIP(ip)
+	if gw == nil {
+		return &net.ParseError{Type: "IP address", Text: ip}
+	}
+	route := &netlink.Route{Gw: gw}
+	if linkName != "" {
+		link, err := linkwatch.ByName(linkName)
+		if err != nil {
+			return err
+		}
+		route.LinkIndex = link.Attrs().Index
+	}
+	return netlink.RouteReplace(route)
+}
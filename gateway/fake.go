@@ -0,0 +1,39 @@
+package gateway
+
+import (
+	"net"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+)
+
+// FakeBackend keeps routes in memory instead of the kernel, for tests
+type FakeBackend struct {
+	sync.Mutex
+	RouteList []netlink.Route
+	// Default is the gateway IP and link last set
+	Default [2]string
+	// Err is returned by every operation when set
+	Err error
+}
+
+// Routes returns RouteList
+func (f *FakeBackend) Routes() ([]netlink.Route, error) {
+	f.Lock()
+	defer f.Unlock()
+	return f.RouteList, f.Err
+}
+
+// SetDefault records the default gateway
+func (f *FakeBackend) SetDefault(ip string, link string) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	if net.ParseIP(ip) == nil {
+		return &net.ParseError{Type: "IP address", Text: ip}
+	}
+	f.Default = [2]string{ip, link}
+	return nil
+}
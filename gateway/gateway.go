@@ -2,15 +2,16 @@ package gateway
 
 import (
 	"encoding/json"
-	"fmt"
-	"net/http"
-	"os/exec"
-	"strings"
+	"net"
 
 	log "github.com/Sirupsen/logrus"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/boltdb/bolt"
+
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/linkwatch"
+	"github.com/guilhem/tentacool/types"
 )
 
 const (
@@ -18,23 +19,40 @@ const (
 	defaultKey   = "default"
 )
 
-var db *bolt.DB
+// Handler serves the routes API
+type Handler struct {
+	DB      *bolt.DB
+	Backend Backend
+}
+
+type gatewayStruct = types.Gateway
 
-type gatewayStruct struct {
-	IP   string `json:"ip"`
-	Link string `json:"link"`
+// Gateway is the default route
+type Gateway = gatewayStruct
+
+// GetRoutes returns the routing table
+func (h *Handler) GetRoutes(w rest.ResponseWriter, req *rest.Request) {
+	routes, err := h.Backend.Routes()
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(routes)
 }
 
 // PostGateway apply the given gateway to the network
-func PostGateway(w rest.ResponseWriter, req *rest.Request) {
+func (h *Handler) PostGateway(w rest.ResponseWriter, req *rest.Request) {
 	gateway := gatewayStruct{}
 	if err := req.DecodeJsonPayload(&gateway); err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, apierror.BadRequest(err))
+		return
+	}
+	if net.ParseIP(gateway.IP) == nil {
+		apierror.Write(w, apierror.Invalid("ip", "Invalid IP %s", gateway.IP))
 		return
 	}
 
-	db.Update(func(tx *bolt.Tx) (err error) {
+	err := h.DB.Update(func(tx *bolt.Tx) (err error) {
 		b := tx.Bucket([]byte(routesBucket))
 		data, err := json.Marshal(gateway)
 		if err != nil {
@@ -44,44 +62,101 @@ func PostGateway(w rest.ResponseWriter, req *rest.Request) {
 		err = b.Put([]byte(defaultKey), []byte(data))
 		return
 	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
 
-	if err := addDefaultGw(gateway.IP, gateway.Link); err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := h.Backend.SetDefault(gateway.IP, gateway.Link); err != nil {
+		apierror.NotApplied(w, gateway, err)
 		return
 	}
 	w.WriteJson(gateway)
 }
 
 // GetGateway returns the list of all gateways
-func GetGateway(w rest.ResponseWriter, req *rest.Request) {
+func (h *Handler) GetGateway(w rest.ResponseWriter, req *rest.Request) {
 	gateway := gatewayStruct{}
-	err := db.View(func(tx *bolt.Tx) (err error) {
+	err := h.DB.View(func(tx *bolt.Tx) (err error) {
 		tmp := tx.Bucket([]byte(routesBucket)).Get([]byte(defaultKey))
 		if tmp == nil {
-			err = fmt.Errorf("ItemNotFound: Could not find gateway")
+			err = apierror.NotFound("Could not find gateway")
 			return
 		}
 		err = json.Unmarshal(tmp, &gateway)
 		return
 	})
 	if err != nil {
-		log.Printf(err.Error())
-		code := http.StatusInternalServerError
-		if strings.Contains(err.Error(), "ItemNotFound") {
-			code = http.StatusNotFound
-		}
-		rest.Error(w, err.Error(), code)
+		apierror.Write(w, err)
 		return
 	}
 	log.Printf("Requested Gateways list : %s", gateway)
 	w.WriteJson(gateway)
 }
 
+// Restore applies to the system the change of the routes bucket
+// from one content to another, the database already holding the latter.
+// A gateway no longer managed is left as is.
+func (h *Handler) Restore(from, to map[string][]byte) (err error) {
+	v, ok := to[defaultKey]
+	if !ok {
+		return
+	}
+	gateway := gatewayStruct{}
+	if err = json.Unmarshal(v, &gateway); err != nil {
+		return
+	}
+	return h.setDefault(gateway)
+}
+
+// setDefault applies the gateway, one on a link not present
+// being pending until the link appears
+func (h *Handler) setDefault(gateway gatewayStruct) error {
+	err := h.Backend.SetDefault(gateway.IP, gateway.Link)
+	if linkwatch.IsAbsent(err) {
+		log.Printf("Gateway %s pending until %s appears", gateway.IP, gateway.Link)
+		return nil
+	}
+	return err
+}
+
+// get returns the gateway stored, if any
+func (h *Handler) get() (gateway *gatewayStruct) {
+	h.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(routesBucket))
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(defaultKey)); v != nil {
+			gateway = &gatewayStruct{}
+			return json.Unmarshal(v, gateway)
+		}
+		return nil
+	})
+	return
+}
+
+// LinkAdded applies the gateway pending on the link
+func (h *Handler) LinkAdded(name string) {
+	if gateway := h.get(); gateway != nil && gateway.Link == name {
+		if err := h.Backend.SetDefault(gateway.IP, gateway.Link); err != nil {
+			log.WithError(err).Errorf("Can't apply gateway %s to %s", gateway.IP, name)
+			return
+		}
+		log.Printf("Applied pending gateway %s to %s", gateway.IP, name)
+	}
+}
+
+// LinkRemoved only logs, the kernel dropping the routes of the link
+func (h *Handler) LinkRemoved(name string) {
+	if gateway := h.get(); gateway != nil && gateway.Link == name {
+		log.Printf("Gateway %s pending until %s comes back", gateway.IP, name)
+	}
+}
+
 // DBinit initializes the gateway database at startup
-func DBinit(d *bolt.DB) (err error) {
-	db = d
-	err = db.Update(func(tx *bolt.Tx) (err error) {
+func (h *Handler) DBinit() (err error) {
+	err = h.DB.Update(func(tx *bolt.Tx) (err error) {
 		_, err = tx.CreateBucketIfNotExists([]byte(routesBucket))
 		return
 	})
@@ -90,28 +165,19 @@ func DBinit(d *bolt.DB) (err error) {
 	}
 
 	log.Printf("Reinstall previous gateway from DB")
-	err = db.View(func(tx *bolt.Tx) (err error) {
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
 		b := tx.Bucket([]byte(routesBucket))
 		gateway := gatewayStruct{}
 		v := b.Get([]byte(defaultKey))
 		if v != nil {
 			if err := json.Unmarshal(v, &gateway); err != nil {
-				log.Printf(err.Error())
+				log.Print(err)
 			}
-			if err := addDefaultGw(gateway.IP, gateway.Link); err != nil {
-				log.Printf(err.Error())
+			if err := h.setDefault(gateway); err != nil {
+				log.Print(err)
 			}
 		}
 		return
 	})
 	return
 }
-
-func addDefaultGw(ip string, linkName string) (err error) {
-	err = exec.Command("sh", "-c", fmt.Sprintf("/sbin/route add default gw %s %s", ip, linkName)).Run()
-	if err != nil && !strings.Contains(err.Error(), "exit status 7") {
-		log.Printf(err.Error())
-		return err
-	}
-	return nil
-}
@@ -0,0 +1,162 @@
+package hostname
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/boltdb/bolt"
+
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/hosts"
+	"github.com/guilhem/tentacool/types"
+)
+
+const (
+	hostnameBucket = "hostname"
+	key            = "hostname"
+	// hostsID is the managed hosts entry resolving the hostname
+	hostsID = "hostname"
+	// hostsIP follows the Debian convention for the local hostname
+	hostsIP = "127.0.1.1"
+)
+
+// HostnamePath is the file read by the system at boot
+var HostnamePath = "/etc/hostname"
+
+var (
+	validLabel = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+	validName  = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*$`)
+)
+
+// Handler serves the hostname API
+type Handler struct {
+	DB *bolt.DB
+	// Hosts maintains the hosts entry of the hostname
+	Hosts *hosts.Handler
+}
+
+type hostnameStruct = types.Hostname
+
+// Hostname is the hostname of the system
+type Hostname = hostnameStruct
+
+func fqdn(hostname hostnameStruct) string {
+	if hostname.Domain == "" {
+		return hostname.Hostname
+	}
+	return hostname.Hostname + "." + hostname.Domain
+}
+
+// GetHostname returns the hostname registered in DB, or the kernel one
+func (h *Handler) GetHostname(w rest.ResponseWriter, req *rest.Request) {
+	hostname := hostnameStruct{}
+	err := h.DB.View(func(tx *bolt.Tx) (err error) {
+		tmp := tx.Bucket([]byte(hostnameBucket)).Get([]byte(key))
+		if tmp != nil {
+			err = json.Unmarshal(tmp, &hostname)
+			return
+		}
+		hostname.Hostname, err = os.Hostname()
+		return
+	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(hostname)
+}
+
+// PutHostname sets and registers the hostname
+func (h *Handler) PutHostname(w rest.ResponseWriter, req *rest.Request) {
+	hostname := hostnameStruct{}
+	if err := req.DecodeJsonPayload(&hostname); err != nil {
+		apierror.Write(w, apierror.BadRequest(err))
+		return
+	}
+	if !validLabel.MatchString(hostname.Hostname) {
+		apierror.Write(w, apierror.Invalid("hostname", "Invalid hostname %s", hostname.Hostname))
+		return
+	}
+	if hostname.Domain != "" && !validName.MatchString(hostname.Domain) {
+		apierror.Write(w, apierror.Invalid("domain", "Invalid domain %s", hostname.Domain))
+		return
+	}
+
+	err := h.DB.Update(func(tx *bolt.Tx) (err error) {
+		data, err := json.Marshal(hostname)
+		if err != nil {
+			return
+		}
+		log.Printf("Updating key %s with value %s", key, data)
+		return tx.Bucket([]byte(hostnameBucket)).Put([]byte(key), data)
+	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+
+	if err := h.setHostname(hostname); err != nil {
+		apierror.NotApplied(w, hostname, err)
+		return
+	}
+	w.WriteJson(hostname)
+}
+
+// setHostname applies the hostname to the kernel, /etc/hostname and /etc/hosts
+func (h *Handler) setHostname(hostname hostnameStruct) error {
+	log.Printf("Set hostname: %s", fqdn(hostname))
+	if err := syscall.Sethostname([]byte(hostname.Hostname)); err != nil {
+		return err
+	}
+	if err := hosts.WriteAtomic(HostnamePath, []byte(hostname.Hostname+"\n"), 0644); err != nil {
+		return err
+	}
+	if !hostname.Hosts {
+		return h.Hosts.Remove(hostsID)
+	}
+	names := []string{hostname.Hostname}
+	if hostname.Domain != "" {
+		names = []string{fqdn(hostname), hostname.Hostname}
+	}
+	return h.Hosts.Set(hostsID, hostsIP, names)
+}
+
+// DBinit initializes the hostname database at startup,
+// hosts DB must be initialized first
+func (h *Handler) DBinit() (err error) {
+	err = h.DB.Update(func(tx *bolt.Tx) (err error) {
+		_, err = tx.CreateBucketIfNotExists([]byte(hostnameBucket))
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Reinstall previous hostname from DB")
+	hostname := hostnameStruct{}
+	found := false
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
+		v := tx.Bucket([]byte(hostnameBucket)).Get([]byte(key))
+		if v != nil {
+			found = true
+			err = json.Unmarshal(v, &hostname)
+		}
+		return
+	})
+	if err != nil {
+		log.Print(err)
+		return nil
+	}
+	// hosts are updated in their own transaction
+	if found {
+		if err := h.setHostname(hostname); err != nil {
+			log.Print(err)
+		}
+	}
+	return nil
+}
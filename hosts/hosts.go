@@ -0,0 +1,375 @@
+package hosts
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/boltdb/bolt"
+
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/dbutil"
+	"github.com/guilhem/tentacool/types"
+)
+
+const (
+	hostsBucket = "hosts"
+	beginMarker = "# BEGIN tentacool managed block, do not edit"
+	endMarker   = "# END tentacool managed block"
+)
+
+// HostsPath is the hosts file holding the managed block
+var HostsPath = "/etc/hosts"
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*$`)
+
+// Handler serves the hosts API
+type Handler struct {
+	DB *bolt.DB
+}
+
+type hostStruct = types.Host
+
+// Host is an entry of the managed block of /etc/hosts
+type Host = hostStruct
+
+func validate(host hostStruct) error {
+	if net.ParseIP(host.IP) == nil {
+		return apierror.Invalid("ip", "Invalid IP %s", host.IP)
+	}
+	if len(host.Names) == 0 {
+		return apierror.Invalid("names", "Names are empty")
+	}
+	for _, name := range host.Names {
+		if !validName.MatchString(name) {
+			return apierror.Invalid("names", "Invalid name %s", name)
+		}
+	}
+	return nil
+}
+
+// GetHosts returns all managed hosts entries
+func (h *Handler) GetHosts(w rest.ResponseWriter, req *rest.Request) {
+	hosts, err := h.list()
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(hosts)
+}
+
+// GetHost returns the hosts entry with the specified ID
+func (h *Handler) GetHost(w rest.ResponseWriter, req *rest.Request) {
+	id := req.PathParam("host")
+	host := hostStruct{}
+	err := h.DB.View(func(tx *bolt.Tx) (err error) {
+		tmp := tx.Bucket([]byte(hostsBucket)).Get([]byte(id))
+		if tmp == nil {
+			err = apierror.NotFound("Could not find host for %s in db", id)
+			return
+		}
+		err = json.Unmarshal(tmp, &host)
+		return
+	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(host)
+}
+
+// PostHost registers a new hosts entry
+func (h *Handler) PostHost(w rest.ResponseWriter, req *rest.Request) {
+	host := hostStruct{}
+	if err := req.DecodeJsonPayload(&host); err != nil {
+		apierror.Write(w, apierror.BadRequest(err))
+		return
+	}
+	if err := validate(host); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	err := h.DB.Update(func(tx *bolt.Tx) (err error) {
+		b := tx.Bucket([]byte(hostsBucket))
+		if host.ID == "" {
+			if host.ID, err = dbutil.NextID(b); err != nil {
+				return err
+			}
+		} else {
+			if _, err := strconv.ParseUint(host.ID, 10, 64); err == nil {
+				return apierror.Invalid("id", "ID is an integer")
+			}
+			if h := b.Get([]byte(host.ID)); h != nil {
+				return apierror.Conflict("id", "ID exists")
+			}
+		}
+		data, err := json.Marshal(host)
+		if err != nil {
+			return
+		}
+		return b.Put([]byte(host.ID), data)
+	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+
+	if err := h.writeHosts(); err != nil {
+		apierror.NotApplied(w, host, err)
+		return
+	}
+	apierror.Created(w, req.URL.Path+"/"+host.ID, host)
+}
+
+// PutHost modify the existing hosts entry with the specified ID
+func (h *Handler) PutHost(w rest.ResponseWriter, req *rest.Request) {
+	host := hostStruct{}
+	if err := req.DecodeJsonPayload(&host); err != nil {
+		apierror.Write(w, apierror.BadRequest(err))
+		return
+	}
+	host.ID = req.PathParam("host")
+	if err := validate(host); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	if err := h.put(host); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+
+	if err := h.writeHosts(); err != nil {
+		apierror.NotApplied(w, host, err)
+		return
+	}
+	w.WriteJson(host)
+}
+
+// DeleteHost deletes the hosts entry with the specified ID
+func (h *Handler) DeleteHost(w rest.ResponseWriter, req *rest.Request) {
+	id := req.PathParam("host")
+	err := h.DB.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(hostsBucket)).Get([]byte(id)) == nil {
+			return apierror.NotFound("Could not find host for %s in db", id)
+		}
+		return nil
+	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	if err := h.Remove(id); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Set registers or replaces the hosts entry with the specified ID
+func (h *Handler) Set(id string, ip string, names []string) error {
+	host := hostStruct{ID: id, IP: ip, Names: names}
+	if err := validate(host); err != nil {
+		return err
+	}
+	if err := h.put(host); err != nil {
+		return err
+	}
+	return h.writeHosts()
+}
+
+// Remove deletes the hosts entry with the specified ID
+func (h *Handler) Remove(id string) error {
+	err := h.DB.Update(func(tx *bolt.Tx) (err error) {
+		return tx.Bucket([]byte(hostsBucket)).Delete([]byte(id))
+	})
+	if err != nil {
+		return err
+	}
+	return h.writeHosts()
+}
+
+// put stores the hosts entry, refusing to create one with an integer
+// ID which NextSequence could allocate later
+func (h *Handler) put(host hostStruct) error {
+	return h.DB.Update(func(tx *bolt.Tx) (err error) {
+		b := tx.Bucket([]byte(hostsBucket))
+		if b.Get([]byte(host.ID)) == nil {
+			if _, err := strconv.ParseUint(host.ID, 10, 64); err == nil {
+				return apierror.Invalid("id", "ID is an integer")
+			}
+		}
+		data, err := json.Marshal(host)
+		if err != nil {
+			return
+		}
+		log.Printf("Updating key %s with value %s", host.ID, data)
+		return b.Put([]byte(host.ID), data)
+	})
+}
+
+func (h *Handler) list() (hosts []hostStruct, err error) {
+	hosts = []hostStruct{}
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
+		return tx.Bucket([]byte(hostsBucket)).ForEach(func(k, v []byte) (err error) {
+			host := hostStruct{}
+			if err = json.Unmarshal(v, &host); err != nil {
+				return
+			}
+			hosts = append(hosts, host)
+			return
+		})
+	})
+	return
+}
+
+// writeHosts regenerates the managed block of the hosts file from DB
+func (h *Handler) writeHosts() error {
+	hosts, err := h.list()
+	if err != nil {
+		return err
+	}
+
+	var block []string
+	if len(hosts) > 0 {
+		block = append(block, beginMarker)
+		for _, host := range hosts {
+			block = append(block, host.IP+"\t"+strings.Join(host.Names, " "))
+		}
+		block = append(block, endMarker)
+	}
+
+	fi, err := os.Stat(HostsPath)
+	mode := os.FileMode(0644)
+	var lines []string
+	switch {
+	case err == nil:
+		mode = fi.Mode().Perm()
+		if lines, err = readUnmanaged(HostsPath); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	var buf bytes.Buffer
+	written := false
+	for _, line := range lines {
+		// the block keeps its place among unmanaged lines
+		if line == beginMarker {
+			if !written {
+				for _, l := range block {
+					fmt.Fprintln(&buf, l)
+				}
+			}
+			written = true
+			continue
+		}
+		fmt.Fprintln(&buf, line)
+	}
+	if !written {
+		for _, l := range block {
+			fmt.Fprintln(&buf, l)
+		}
+	}
+
+	log.Printf("Writing %d managed entries in %s", len(hosts), HostsPath)
+	return WriteAtomic(HostsPath, buf.Bytes(), mode)
+}
+
+// readUnmanaged returns the lines of path, with the managed block
+// replaced by its begin marker
+func readUnmanaged(path string) (lines []string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	inBlock := false
+	var managed []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == beginMarker && !inBlock:
+			inBlock = true
+			managed = nil
+			lines = append(lines, line)
+		case line == endMarker && inBlock:
+			inBlock = false
+		case inBlock:
+			managed = append(managed, line)
+		default:
+			lines = append(lines, line)
+		}
+	}
+	// an unterminated block is kept rather than clobbering what follows
+	if inBlock {
+		lines = append(lines, managed...)
+	}
+	return lines, scanner.Err()
+}
+
+// WriteAtomic replaces path by a temporary file renamed over it, so
+// a crash never leaves it half written
+func WriteAtomic(path string, data []byte, mode os.FileMode) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	if err = os.Chmod(tmp.Name(), mode); err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// DBinit initializes the hosts database at startup
+func (h *Handler) DBinit() (err error) {
+	err = h.DB.Update(func(tx *bolt.Tx) (err error) {
+		_, err = tx.CreateBucketIfNotExists([]byte(hostsBucket))
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	hosts, err := h.list()
+	if err != nil {
+		return err
+	}
+	if len(hosts) > 0 {
+		log.Printf("Reinstall previous hosts from DB")
+		if err := h.writeHosts(); err != nil {
+			log.Print(err)
+		}
+	}
+	return nil
+}
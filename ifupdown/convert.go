@@ -0,0 +1,159 @@
+package ifupdown
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/guilhem/tentacool/apply"
+)
+
+// cidr joins an address with its netmask, given as a mask or a length
+func cidr(address, netmask string) (string, error) {
+	if _, _, err := net.ParseCIDR(address); err == nil {
+		return address, nil
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", fmt.Errorf("invalid address %s", address)
+	}
+	if netmask == "" {
+		return "", fmt.Errorf("address %s without netmask", address)
+	}
+	if ones, err := strconv.Atoi(netmask); err == nil {
+		return fmt.Sprintf("%s/%d", ip, ones), nil
+	}
+	mask := net.ParseIP(netmask)
+	if mask == nil || mask.To4() == nil {
+		return "", fmt.Errorf("invalid netmask %s", netmask)
+	}
+	ones, bits := net.IPMask(mask.To4()).Size()
+	if bits == 0 {
+		return "", fmt.Errorf("non-contiguous netmask %s", netmask)
+	}
+	return fmt.Sprintf("%s/%d", ip, ones), nil
+}
+
+// handled are the options File takes over or reports on its own
+var handled = map[string]bool{
+	"address":         true,
+	"netmask":         true,
+	"gateway":         true,
+	"mtu":             true,
+	"dns-nameservers": true,
+	"dns-nameserver":  true,
+	"dns-search":      true,
+	"vlan-raw-device": true,
+	"vlan_raw_device": true,
+	"bridge_ports":    true,
+	"bridge-ports":    true,
+}
+
+// File converts the interfaces to a declarative file, returning the
+// directives it can't take over. Only the sections found are set.
+func (interfaces *Interfaces) File() (f apply.File, unsupported []Directive) {
+	unsupported = append(unsupported, interfaces.Unsupported...)
+	auto := map[string]bool{}
+	for _, name := range interfaces.Auto {
+		auto[name] = true
+	}
+
+	var addrs []apply.Address
+	ids := map[string]bool{}
+	links := map[string]*apply.Link{}
+	var order []string
+	var dns *apply.DNS
+	up := true
+	for _, iface := range interfaces.Ifaces {
+		report := func(line int, text, reason string) {
+			unsupported = append(unsupported, Directive{line, iface.Name, text, reason})
+		}
+		if iface.Family != "inet" && iface.Family != "inet6" {
+			report(iface.Line, "iface "+iface.Name+" "+iface.Family, "family not managed")
+			continue
+		}
+		if iface.Method == "loopback" {
+			continue
+		}
+
+		if links[iface.Name] == nil && (auto[iface.Name] || iface.MTU != "") {
+			links[iface.Name] = &apply.Link{Name: iface.Name}
+			if auto[iface.Name] {
+				links[iface.Name].Up = &up
+			}
+			order = append(order, iface.Name)
+		}
+		if iface.MTU != "" {
+			if mtu, err := strconv.Atoi(iface.MTU); err == nil {
+				links[iface.Name].MTU = mtu
+			} else {
+				report(iface.Line, "mtu "+iface.MTU, err.Error())
+			}
+		}
+		if iface.VlanRawDevice != "" {
+			report(iface.Line, "vlan-raw-device "+iface.VlanRawDevice, "VLANs must exist before tentacool starts")
+		}
+		if len(iface.BridgePorts) > 0 {
+			report(iface.Line, "bridge_ports "+strings.Join(iface.BridgePorts, " "), "bridges must exist before tentacool starts")
+		}
+
+		switch iface.Method {
+		case "static":
+			address, err := cidr(iface.Address, iface.Netmask)
+			if err != nil {
+				report(iface.Line, "iface "+iface.Name+" static", err.Error())
+				break
+			}
+			// "eth0:1" aliases are addresses of eth0
+			link := strings.SplitN(iface.Name, ":", 2)[0]
+			id := strings.Replace(iface.Name, ":", "-", -1)
+			for base, n := id, 2; ids[id]; n++ {
+				id = fmt.Sprintf("%s-%d", base, n)
+			}
+			ids[id] = true
+			addrs = append(addrs, apply.Address{ID: id, Link: link, IP: address})
+			if iface.Gateway != "" {
+				if f.Routes == nil {
+					f.Routes = &apply.Routes{Gateway: &apply.Gateway{IP: iface.Gateway, Link: link}}
+				} else {
+					report(iface.Line, "gateway "+iface.Gateway, "a single default gateway is managed")
+				}
+			}
+		case "dhcp":
+			if f.DHCP == nil {
+				f.DHCP = &apply.DHCP{Active: true, Interface: iface.Name}
+			} else {
+				report(iface.Line, "iface "+iface.Name+" dhcp", "a single DHCP client is managed")
+			}
+		case "manual":
+		default:
+			report(iface.Line, "iface "+iface.Name+" "+iface.Method, "method not managed")
+		}
+
+		if len(iface.DNSNameservers) > 0 || len(iface.DNSSearch) > 0 {
+			if dns == nil {
+				dns = &apply.DNS{}
+			}
+			dns.Servers = append(dns.Servers, iface.DNSNameservers...)
+			dns.Search = append(dns.Search, iface.DNSSearch...)
+		}
+
+		for _, o := range iface.Options {
+			if !handled[o.Name] {
+				report(o.Line, o.Name+" "+o.Value, "unsupported directive")
+			}
+		}
+	}
+
+	sort.SliceStable(unsupported, func(i, j int) bool { return unsupported[i].Line < unsupported[j].Line })
+	for _, name := range order {
+		f.Links = append(f.Links, *links[name])
+	}
+	if addrs != nil {
+		f.Addresses = &addrs
+	}
+	f.DNS = dns
+	return
+}
@@ -0,0 +1,150 @@
+// Package ifupdown reads the /etc/network/interfaces files of ifupdown
+package ifupdown
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Option is a line of an iface stanza
+type Option struct {
+	Line  int
+	Name  string
+	Value string
+}
+
+// Iface is an iface stanza
+type Iface struct {
+	Line   int
+	Name   string
+	Family string
+	Method string
+	// Options are in file order, the ones known being parsed below
+	Options []Option
+
+	Address        string
+	Netmask        string
+	Gateway        string
+	MTU            string
+	DNSNameservers []string
+	DNSSearch      []string
+	VlanRawDevice  string
+	BridgePorts    []string
+}
+
+// Directive is a line tentacool can't take over
+type Directive struct {
+	Line   int
+	Iface  string
+	Text   string
+	Reason string
+}
+
+func (d Directive) String() string {
+	if d.Iface != "" {
+		return fmt.Sprintf("line %d, iface %s: %s (%s)", d.Line, d.Iface, d.Text, d.Reason)
+	}
+	return fmt.Sprintf("line %d: %s (%s)", d.Line, d.Text, d.Reason)
+}
+
+// Interfaces is the content of an interfaces file
+type Interfaces struct {
+	// Auto are the interfaces brought up at boot
+	Auto   []string
+	Ifaces []*Iface
+	// Unsupported are the lines not parsed into Ifaces
+	Unsupported []Directive
+}
+
+// lines returns the logical lines of r, joining continuations and
+// dropping comments, along with the number of their first line
+func lines(r io.Reader) (numbers []int, texts []string, err error) {
+	scanner := bufio.NewScanner(r)
+	n, start := 0, 0
+	current := ""
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+		if current == "" {
+			start = n
+			if strings.HasPrefix(strings.TrimSpace(line), "#") {
+				continue
+			}
+		}
+		if strings.HasSuffix(line, "\\") {
+			current += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		current += line
+		if text := strings.TrimSpace(current); text != "" {
+			numbers = append(numbers, start)
+			texts = append(texts, text)
+		}
+		current = ""
+	}
+	return numbers, texts, scanner.Err()
+}
+
+// Parse reads an interfaces file
+func Parse(r io.Reader) (*Interfaces, error) {
+	numbers, texts, err := lines(r)
+	if err != nil {
+		return nil, err
+	}
+	interfaces := &Interfaces{}
+	var iface *Iface
+	for i, text := range texts {
+		line := numbers[i]
+		fields := strings.Fields(text)
+		keyword := fields[0]
+		switch {
+		case keyword == "auto" || keyword == "allow-auto":
+			interfaces.Auto = append(interfaces.Auto, fields[1:]...)
+			iface = nil
+		case strings.HasPrefix(keyword, "allow-"):
+			interfaces.Unsupported = append(interfaces.Unsupported, Directive{line, "", text, "hotplug not managed"})
+			iface = nil
+		case keyword == "iface":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("line %d: iface NAME FAMILY METHOD expected", line)
+			}
+			iface = &Iface{Line: line, Name: fields[1], Family: fields[2], Method: fields[3]}
+			interfaces.Ifaces = append(interfaces.Ifaces, iface)
+		case keyword == "mapping" || keyword == "source" || keyword == "source-directory":
+			interfaces.Unsupported = append(interfaces.Unsupported, Directive{line, "", text, "not followed"})
+			iface = nil
+		case iface == nil:
+			interfaces.Unsupported = append(interfaces.Unsupported, Directive{line, "", text, "outside of an iface stanza"})
+		default:
+			iface.option(Option{line, keyword, strings.Join(fields[1:], " ")})
+		}
+	}
+	return interfaces, nil
+}
+
+// option adds an option to the stanza, parsing the known ones
+func (iface *Iface) option(o Option) {
+	iface.Options = append(iface.Options, o)
+	switch o.Name {
+	case "address":
+		iface.Address = o.Value
+	case "netmask":
+		iface.Netmask = o.Value
+	case "gateway":
+		iface.Gateway = o.Value
+	case "mtu":
+		iface.MTU = o.Value
+	case "dns-nameservers", "dns-nameserver":
+		iface.DNSNameservers = append(iface.DNSNameservers, strings.Fields(o.Value)...)
+	case "dns-search":
+		iface.DNSSearch = append(iface.DNSSearch, strings.Fields(o.Value)...)
+	case "vlan-raw-device", "vlan_raw_device":
+		iface.VlanRawDevice = o.Value
+	case "bridge_ports", "bridge-ports":
+		if o.Value != "none" {
+			iface.BridgePorts = strings.Fields(o.Value)
+		}
+	}
+}
@@ -2,30 +2,28 @@ package interfaces
 
 import (
 	"net"
-	"net/http"
-
-	log "github.com/Sirupsen/logrus"
 
 	"github.com/ant0ine/go-json-rest/rest"
+
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/types"
 )
 
-type interfaceStruct struct {
-	Name         string `json:"link"`
-	HardwareAddr string `json:"hardwareaddr"`
-	MTU          int    `json:"mtu"`
-}
+type interfaceStruct = types.Interface
 
-type addressStruct struct {
-	IP   string `json:"ip"`
-	Mask string `json:"mask"`
-}
+// Interface is a network interface
+type Interface = interfaceStruct
+
+type addressStruct = types.InterfaceAddress
+
+// Address is an address of a network interface
+type Address = addressStruct
 
 // GetIfaces returns the list of all network interfaces
 func GetIfaces(w rest.ResponseWriter, req *rest.Request) {
 	dumbInterfaces, err := net.Interfaces()
 	if err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, err)
 		return
 	}
 	interfaces := make([]interfaceStruct, len(dumbInterfaces))
@@ -41,14 +39,12 @@ func GetIfaces(w rest.ResponseWriter, req *rest.Request) {
 func GetIface(w rest.ResponseWriter, req *rest.Request) {
 	iface, err := net.InterfaceByName(req.PathParam("iface"))
 	if err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, apierror.NotFound("%s", err))
 		return
 	}
 	dumbAddresses, err := iface.Addrs()
 	if err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, err)
 		return
 	}
 	addresses := make([]addressStruct, len(dumbAddresses))
@@ -0,0 +1,118 @@
+// Package linkwatch tells when network interfaces appear and disappear,
+// for the objects stored on links not present yet to be applied later
+package linkwatch
+
+import (
+	"fmt"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/vishvananda/netlink"
+)
+
+// AbsentError is returned for a link that doesn't exist
+type AbsentError string
+
+func (e AbsentError) Error() string {
+	return fmt.Sprintf("Link %s not found", string(e))
+}
+
+// IsAbsent tells if err is an AbsentError
+func IsAbsent(err error) bool {
+	_, ok := err.(AbsentError)
+	return ok
+}
+
+// ByName is netlink.LinkByName, returning an AbsentError
+// when the link doesn't exist
+func ByName(name string) (netlink.Link, error) {
+	link, err := netlink.LinkByName(name)
+	// the only error netlink has for ENODEV
+	if err != nil && err.Error() == "Link not found" {
+		return nil, AbsentError(name)
+	}
+	return link, err
+}
+
+// Listener is told about links appearing and disappearing,
+// a rename being both
+type Listener interface {
+	LinkAdded(name string)
+	LinkRemoved(name string)
+}
+
+// Watcher calls its listeners on link changes
+type Watcher struct {
+	Listeners []Listener
+	done      chan struct{}
+}
+
+// Start watches the links until Stop is called
+func (w *Watcher) Start() error {
+	updates := make(chan netlink.LinkUpdate)
+	w.done = make(chan struct{})
+	if err := netlink.LinkSubscribe(updates, w.done); err != nil {
+		return err
+	}
+	// listed once subscribed, not to miss a link appearing meanwhile
+	links, err := netlink.LinkList()
+	if err != nil {
+		w.Stop()
+		return err
+	}
+	names := map[int32]string{}
+	for _, link := range links {
+		names[int32(link.Attrs().Index)] = link.Attrs().Name
+	}
+	go w.run(updates, names)
+	return nil
+}
+
+// Stop stops watching the links
+func (w *Watcher) Stop() {
+	if w.done != nil {
+		close(w.done)
+		w.done = nil
+	}
+}
+
+// run follows the updates, names holding the links by index
+func (w *Watcher) run(updates <-chan netlink.LinkUpdate, names map[int32]string) {
+	for update := range updates {
+		name := update.Link.Attrs().Name
+		old, known := names[update.Index]
+		switch update.Header.Type {
+		case syscall.RTM_NEWLINK:
+			if known && old == name {
+				continue
+			}
+			if known {
+				w.removed(old)
+			}
+			names[update.Index] = name
+			w.added(name)
+		case syscall.RTM_DELLINK:
+			if !known {
+				continue
+			}
+			delete(names, update.Index)
+			w.removed(old)
+		}
+	}
+	log.Warn("Stopped watching links")
+}
+
+func (w *Watcher) added(name string) {
+	log.Printf("Link %s appeared", name)
+	for _, l := range w.Listeners {
+		l.LinkAdded(name)
+	}
+}
+
+func (w *Watcher) removed(name string) {
+	log.Printf("Link %s disappeared", name)
+	for _, l := range w.Listeners {
+		l.LinkRemoved(name)
+	}
+}
@@ -0,0 +1,100 @@
+package migrations
+
+import (
+	"fmt"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	metaBucket = "meta"
+	schemaKey  = "schema"
+)
+
+// Migration upgrades the DB from the previous schema version
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx *bolt.Tx) error
+}
+
+// migrations are applied in order, each in its own transaction.
+// Never change a released one, append a new version instead.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "track the schema version of the original buckets",
+		Up: func(tx *bolt.Tx) (err error) {
+			for _, name := range []string{"address", "dhcp", "dns", "routes"} {
+				if _, err = tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+					return
+				}
+			}
+			return
+		},
+	},
+}
+
+// Latest is the schema version of this tentacool
+func Latest() int {
+	return migrations[len(migrations)-1].Version
+}
+
+func version(tx *bolt.Tx) (v int, err error) {
+	b := tx.Bucket([]byte(metaBucket))
+	if b == nil {
+		return 0, nil
+	}
+	data := b.Get([]byte(schemaKey))
+	if data == nil {
+		return 0, nil
+	}
+	if v, err = strconv.Atoi(string(data)); err != nil {
+		return 0, fmt.Errorf("invalid schema version %q", data)
+	}
+	return
+}
+
+// Version returns the schema version of the DB, 0 before migrations
+func Version(db *bolt.DB) (v int, err error) {
+	err = db.View(func(tx *bolt.Tx) (err error) {
+		v, err = version(tx)
+		return
+	})
+	return
+}
+
+// Run upgrades the DB to the latest schema version. A DB written by a
+// newer tentacool is refused rather than misread.
+func Run(db *bolt.DB) (err error) {
+	current, err := Version(db)
+	if err != nil {
+		return
+	}
+	if current > Latest() {
+		return fmt.Errorf("DB schema version %d is newer than supported %d", current, Latest())
+	}
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		log.Printf("Migrating DB to schema version %d: %s", m.Version, m.Description)
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			if err = m.Up(tx); err != nil {
+				return
+			}
+			b, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+			if err != nil {
+				return
+			}
+			return b.Put([]byte(schemaKey), []byte(strconv.Itoa(m.Version)))
+		})
+		if err != nil {
+			return fmt.Errorf("migration to schema version %d: %s", m.Version, err)
+		}
+	}
+	return
+}
@@ -0,0 +1,133 @@
+package migrations
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// fixture holds the buckets of a DB written by an older tentacool,
+// values being stored as they are in the file, compacted
+type fixture map[string]map[string]json.RawMessage
+
+// open returns a DB filled with the fixture testdata/name.json
+func open(t *testing.T, name string) (db *bolt.DB, f fixture, cleanup func()) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "tentacool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err = bolt.Open(filepath.Join(dir, "db"), 0600, nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	cleanup = func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for name, values := range f {
+			b, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			for k, v := range values {
+				var buf bytes.Buffer
+				if err := json.Compact(&buf, v); err != nil {
+					return err
+				}
+				if err := b.Put([]byte(k), buf.Bytes()); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestRun(t *testing.T) {
+	for _, name := range []string{"v0", "v0-address-only", "v1"} {
+		db, f, cleanup := open(t, name)
+		for i := 0; i < 2; i++ {
+			if err := Run(db); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+		}
+		if v, err := Version(db); err != nil || v != Latest() {
+			t.Errorf("%s: got version %d, %v, expecting %d", name, v, err, Latest())
+		}
+		err := db.View(func(tx *bolt.Tx) error {
+			for _, bucket := range []string{"address", "dhcp", "dns", "routes"} {
+				if tx.Bucket([]byte(bucket)) == nil {
+					t.Errorf("%s: missing bucket %s", name, bucket)
+				}
+			}
+			// the values are kept as they are
+			for bucket, values := range f {
+				if bucket == metaBucket {
+					continue
+				}
+				for k, v := range values {
+					var buf bytes.Buffer
+					json.Compact(&buf, v)
+					if got := tx.Bucket([]byte(bucket)).Get([]byte(k)); !bytes.Equal(got, buf.Bytes()) {
+						t.Errorf("%s: %s/%s is %s, expecting %s", name, bucket, k, got, buf.Bytes())
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		cleanup()
+	}
+}
+
+func TestRunRefuses(t *testing.T) {
+	for _, name := range []string{"newer", "invalid"} {
+		db, _, cleanup := open(t, name)
+		if err := Run(db); err == nil {
+			t.Errorf("%s: expecting an error", name)
+		}
+		// left untouched
+		err := db.View(func(tx *bolt.Tx) error {
+			if tx.Bucket([]byte("address")) != nil {
+				t.Errorf("%s: buckets were created", name)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		cleanup()
+	}
+}
+
+func TestLatest(t *testing.T) {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d, versions must follow each other", i, m.Version)
+		}
+		if m.Description == "" || m.Up == nil {
+			t.Errorf("migration %d is incomplete", m.Version)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"github.com/guilhem/tentacool/apierror"
+)
+
+// Version of the OpenAPI specification followed by the document
+const Version = "3.0.0"
+
+// Operation is a route of the API along with the types it exchanges
+type Operation struct {
+	Method string
+	// Path is relative to the prefix of the document, with ":param"
+	// segments and an optional custom method suffix, like "/addresses:batch"
+	Path    string
+	Summary string
+	// ID defaults to the name of the handler
+	ID      string
+	Handler rest.HandlerFunc
+	Query   []Parameter
+	// Body is a value of the type of the request body, nil without body
+	Body interface{}
+	// Status of success, http.StatusOK by default
+	Status int
+	// Response is a value of the type of the response, nil without body
+	Response interface{}
+	// MediaType of the response, "application/json" by default
+	MediaType string
+	// Alternates are other media types of the body, or of the response
+	// without body, with the same schema. Bodies of these types are left
+	// to the handler.
+	Alternates []string
+}
+
+// Parameter is a query parameter of an operation
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// Info describes the API
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *requestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]response `json:"responses"`
+}
+
+type components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// Document is the OpenAPI document of the operations
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components components                       `json:"components"`
+
+	prefix     string
+	operations []Operation
+	// names of the components, by type
+	names map[reflect.Type]string
+}
+
+var pathParam = regexp.MustCompile(`/:([^/]+)`)
+
+// customMethod is the ":verb" ending a path, the router taking it
+// for a placeholder named verb
+var customMethod = regexp.MustCompile(`[^/]:([^/]+)$`)
+
+const defaultMediaType = "application/json"
+
+func content(media string, s *Schema) map[string]mediaType {
+	return map[string]mediaType{media: {Schema: s}}
+}
+
+// handlerName is the name of the function or method serving an operation
+func handlerName(f rest.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// New documents the operations served under prefix, along with the
+// operation serving the document at prefix + "/openapi.json".
+// Schemas names the components of the types of its values, the others
+// being named after their type.
+func New(info Info, prefix string, schemas map[string]interface{}, operations []Operation) (d *Document, err error) {
+	d = &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      map[string]map[string]*operation{},
+		Components: components{Schemas: map[string]*Schema{}},
+		prefix:     prefix,
+		names:      map[reflect.Type]string{},
+	}
+	d.operations = append(append([]Operation{}, operations...), Operation{
+		Method:   http.MethodGet,
+		Path:     "/openapi.json",
+		Summary:  "This document",
+		ID:       "GetOpenAPI",
+		Handler:  d.GetDocument,
+		Response: json.RawMessage{},
+	})
+	for name, v := range schemas {
+		d.names[reflect.TypeOf(v)] = name
+	}
+	d.component(reflect.TypeOf(apierror.Error{}))
+
+	ids := map[string]bool{}
+	for i, op := range d.operations {
+		if op.ID == "" {
+			d.operations[i].ID = handlerName(op.Handler)
+			op.ID = d.operations[i].ID
+		}
+		if ids[op.ID] {
+			return nil, fmt.Errorf("duplicate operation %s", op.ID)
+		}
+		ids[op.ID] = true
+
+		path := pathParam.ReplaceAllString(prefix+op.Path, "/{$1}")
+		if d.Paths[path] == nil {
+			d.Paths[path] = map[string]*operation{}
+		}
+		d.Paths[path][strings.ToLower(op.Method)] = d.operation(op)
+	}
+	return
+}
+
+func (d *Document) operation(op Operation) *operation {
+	o := &operation{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Responses: map[string]response{
+			"default": {
+				Description: "Error",
+				Content:     content(defaultMediaType, &Schema{Ref: refPrefix + "Error"}),
+			},
+		},
+	}
+	for _, param := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		o.Parameters = append(o.Parameters, Parameter{
+			Name:     param[1],
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	for _, param := range op.Query {
+		param.In = "query"
+		o.Parameters = append(o.Parameters, param)
+	}
+	if op.Body != nil {
+		o.RequestBody = &requestBody{
+			Required: true,
+			Content:  content(defaultMediaType, d.schema(reflect.TypeOf(op.Body))),
+		}
+		for _, media := range op.Alternates {
+			o.RequestBody.Content[media] = o.RequestBody.Content[defaultMediaType]
+		}
+	}
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := response{Description: http.StatusText(status)}
+	if op.Response != nil {
+		media := op.MediaType
+		if media == "" {
+			media = defaultMediaType
+		}
+		success.Content = content(media, d.schema(reflect.TypeOf(op.Response)))
+		for _, alternate := range op.Alternates {
+			if op.Body == nil {
+				success.Content[alternate] = success.Content[media]
+			}
+		}
+	}
+	o.Responses[strconv.Itoa(status)] = success
+	return o
+}
+
+// Routes returns the routes of the operations, requests being
+// validated against the document before reaching the handlers
+func (d *Document) Routes() []*rest.Route {
+	routes := make([]*rest.Route, len(d.operations))
+	for i, op := range d.operations {
+		f := d.validate(op)
+		if m := customMethod.FindStringSubmatch(op.Path); m != nil {
+			f = verb(m[1], f)
+		}
+		routes[i] = &rest.Route{
+			HttpMethod: op.Method,
+			PathExp:    d.prefix + op.Path,
+			Func:       f,
+		}
+	}
+	return routes
+}
+
+// verb serves a custom method only for its exact path, the placeholder
+// the router makes of it matching any suffix of the resource
+func verb(name string, f rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, req *rest.Request) {
+		if req.PathParam(name) != ":"+name {
+			apierror.Write(w, apierror.NotFound("Resource not found"))
+			return
+		}
+		f(w, req)
+	}
+}
+
+// GetDocument returns the OpenAPI document
+func (d *Document) GetDocument(w rest.ResponseWriter, req *rest.Request) {
+	w.WriteJson(d)
+}
@@ -0,0 +1,148 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const refPrefix = "#/components/schemas/"
+
+// Schema is the subset of the OpenAPI schema object describing
+// Go types as encoding/json marshals them
+type Schema struct {
+	Ref        string             `json:"$ref,omitempty"`
+	Type       string             `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Nullable   bool               `json:"nullable,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	// AdditionalProperties is a *Schema, or false for structs
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawType           = reflect.TypeOf(json.RawMessage{})
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schema describes t, structs being referenced as components
+func (d *Document) schema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawType || t.Implements(marshalerType):
+		return &Schema{}
+	case t.Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Ptr:
+		return d.schema(t.Elem())
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte", Nullable: true}
+		}
+		return &Schema{Type: "array", Items: d.schema(t.Elem()), Nullable: true}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: d.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schema(t.Elem()), Nullable: true}
+	case reflect.Struct:
+		return &Schema{Ref: refPrefix + d.component(t)}
+	}
+	// interfaces, or anything else encoding/json can't tell
+	return &Schema{}
+}
+
+// componentName is the name of the type without the "Struct" suffix
+// of the handlers, qualified by its package when already taken
+func (d *Document) componentName(t reflect.Type) string {
+	name := strings.TrimSuffix(t.Name(), "Struct")
+	if name == "" {
+		name = "Object"
+	}
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	name = string(r)
+	for _, taken := range d.names {
+		if taken == name {
+			pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+			r := []rune(pkg)
+			r[0] = unicode.ToUpper(r[0])
+			return string(r) + name
+		}
+	}
+	return name
+}
+
+// component registers the schema of a struct, returning its name
+func (d *Document) component(t reflect.Type) string {
+	name, ok := d.names[t]
+	if !ok {
+		name = d.componentName(t)
+		d.names[t] = name
+	}
+	if _, ok := d.Components.Schemas[name]; ok {
+		return name
+	}
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+	// registered before its fields, which may refer to it
+	d.Components.Schemas[name] = s
+	d.properties(t, s.Properties)
+	return name
+}
+
+// properties adds the fields of a struct as encoding/json sees them
+func (d *Document) properties(t reflect.Type, properties map[string]*Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		options := strings.Split(tag, ",")
+		name := options[0]
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			d.properties(ft, properties)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s := d.schema(f.Type)
+		for _, option := range options[1:] {
+			if option == "string" {
+				s = &Schema{Type: "string"}
+			}
+		}
+		properties[name] = s
+	}
+}
@@ -0,0 +1,176 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"github.com/guilhem/tentacool/apierror"
+)
+
+// validate checks the query parameters and the body of requests
+// against the operation before calling its handler
+func (d *Document) validate(op Operation) rest.HandlerFunc {
+	var body *Schema
+	if op.Body != nil {
+		body = d.schema(reflect.TypeOf(op.Body))
+	}
+	return func(w rest.ResponseWriter, req *rest.Request) {
+		query := req.URL.Query()
+		for _, param := range op.Query {
+			if query.Get(param.Name) == "" {
+				continue
+			}
+			if err := d.checkParam(param, query.Get(param.Name)); err != nil {
+				apierror.Write(w, err)
+				return
+			}
+		}
+		if body != nil && !alternate(op, req) {
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				apierror.Write(w, apierror.BadRequest(err))
+				return
+			}
+			req.Body.Close()
+			if len(data) == 0 {
+				apierror.Write(w, apierror.BadRequest(errors.New("JSON payload is empty")))
+				return
+			}
+			var v interface{}
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.UseNumber()
+			if err := decoder.Decode(&v); err != nil {
+				apierror.Write(w, apierror.BadRequest(err))
+				return
+			}
+			if err := d.check(body, v, ""); err != nil {
+				apierror.Write(w, err)
+				return
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(data))
+		}
+		op.Handler(w, req)
+	}
+}
+
+// alternate tells whether the body of req is of an alternate media
+// type of the operation
+func alternate(op Operation, req *rest.Request) bool {
+	media, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, m := range op.Alternates {
+		if m == media {
+			return true
+		}
+	}
+	return false
+}
+
+// checkParam checks the value of a query parameter
+func (d *Document) checkParam(param Parameter, value string) error {
+	var err error
+	switch param.Schema.Type {
+	case "boolean":
+		_, err = strconv.ParseBool(value)
+	case "integer":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "string":
+		if param.Schema.Format == "date-time" {
+			_, err = time.Parse(time.RFC3339, value)
+		}
+	}
+	if err != nil {
+		return apierror.Invalid(param.Name, "%s", err)
+	}
+	return nil
+}
+
+// kind is the JSON type of a decoded value
+func kind(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "null"
+}
+
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+// check validates a value decoded with json.Decoder.UseNumber, field
+// being its dotted path in the request. As with encoding/json, null
+// is accepted everywhere.
+func (d *Document) check(s *Schema, v interface{}, field string) error {
+	if s.Ref != "" {
+		s = d.Components.Schemas[strings.TrimPrefix(s.Ref, refPrefix)]
+	}
+	if v == nil || s.Type == "" {
+		return nil
+	}
+	got := kind(v)
+	if got != s.Type && !(s.Type == "number" && got == "integer") {
+		return apierror.Invalid(field, "Expected %s, got %s", s.Type, got)
+	}
+
+	switch v := v.(type) {
+	case string:
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				return apierror.Invalid(field, "%s", err)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if err := d.check(s.Items, item, join(field, strconv.Itoa(i))); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			property, ok := s.Properties[k]
+			if !ok {
+				additional, ok := s.AdditionalProperties.(*Schema)
+				if !ok {
+					return apierror.Invalid(join(field, k), "Unknown field")
+				}
+				property = additional
+			}
+			if err := d.check(property, v[k], join(field, k)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Ifupdown renders /etc/network/interfaces, each address having its
+// own stanza. The DNS options need the resolvconf package.
+func Ifupdown(state State) ([]File, error) {
+	links, err := state.links()
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString(header)
+	b.WriteString("\nauto lo\niface lo inet loopback\n")
+	for _, l := range links {
+		// an iface stanza of the link, head being "FAMILY METHOD"
+		type stanza struct {
+			head    string
+			options []string
+		}
+		var stanzas []*stanza
+		if l.DHCP {
+			stanzas = append(stanzas, &stanza{head: "inet dhcp"})
+		}
+		gateway := l.Gateway
+		for _, address := range l.Addresses {
+			s := &stanza{head: family(address) + " static", options: []string{"address " + address}}
+			if gateway != "" && family(gateway) == family(address) {
+				s.options = append(s.options, "gateway "+gateway)
+				gateway = ""
+			}
+			stanzas = append(stanzas, s)
+		}
+		if len(stanzas) == 0 {
+			stanzas = append(stanzas, &stanza{head: "inet manual"})
+		}
+		if gateway != "" {
+			// dhcp and manual stanzas have no gateway option
+			stanzas[0].options = append(stanzas[0].options, fmt.Sprintf("up ip route replace default via %s dev %s", gateway, l.Name))
+		}
+		if l.DNS != nil {
+			if len(l.DNS.Servers) > 0 {
+				stanzas[0].options = append(stanzas[0].options, "dns-nameservers "+strings.Join(l.DNS.Servers, " "))
+			}
+			if len(l.DNS.Search) > 0 {
+				stanzas[0].options = append(stanzas[0].options, "dns-search "+strings.Join(l.DNS.Search, " "))
+			}
+		}
+
+		fmt.Fprintf(&b, "\nauto %s\n", l.Name)
+		for _, s := range stanzas {
+			fmt.Fprintf(&b, "iface %s %s\n", l.Name, s.head)
+			for _, option := range s.options {
+				fmt.Fprintf(&b, "    %s\n", option)
+			}
+		}
+	}
+	return []File{{Path: "/etc/network/interfaces", Content: b.String()}}, nil
+}
+
+type netplanRoute struct {
+	To  string `yaml:"to"`
+	Via string `yaml:"via"`
+}
+
+type netplanNameservers struct {
+	Addresses []string `yaml:"addresses,omitempty"`
+	Search    []string `yaml:"search,omitempty"`
+}
+
+type netplanEthernet struct {
+	DHCP4       bool                `yaml:"dhcp4,omitempty"`
+	Addresses   []string            `yaml:"addresses,omitempty"`
+	Routes      []netplanRoute      `yaml:"routes,omitempty"`
+	Nameservers *netplanNameservers `yaml:"nameservers,omitempty"`
+}
+
+type netplanNetwork struct {
+	Version   int                        `yaml:"version"`
+	Renderer  string                     `yaml:"renderer"`
+	Ethernets map[string]netplanEthernet `yaml:"ethernets,omitempty"`
+}
+
+// Netplan renders a netplan YAML file for the networkd renderer
+func Netplan(state State) ([]File, error) {
+	links, err := state.links()
+	if err != nil {
+		return nil, err
+	}
+	network := netplanNetwork{Version: 2, Renderer: "networkd"}
+	for _, l := range links {
+		e := netplanEthernet{DHCP4: l.DHCP, Addresses: l.Addresses}
+		if l.Gateway != "" {
+			to := "0.0.0.0/0"
+			if family(l.Gateway) == "inet6" {
+				to = "::/0"
+			}
+			e.Routes = []netplanRoute{{To: to, Via: l.Gateway}}
+		}
+		if l.DNS != nil {
+			e.Nameservers = &netplanNameservers{Addresses: l.DNS.Servers, Search: l.DNS.Search}
+		}
+		if network.Ethernets == nil {
+			network.Ethernets = map[string]netplanEthernet{}
+		}
+		network.Ethernets[l.Name] = e
+	}
+	data, err := yaml.Marshal(map[string]netplanNetwork{"network": network})
+	if err != nil {
+		return nil, err
+	}
+	return []File{{Path: "/etc/netplan/60-tentacool.yaml", Content: header + string(data)}}, nil
+}
+
+// Networkd renders a systemd-networkd .network file by link
+func Networkd(state State) ([]File, error) {
+	links, err := state.links()
+	if err != nil {
+		return nil, err
+	}
+	files := []File{}
+	for _, l := range links {
+		var b bytes.Buffer
+		b.WriteString(header)
+		fmt.Fprintf(&b, "\n[Match]\nName=%s\n\n[Network]\n", l.Name)
+		if l.DHCP {
+			b.WriteString("DHCP=ipv4\n")
+		}
+		for _, address := range l.Addresses {
+			fmt.Fprintf(&b, "Address=%s\n", address)
+		}
+		if l.Gateway != "" {
+			fmt.Fprintf(&b, "Gateway=%s\n", l.Gateway)
+		}
+		if l.DNS != nil {
+			for _, server := range l.DNS.Servers {
+				fmt.Fprintf(&b, "DNS=%s\n", server)
+			}
+			if len(l.DNS.Search) > 0 {
+				fmt.Fprintf(&b, "Domains=%s\n", strings.Join(l.DNS.Search, " "))
+			}
+		}
+		files = append(files, File{Path: fmt.Sprintf("/etc/systemd/network/60-tentacool-%s.network", l.Name), Content: b.String()})
+	}
+	return files, nil
+}
@@ -0,0 +1,185 @@
+// Package render writes the configuration stored by tentacool as the
+// files of other network managers, to boot without tentacool
+package render
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/guilhem/dnsconfig"
+
+	"github.com/guilhem/tentacool/addresses"
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/dhcp"
+	"github.com/guilhem/tentacool/gateway"
+	"github.com/guilhem/tentacool/revisions"
+	"github.com/guilhem/tentacool/types"
+)
+
+const header = "# Written by tentacool from its configuration\n"
+
+type fileStruct = types.File
+
+// File is a rendered file
+type File = fileStruct
+
+// State is the configuration rendered
+type State struct {
+	Addresses []addresses.Address
+	Gateway   *gateway.Gateway
+	DNS       *dnsconfig.DnsConfig
+	DHCP      *dhcp.Config
+}
+
+// FromConfig reads the state from the tracked buckets
+func FromConfig(config revisions.Config) (state State, err error) {
+	for _, raw := range config["address"] {
+		a := addresses.Address{}
+		if err = json.Unmarshal(raw, &a); err != nil {
+			return
+		}
+		state.Addresses = append(state.Addresses, a)
+	}
+	sort.Slice(state.Addresses, func(i, j int) bool { return state.Addresses[i].ID < state.Addresses[j].ID })
+	if raw, ok := config["routes"]["default"]; ok {
+		state.Gateway = &gateway.Gateway{}
+		if err = json.Unmarshal(raw, state.Gateway); err != nil {
+			return
+		}
+	}
+	if raw, ok := config["dns"]["dns"]; ok {
+		state.DNS = &dnsconfig.DnsConfig{}
+		if err = json.Unmarshal(raw, state.DNS); err != nil {
+			return
+		}
+	}
+	if raw, ok := config["dhcp"]["active"]; ok {
+		state.DHCP = &dhcp.Config{}
+		if err = json.Unmarshal(raw, state.DHCP); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// link is the configuration of a network interface
+type link struct {
+	Name      string
+	DHCP      bool
+	Addresses []string
+	Gateway   string
+	// DNS is set on a single link
+	DNS *dnsconfig.DnsConfig
+}
+
+// family returns "inet6" for IPv6 addresses, with or without
+// a prefix length, "inet" otherwise
+func family(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		ip, _, _ = net.ParseCIDR(address)
+	}
+	if ip != nil && ip.To4() == nil {
+		return "inet6"
+	}
+	return "inet"
+}
+
+// links groups the state by network interface, sorted by name
+func (state State) links() ([]*link, error) {
+	byName := map[string]*link{}
+	get := func(name string) *link {
+		if byName[name] == nil {
+			byName[name] = &link{Name: name}
+		}
+		return byName[name]
+	}
+	for _, a := range state.Addresses {
+		l := get(a.Link)
+		l.Addresses = append(l.Addresses, a.IP)
+	}
+	if state.DHCP != nil && state.DHCP.Active {
+		get(state.DHCP.Interface).DHCP = true
+	}
+
+	// the gateway and DNS go on the link reaching the gateway,
+	// else on the DHCP link, else on the first one
+	var primary *link
+	if gw := state.Gateway; gw != nil {
+		name := gw.Link
+		if name == "" {
+			ip := net.ParseIP(gw.IP)
+			for _, a := range state.Addresses {
+				if _, network, err := net.ParseCIDR(a.IP); err == nil && network.Contains(ip) {
+					name = a.Link
+					break
+				}
+			}
+		}
+		if name == "" {
+			return nil, apierror.Conflict("link", "No link reaches the gateway %s", gw.IP)
+		}
+		primary = get(name)
+		primary.Gateway = gw.IP
+	}
+
+	links := make([]*link, 0, len(byName))
+	for _, l := range byName {
+		links = append(links, l)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Name < links[j].Name })
+
+	if dns := state.DNS; dns != nil && (len(dns.Servers) > 0 || len(dns.Search) > 0) {
+		if primary == nil && state.DHCP != nil && state.DHCP.Active {
+			primary = byName[state.DHCP.Interface]
+		}
+		if primary == nil && len(links) > 0 {
+			primary = links[0]
+		}
+		if primary == nil {
+			return nil, apierror.Conflict("servers", "No link to carry the DNS servers")
+		}
+		primary.DNS = dns
+	}
+	return links, nil
+}
+
+// Formats are the renderers by name
+var Formats = map[string]func(State) ([]File, error){
+	"ifupdown": Ifupdown,
+	"netplan":  Netplan,
+	"networkd": Networkd,
+}
+
+// Handler serves the render API
+type Handler struct {
+	Revisions *revisions.Handler
+}
+
+// GetRender returns the files of the format in the URL
+func (h *Handler) GetRender(w rest.ResponseWriter, req *rest.Request) {
+	format := req.PathParam("format")
+	renderer, ok := Formats[format]
+	if !ok {
+		apierror.Write(w, apierror.NotFound("Unknown format %s", format))
+		return
+	}
+	config, err := h.Revisions.Current()
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	state, err := FromConfig(config)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	files, err := renderer(state)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(files)
+}
@@ -0,0 +1,83 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guilhem/tentacool/addresses"
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/gateway"
+	"github.com/guilhem/tentacool/revisions"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// TestFormats renders every state of testdata in every format, comparing
+// with testdata/STATE.FORMAT.golden, the files following each other
+// after their path
+func TestFormats(t *testing.T) {
+	states, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range states {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := revisions.Config{}
+		if err := json.Unmarshal(data, &config); err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		state, err := FromConfig(config)
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+
+		for format, renderer := range Formats {
+			files, err := renderer(state)
+			if err != nil {
+				t.Errorf("%s %s: %s", path, format, err)
+				continue
+			}
+			var got bytes.Buffer
+			for _, f := range files {
+				fmt.Fprintf(&got, "==> %s <==\n%s", f.Path, f.Content)
+			}
+
+			golden := strings.TrimSuffix(path, ".json") + "." + format + ".golden"
+			if *update {
+				if err := ioutil.WriteFile(golden, got.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), expected) {
+				t.Errorf("%s differs, got:\n%s", golden, got.Bytes())
+			}
+		}
+	}
+}
+
+func TestUnreachableGateway(t *testing.T) {
+	state := State{
+		Addresses: []addresses.Address{{ID: "1", Link: "eth0", IP: "10.0.0.2/8"}},
+		Gateway:   &gateway.Gateway{IP: "192.168.32.1"},
+	}
+	for format, renderer := range Formats {
+		_, err := renderer(state)
+		if e, ok := err.(*apierror.Error); !ok || e.Code != apierror.CodeConflict {
+			t.Errorf("%s: got %v, expecting a %s error", format, err, apierror.CodeConflict)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package revisions
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/boltdb/bolt"
+
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/auth"
+	"github.com/guilhem/tentacool/types"
+)
+
+const revisionsBucket = "revisions"
+
+// restoreOrder lists the buckets restored first, in order: the links
+// are addressed before the DHCP and DNS configured on them, and before
+// the gateway they reach. Other buckets follow by name.
+var restoreOrder = []string{"address", "pools", "dhcp", "dns", "routes"}
+
+// Restorer applies to the system the change of a bucket
+// from one content to another
+type Restorer interface {
+	Restore(from, to map[string][]byte) error
+}
+
+// Handler numbers the successive configurations and rolls back to them
+type Handler struct {
+	DB *bolt.DB
+	// Restorers are the tracked buckets, by name
+	Restorers map[string]Restorer
+	mu        sync.Mutex
+}
+
+// Config holds the content of the tracked buckets, by bucket and key
+type Config = types.Config
+
+type revisionStruct = types.Revision
+
+// Revision is a numbered configuration
+type Revision = revisionStruct
+
+// Change is a value differing between two configurations
+type Change = types.Change
+
+// names returns the tracked buckets in the order they are restored
+func (h *Handler) names() []string {
+	rank := map[string]int{}
+	for i, name := range restoreOrder {
+		rank[name] = i + 1
+	}
+	names := make([]string, 0, len(h.Restorers))
+	for name := range h.Restorers {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ri, rj := rank[names[i]], rank[names[j]]
+		switch {
+		case ri != 0 && rj != 0:
+			return ri < rj
+		case ri != 0 || rj != 0:
+			return ri != 0
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// snapshot reads the tracked buckets
+func (h *Handler) snapshot(tx *bolt.Tx) Config {
+	config := Config{}
+	for _, name := range h.names() {
+		values := map[string]json.RawMessage{}
+		if b := tx.Bucket([]byte(name)); b != nil {
+			b.ForEach(func(k, v []byte) error {
+				values[string(k)] = append(json.RawMessage{}, v...)
+				return nil
+			})
+		}
+		config[name] = values
+	}
+	return config
+}
+
+// same compares configurations once compacted
+func same(a, b Config) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	return err == nil && string(x) == string(y)
+}
+
+func last(tx *bolt.Tx) (revision revisionStruct, err error) {
+	_, v := tx.Bucket([]byte(revisionsBucket)).Cursor().Last()
+	if v != nil {
+		err = json.Unmarshal(v, &revision)
+	}
+	return
+}
+
+// Commit stores the current configuration as a new revision,
+// unless it didn't change since the last one
+func (h *Handler) Commit(user, method, path string) (revision revisionStruct, err error) {
+	err = h.DB.Update(func(tx *bolt.Tx) (err error) {
+		config := h.snapshot(tx)
+		prev, err := last(tx)
+		if err != nil {
+			return
+		}
+		if prev.N != 0 && same(prev.Config, config) {
+			revision = prev
+			return
+		}
+		b := tx.Bucket([]byte(revisionsBucket))
+		revision = revisionStruct{
+			Time:   time.Now().UTC(),
+			User:   user,
+			Method: method,
+			Path:   path,
+			Config: config,
+		}
+		if revision.N, err = b.NextSequence(); err != nil {
+			return
+		}
+		data, err := json.Marshal(revision)
+		if err != nil {
+			return
+		}
+		log.Printf("Configuration revision %d", revision.N)
+		return b.Put(itob(revision.N), data)
+	})
+	return
+}
+
+// Middleware stores a revision after every successful change, and
+// every change stored but not applied
+func (h *Handler) Middleware() rest.Middleware {
+	return rest.MiddlewareSimple(func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return func(w rest.ResponseWriter, req *rest.Request) {
+			if req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions {
+				handler(w, req)
+				return
+			}
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			var body *apierror.BodyWriter
+			recorded := (&rest.RecorderMiddleware{}).MiddlewareFunc(func(w rest.ResponseWriter, req *rest.Request) {
+				body = &apierror.BodyWriter{ResponseWriter: w}
+				handler(body, req)
+			})
+			recorded(w, req)
+			if status, _ := req.Env["STATUS_CODE"].(int); status < 200 || status >= 300 {
+				if sent, ok := body.Sent(); !ok || sent.Code != apierror.CodeNotApplied {
+					return
+				}
+			}
+			user, _ := req.Env[auth.UserEnv].(string)
+			if _, err := h.Commit(user, req.Method, req.URL.Path); err != nil {
+				log.WithError(err).Error("Can't store configuration revision")
+			}
+		}
+	})
+}
+
+func (h *Handler) get(param string) (revision revisionStruct, err error) {
+	n, err := strconv.ParseUint(param, 10, 64)
+	if err != nil {
+		return revision, apierror.NotFound("Could not find revision %s", param)
+	}
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
+		v := tx.Bucket([]byte(revisionsBucket)).Get(itob(n))
+		if v == nil {
+			return apierror.NotFound("Could not find revision %d", n)
+		}
+		return json.Unmarshal(v, &revision)
+	})
+	return
+}
+
+// GetRevisions returns all revisions, without their configuration
+func (h *Handler) GetRevisions(w rest.ResponseWriter, req *rest.Request) {
+	revisions := []revisionStruct{}
+	err := h.DB.View(func(tx *bolt.Tx) (err error) {
+		return tx.Bucket([]byte(revisionsBucket)).ForEach(func(k, v []byte) (err error) {
+			revision := revisionStruct{}
+			if err = json.Unmarshal(v, &revision); err != nil {
+				return
+			}
+			revision.Config = nil
+			revisions = append(revisions, revision)
+			return
+		})
+	})
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(revisions)
+}
+
+// GetRevision returns the revision with the specified number
+func (h *Handler) GetRevision(w rest.ResponseWriter, req *rest.Request) {
+	revision, err := h.get(req.PathParam("n"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(revision)
+}
+
+// GetDiff returns the values changed from revision n to revision m
+func (h *Handler) GetDiff(w rest.ResponseWriter, req *rest.Request) {
+	from, err := h.get(req.PathParam("n"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	to, err := h.get(req.PathParam("m"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.WriteJson(Diff(from.Config, to.Config))
+}
+
+// Diff returns the values changed from one configuration to another
+func Diff(from, to Config) []Change {
+	changes := []Change{}
+	null := json.RawMessage("null")
+	buckets := map[string]bool{}
+	for name := range from {
+		buckets[name] = true
+	}
+	for name := range to {
+		buckets[name] = true
+	}
+	for name := range buckets {
+		for k, v := range from[name] {
+			if w, ok := to[name][k]; !ok {
+				changes = append(changes, Change{Bucket: name, Key: k, From: v, To: null})
+			} else if string(v) != string(w) {
+				changes = append(changes, Change{Bucket: name, Key: k, From: v, To: w})
+			}
+		}
+		for k, w := range to[name] {
+			if _, ok := from[name][k]; !ok {
+				changes = append(changes, Change{Bucket: name, Key: k, From: null, To: w})
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Bucket != changes[j].Bucket {
+			return changes[i].Bucket < changes[j].Bucket
+		}
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// PostRollback stores the configuration of revision n and applies it
+// to the system, creating a new revision.
+// Failures to apply are reported with apierror.StatusNotApplied.
+func (h *Handler) PostRollback(w rest.ResponseWriter, req *rest.Request) {
+	target, err := h.get(req.PathParam("n"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+
+	applyErr := h.Replace(target.Config)
+	if _, ok := applyErr.(ApplyError); applyErr != nil && !ok {
+		apierror.Write(w, applyErr)
+		return
+	}
+	log.Printf("Rollback to revision %d", target.N)
+
+	user, _ := req.Env[auth.UserEnv].(string)
+	revision, err := h.Commit(user, req.Method, req.URL.Path)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	if applyErr != nil {
+		apierror.NotApplied(w, revision, applyErr)
+		return
+	}
+	w.WriteJson(revision)
+}
+
+// ApplyError lists the subsystems failing to apply a configuration
+// stored by Replace
+type ApplyError []string
+
+func (e ApplyError) Error() string {
+	return strings.Join(e, "; ")
+}
+
+// Current returns the configuration stored in the tracked buckets
+func (h *Handler) Current() (config Config, err error) {
+	err = h.DB.View(func(tx *bolt.Tx) (err error) {
+		config = h.snapshot(tx)
+		return
+	})
+	return
+}
+
+// Replace stores the given configuration in the tracked buckets and
+// applies it to the system. Failures to apply, once stored, are
+// returned as an ApplyError.
+func (h *Handler) Replace(config Config) (err error) {
+	var current Config
+	err = h.DB.Update(func(tx *bolt.Tx) (err error) {
+		current = h.snapshot(tx)
+		for _, name := range h.names() {
+			// emptied rather than recreated, keeping its sequence
+			// for new IDs not to take the ones of deleted entries
+			b, err := tx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return err
+			}
+			var keys [][]byte
+			if err = b.ForEach(func(k, v []byte) error {
+				keys = append(keys, append([]byte{}, k...))
+				return nil
+			}); err != nil {
+				return err
+			}
+			for _, k := range keys {
+				if err = b.Delete(k); err != nil {
+					return err
+				}
+			}
+			for k, v := range config[name] {
+				if err = b.Put([]byte(k), v); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	var errors ApplyError
+	for _, name := range h.names() {
+		if err := h.Restorers[name].Restore(bytesOf(current[name]), bytesOf(config[name])); err != nil {
+			log.Print(err)
+			errors = append(errors, name+": "+err.Error())
+		}
+	}
+	if len(errors) > 0 {
+		sort.Strings(errors)
+		return errors
+	}
+	return nil
+}
+
+func bytesOf(values map[string]json.RawMessage) map[string][]byte {
+	res := map[string][]byte{}
+	for k, v := range values {
+		res[k] = v
+	}
+	return res
+}
+
+// DBinit initializes the revisions database at startup,
+// storing the current configuration as the first revision
+func (h *Handler) DBinit() (err error) {
+	err = h.DB.Update(func(tx *bolt.Tx) (err error) {
+		_, err = tx.CreateBucketIfNotExists([]byte(revisionsBucket))
+		return
+	})
+	if err != nil {
+		return
+	}
+	_, err = h.Commit("", "", "")
+	return
+}
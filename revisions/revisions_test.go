@@ -0,0 +1,54 @@
+package revisions
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// recorder appends its name to restored when restoring
+type recorder struct {
+	name     string
+	restored *[]string
+}
+
+func (r recorder) Restore(from, to map[string][]byte) error {
+	*r.restored = append(*r.restored, r.name)
+	return nil
+}
+
+func TestReplaceOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tentacool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var restored []string
+	h := &Handler{DB: db, Restorers: map[string]Restorer{}}
+	for _, name := range []string{"routes", "hosts", "dns", "dhcp", "pools", "address", "audit"} {
+		h.Restorers[name] = recorder{name: name, restored: &restored}
+	}
+	expected := []string{"address", "pools", "dhcp", "dns", "routes", "audit", "hosts"}
+	// map order is random, a single run could pass by chance
+	for i := 0; i < 10; i++ {
+		restored = nil
+		config := Config{"address": {"1": json.RawMessage(`{}`)}}
+		if err := h.Replace(config); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(restored, expected) {
+			t.Fatalf("restored %v, expecting %v", restored, expected)
+		}
+	}
+}
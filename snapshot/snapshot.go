@@ -0,0 +1,354 @@
+// Package snapshot captures the network state of the kernel and adopts
+// parts of it into the configuration managed by tentacool
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/guilhem/dnsconfig"
+	"github.com/vishvananda/netlink"
+
+	"github.com/guilhem/tentacool/addresses"
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/backup"
+	"github.com/guilhem/tentacool/gateway"
+	"github.com/guilhem/tentacool/revisions"
+	"github.com/guilhem/tentacool/types"
+)
+
+type linkStruct = types.LiveLink
+
+// Link is a live network interface
+type Link = linkStruct
+
+type addressStruct = types.LiveAddress
+
+// Address is a live address
+type Address = addressStruct
+
+type routeStruct = types.LiveRoute
+
+// Route is a live route
+type Route = routeStruct
+
+type ruleStruct = types.LiveRule
+
+// Rule is a live routing rule
+type Rule = ruleStruct
+
+type snapshotStruct = types.Snapshot
+
+// Snapshot is the network state of the kernel
+type Snapshot = snapshotStruct
+
+var scopes = map[int]string{
+	syscall.RT_SCOPE_UNIVERSE: "global",
+	syscall.RT_SCOPE_SITE:     "site",
+	syscall.RT_SCOPE_LINK:     "link",
+	syscall.RT_SCOPE_HOST:     "host",
+	syscall.RT_SCOPE_NOWHERE:  "nowhere",
+}
+
+var families = map[int]string{
+	netlink.FAMILY_V4: "inet",
+	netlink.FAMILY_V6: "inet6",
+}
+
+func scope(s int) string {
+	if name, ok := scopes[s]; ok {
+		return name
+	}
+	return strconv.Itoa(s)
+}
+
+func ipnet(n *net.IPNet) string {
+	if n == nil {
+		return ""
+	}
+	return n.String()
+}
+
+func ip(i net.IP) string {
+	if i == nil {
+		return ""
+	}
+	return i.String()
+}
+
+// Take captures the links, addresses, routes, rules and resolv.conf.
+// Routes are listed from the main table and the tables of the rules.
+func Take() (s Snapshot, err error) {
+	s.Taken = time.Now().UTC()
+	links, err := netlink.LinkList()
+	if err != nil {
+		return
+	}
+	names := map[int]string{}
+	for _, link := range links {
+		attrs := link.Attrs()
+		names[attrs.Index] = attrs.Name
+		s.Links = append(s.Links, Link{
+			Name:         attrs.Name,
+			Index:        attrs.Index,
+			Type:         link.Type(),
+			HardwareAddr: attrs.HardwareAddr.String(),
+			MTU:          attrs.MTU,
+			Up:           attrs.Flags&net.FlagUp != 0,
+		})
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return s, err
+		}
+		for _, a := range addrs {
+			s.Addresses = append(s.Addresses, Address{Link: attrs.Name, IP: a.IPNet.String(), Scope: scope(a.Scope)})
+		}
+	}
+
+	tables := map[int]bool{syscall.RT_TABLE_MAIN: true}
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		rules, err := netlink.RuleList(family)
+		if err != nil {
+			return s, err
+		}
+		for _, r := range rules {
+			// netlink sets -1 for attributes the kernel leaves out,
+			// like the priority 0 of the local table rule
+			if r.Priority < 0 {
+				r.Priority = 0
+			}
+			if r.Mark < 0 {
+				r.Mark = 0
+			}
+			s.Rules = append(s.Rules, Rule{
+				Family:   families[family],
+				Priority: r.Priority,
+				Table:    r.Table,
+				Src:      ipnet(r.Src),
+				Dst:      ipnet(r.Dst),
+				Iif:      r.IifName,
+				Oif:      r.OifName,
+				Mark:     r.Mark,
+			})
+			// the local table only holds the routes of the addresses
+			if r.Table != syscall.RT_TABLE_LOCAL {
+				tables[r.Table] = true
+			}
+		}
+	}
+	ids := make([]int, 0, len(tables))
+	for table := range tables {
+		ids = append(ids, table)
+	}
+	sort.Ints(ids)
+	for _, table := range ids {
+		routes, err := netlink.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{Table: table}, netlink.RT_FILTER_TABLE)
+		if err != nil {
+			return s, err
+		}
+		for _, r := range routes {
+			dst := "default"
+			if r.Dst != nil {
+				dst = r.Dst.String()
+			}
+			s.Routes = append(s.Routes, Route{
+				Dst:      dst,
+				Gateway:  ip(r.Gw),
+				Src:      ip(r.Src),
+				Link:     names[r.LinkIndex],
+				Table:    r.Table,
+				Protocol: r.Protocol,
+				Scope:    scope(int(r.Scope)),
+			})
+		}
+	}
+
+	dns, err := dnsconfig.DnsReadConfig(dnsconfig.ResolvPath)
+	s.DNS = (*types.DNS)(dns)
+	return
+}
+
+// Handler serves the snapshot and adopt API
+type Handler struct {
+	Revisions *revisions.Handler
+}
+
+// managed returns the addresses managed, by link and IP
+func managed(config revisions.Config) (map[[2]string]string, error) {
+	ids := map[[2]string]string{}
+	for id, raw := range config["address"] {
+		a := addresses.Address{}
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return nil, err
+		}
+		ids[[2]string{a.Link, a.IP}] = id
+	}
+	return ids, nil
+}
+
+// GetSnapshot returns the network state of the kernel, marking the
+// addresses managed by tentacool
+func (h *Handler) GetSnapshot(w rest.ResponseWriter, req *rest.Request) {
+	s, err := Take()
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	config, err := h.Revisions.Current()
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	ids, err := managed(config)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	for i, a := range s.Addresses {
+		s.Addresses[i].Managed = ids[[2]string{a.Link, a.IP}]
+	}
+	w.WriteJson(s)
+}
+
+type adoptionStruct = types.Adoption
+
+// Adoption selects the live objects to manage
+type Adoption = adoptionStruct
+
+// Adopt returns the configuration managing the selected live objects
+// on top of the current one
+func Adopt(s Snapshot, current revisions.Config, adoption Adoption) (revisions.Config, error) {
+	config := revisions.Config{}
+	for name, values := range current {
+		config[name] = values
+	}
+
+	live := map[[2]string]bool{}
+	for _, a := range s.Addresses {
+		live[[2]string{a.Link, a.IP}] = true
+	}
+	ids, err := managed(current)
+	if err != nil {
+		return nil, err
+	}
+	if len(adoption.Addresses) > 0 {
+		bucket := map[string]json.RawMessage{}
+		for id, raw := range current["address"] {
+			bucket[id] = raw
+		}
+		config["address"] = bucket
+		for i, a := range adoption.Addresses {
+			field := fmt.Sprintf("addresses.%d", i)
+			addr, n, err := net.ParseCIDR(a.IP)
+			if err != nil {
+				return nil, apierror.Invalid(field+".ip", "%s", err)
+			}
+			// written as listed by the snapshot
+			n.IP = addr
+			a.IP = n.String()
+			key := [2]string{a.Link, a.IP}
+			if !live[key] {
+				return nil, apierror.Invalid(field+".ip", "%s is not on link %s", a.IP, a.Link)
+			}
+			if id, ok := ids[key]; ok {
+				if a.ID != "" && a.ID != id {
+					return nil, apierror.Conflict(field+".ip", "%s is managed as %s", a.IP, id)
+				}
+				continue
+			}
+			if a.ID == "" {
+				a.ID = a.Link
+				for base, n := a.ID, 2; bucket[a.ID] != nil; n++ {
+					a.ID = fmt.Sprintf("%s-%d", base, n)
+				}
+			} else if _, err := strconv.ParseUint(a.ID, 10, 64); err == nil {
+				return nil, apierror.Invalid(field+".id", "ID is an integer")
+			} else if bucket[a.ID] != nil {
+				return nil, apierror.Conflict(field+".id", "ID exists")
+			}
+			data, err := json.Marshal(a)
+			if err != nil {
+				return nil, err
+			}
+			bucket[a.ID] = data
+			ids[key] = a.ID
+		}
+	}
+
+	if adoption.Gateway {
+		var gw *gateway.Gateway
+		for _, r := range s.Routes {
+			if r.Dst == "default" && r.Table == syscall.RT_TABLE_MAIN && r.Gateway != "" && net.ParseIP(r.Gateway).To4() != nil {
+				gw = &gateway.Gateway{IP: r.Gateway, Link: r.Link}
+				break
+			}
+		}
+		if gw == nil {
+			return nil, apierror.Invalid("gateway", "No default route")
+		}
+		data, err := json.Marshal(gw)
+		if err != nil {
+			return nil, err
+		}
+		config["routes"] = map[string]json.RawMessage{"default": data}
+	}
+
+	if adoption.DNS {
+		if s.DNS == nil {
+			return nil, apierror.Invalid("dns", "No resolv.conf")
+		}
+		data, err := json.Marshal(s.DNS)
+		if err != nil {
+			return nil, err
+		}
+		config["dns"] = map[string]json.RawMessage{"dns": data}
+	}
+	return config, nil
+}
+
+// PostAdopt stores the selected live objects in the configuration,
+// only returning the changes it would bring with the "dry_run" query
+// parameter. Applying them again leaves the system as it is.
+func (h *Handler) PostAdopt(w rest.ResponseWriter, req *rest.Request) {
+	adoption := adoptionStruct{}
+	if err := req.DecodeJsonPayload(&adoption); err != nil {
+		apierror.Write(w, apierror.BadRequest(err))
+		return
+	}
+	s, err := Take()
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	current, err := h.Revisions.Current()
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	config, err := Adopt(s, current, adoption)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(req.URL.Query().Get("dry_run"))
+	changes := revisions.Diff(current, config)
+	result := backup.Result{Changes: changes, Applied: !dryRun && len(changes) > 0}
+	if result.Applied {
+		if err := h.Revisions.Replace(config); err != nil {
+			if _, ok := err.(revisions.ApplyError); !ok {
+				apierror.Write(w, err)
+				return
+			}
+			apierror.NotApplied(w, result, err)
+			return
+		}
+	}
+	w.WriteJson(result)
+}
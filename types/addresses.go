@@ -0,0 +1,66 @@
+package types
+
+// Address is an address managed on a link
+type Address struct {
+	ID   string `json:"id"`
+	Link string `json:"link"`
+	IP   string `json:"ip"`
+	// lifetimes in seconds, forever when unset
+	ValidLft     int    `json:"valid_lft,omitempty"`
+	PreferredLft int    `json:"preferred_lft,omitempty"`
+	Label        string `json:"label,omitempty"`
+	Broadcast    string `json:"broadcast,omitempty"`
+	// Peer is the other end of a point-to-point link
+	Peer  string   `json:"peer,omitempty"`
+	Flags []string `json:"flags,omitempty"`
+	// Pool is the pool the IP was allocated from, if any
+	Pool string `json:"pool,omitempty"`
+	// Status is computed from the kernel when returned, never stored
+	Status string `json:"status,omitempty"`
+}
+
+// Neighbor is another host of the network found using an address
+type Neighbor struct {
+	IP           string `json:"ip"`
+	Link         string `json:"link"`
+	HardwareAddr string `json:"hardwareaddr"`
+}
+
+// BatchOperation is an operation of a batch
+type BatchOperation struct {
+	// Op is "create", "update" or "delete"
+	Op string `json:"op"`
+	// Address is the address to create or update, only its ID
+	// being needed to delete it
+	Address Address `json:"address"`
+}
+
+// Batch is a list of operations done all together or not at all
+type Batch struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// PoolUsage is the utilization of a pool
+type PoolUsage struct {
+	// Size is the number of IPs to allocate
+	Size int `json:"size"`
+	Used int `json:"used"`
+	Free int `json:"free"`
+	// Addresses are the IDs of the addresses holding IPs of the pool
+	Addresses []string `json:"addresses"`
+}
+
+// Pool is a range of IPs of a link, allocated to addresses
+type Pool struct {
+	ID   string `json:"id"`
+	Link string `json:"link"`
+	// CIDR is the range of the IPs allocated
+	CIDR string `json:"cidr"`
+	// Prefix is the prefix length of the addresses allocated,
+	// the one of CIDR by default
+	Prefix int `json:"prefix,omitempty"`
+	// Exclude are IPs of the range never allocated, like the gateway
+	Exclude []string `json:"exclude,omitempty"`
+	// Usage is computed when returned, never stored
+	Usage *PoolUsage `json:"usage,omitempty"`
+}
@@ -0,0 +1,30 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// RecordResult is the outcome of an audited change
+type RecordResult struct {
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Record is an entry of the audit log, chained to the previous one
+// by Prev
+type Record struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	User string    `json:"user"`
+	// Pid is the process of a Unix socket peer, from SO_PEERCRED
+	Pid      int32                      `json:"pid,omitempty"`
+	Method   string                     `json:"method"`
+	Path     string                     `json:"path"`
+	Resource string                     `json:"resource"`
+	Before   map[string]json.RawMessage `json:"before"`
+	After    map[string]json.RawMessage `json:"after"`
+	Result   RecordResult               `json:"result"`
+	Prev     string                     `json:"prev"`
+	Hash     string                     `json:"hash,omitempty"`
+}
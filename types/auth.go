@@ -0,0 +1,13 @@
+package types
+
+import "time"
+
+// Token is an API token, its secret only set at creation
+type Token struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash,omitempty"`
+	Created time.Time `json:"created"`
+	// Token is only returned once, at creation
+	Token string `json:"token,omitempty"`
+}
@@ -0,0 +1,46 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Config holds the content of the tracked buckets, by bucket and key
+type Config map[string]map[string]json.RawMessage
+
+// Revision is a numbered configuration
+type Revision struct {
+	N      uint64    `json:"n"`
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Config Config    `json:"config,omitempty"`
+}
+
+// Change is a value differing between two configurations
+type Change struct {
+	Bucket string          `json:"bucket"`
+	Key    string          `json:"key"`
+	From   json.RawMessage `json:"from"`
+	To     json.RawMessage `json:"to"`
+}
+
+// Document is a backup of the configuration
+type Document struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Buckets Config    `json:"buckets"`
+}
+
+// ImportResult is the outcome of an import
+type ImportResult struct {
+	Changes []Change `json:"changes"`
+	Applied bool     `json:"applied"`
+}
+
+// File is a rendered file
+type File struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
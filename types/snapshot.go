@@ -0,0 +1,75 @@
+package types
+
+import "time"
+
+// DNS is the resolver configuration
+type DNS struct {
+	Servers  []string `json:"servers"`
+	Search   []string `json:"search"`
+	Ndots    int      `json:"ndots"`
+	Timeout  int      `json:"timeout"`
+	Attempts int      `json:"attemps"`
+	Rotate   bool     `json:"rotate"`
+}
+
+// LiveLink is a live network interface
+type LiveLink struct {
+	Name         string `json:"name"`
+	Index        int    `json:"index"`
+	Type         string `json:"type"`
+	HardwareAddr string `json:"hardwareaddr"`
+	MTU          int    `json:"mtu"`
+	Up           bool   `json:"up"`
+}
+
+// LiveAddress is a live address
+type LiveAddress struct {
+	Link  string `json:"link"`
+	IP    string `json:"ip"`
+	Scope string `json:"scope"`
+	// Managed is the ID of the address managed by tentacool, if any
+	Managed string `json:"managed,omitempty"`
+}
+
+// LiveRoute is a live route
+type LiveRoute struct {
+	Dst      string `json:"dst"`
+	Gateway  string `json:"gateway,omitempty"`
+	Src      string `json:"src,omitempty"`
+	Link     string `json:"link,omitempty"`
+	Table    int    `json:"table"`
+	Protocol int    `json:"protocol"`
+	Scope    string `json:"scope"`
+}
+
+// LiveRule is a live routing rule
+type LiveRule struct {
+	Family   string `json:"family"`
+	Priority int    `json:"priority"`
+	Table    int    `json:"table"`
+	Src      string `json:"src,omitempty"`
+	Dst      string `json:"dst,omitempty"`
+	Iif      string `json:"iif,omitempty"`
+	Oif      string `json:"oif,omitempty"`
+	Mark     int    `json:"mark,omitempty"`
+}
+
+// Snapshot is the network state of the kernel
+type Snapshot struct {
+	Taken     time.Time     `json:"taken"`
+	Links     []LiveLink    `json:"links"`
+	Addresses []LiveAddress `json:"addresses"`
+	Routes    []LiveRoute   `json:"routes"`
+	Rules     []LiveRule    `json:"rules"`
+	DNS       *DNS          `json:"dns"`
+}
+
+// Adoption selects the live objects to manage
+type Adoption struct {
+	// Addresses are live addresses, an ID being chosen when missing
+	Addresses []Address `json:"addresses"`
+	// Gateway adopts the default route of the main table
+	Gateway bool `json:"gateway"`
+	// DNS adopts resolv.conf
+	DNS bool `json:"dns"`
+}
@@ -0,0 +1,60 @@
+package types
+
+import "net"
+
+// DHCP is the state of the DHCP client
+type DHCP struct {
+	Active    bool   `json:"active"`
+	Interface string `json:"interface"`
+}
+
+// Gateway is the default route
+type Gateway struct {
+	IP   string `json:"ip"`
+	Link string `json:"link"`
+}
+
+// Route is a route of the routing table, with the fields of the
+// kernel route the daemon returns
+type Route struct {
+	LinkIndex  int
+	ILinkIndex int
+	Scope      uint8
+	Dst        *net.IPNet
+	Src        net.IP
+	Gw         net.IP
+	Protocol   int
+	Priority   int
+	Table      int
+	Type       int
+	Tos        int
+	Flags      int
+}
+
+// Hostname is the hostname of the system
+type Hostname struct {
+	Hostname string `json:"hostname"`
+	Domain   string `json:"domain"`
+	// Hosts maintains an /etc/hosts entry for the hostname
+	Hosts bool `json:"hosts"`
+}
+
+// Host is an entry of the managed block of /etc/hosts
+type Host struct {
+	ID    string   `json:"id"`
+	IP    string   `json:"ip"`
+	Names []string `json:"names"`
+}
+
+// Interface is a network interface
+type Interface struct {
+	Name         string `json:"link"`
+	HardwareAddr string `json:"hardwareaddr"`
+	MTU          int    `json:"mtu"`
+}
+
+// InterfaceAddress is an address of a network interface
+type InterfaceAddress struct {
+	IP   string `json:"ip"`
+	Mask string `json:"mask"`
+}
@@ -0,0 +1,50 @@
+// Package types holds the resources exchanged through the REST API,
+// shared by the daemon and its clients. It only depends on the
+// standard library, for clients not to build the daemon.
+package types
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Code identifies the kind of error in responses
+type Code string
+
+// Codes returned by the API
+const (
+	CodeBadRequest   Code = "bad_request"
+	CodeUnauthorized Code = "unauthorized"
+	CodeForbidden    Code = "forbidden"
+	CodeNotFound     Code = "not_found"
+	CodeNotAllowed   Code = "method_not_allowed"
+	CodeConflict     Code = "conflict"
+	CodeInvalid      Code = "invalid"
+	CodeInternal     Code = "internal"
+	// CodeNotApplied is returned when a change is stored but
+	// failed to be applied to the system
+	CodeNotApplied Code = "not_applied"
+)
+
+// StatusNotApplied is the status of a change stored but not applied,
+// the resource being returned along with the error. Being an error
+// status, only the code tells it from a change that was not stored.
+const StatusNotApplied = http.StatusInternalServerError
+
+// Error is the body of every error response
+type Error struct {
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+	// Field is the request field at fault, if any
+	Field string `json:"field,omitempty"`
+	// Resource is the stored resource of a CodeNotApplied error,
+	// or the owner of a CodeConflict one
+	Resource interface{} `json:"resource,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("%s: %s", e.Field, e.Message)
+	}
+	return e.Message
+}
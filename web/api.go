@@ -0,0 +1,296 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/boltdb/bolt"
+	"github.com/vishvananda/netlink"
+
+	"github.com/guilhem/tentacool/addresses"
+	"github.com/guilhem/tentacool/apierror"
+	"github.com/guilhem/tentacool/audit"
+	"github.com/guilhem/tentacool/auth"
+	"github.com/guilhem/tentacool/backup"
+	"github.com/guilhem/tentacool/dhcp"
+	"github.com/guilhem/tentacool/dns"
+	"github.com/guilhem/tentacool/forwarder"
+	"github.com/guilhem/tentacool/gateway"
+	"github.com/guilhem/tentacool/hostname"
+	"github.com/guilhem/tentacool/hosts"
+	"github.com/guilhem/tentacool/interfaces"
+	"github.com/guilhem/tentacool/openapi"
+	"github.com/guilhem/tentacool/render"
+	"github.com/guilhem/tentacool/revisions"
+	"github.com/guilhem/tentacool/snapshot"
+	"github.com/guilhem/tentacool/types"
+)
+
+// Handlers gathers the handlers of every subsystem
+type Handlers struct {
+	Addresses *addresses.Handler
+	Audit     *audit.Handler
+	Auth      *auth.Handler
+	Backup    *backup.Handler
+	DHCP      *dhcp.Handler
+	DNS       *dns.Handler
+	Forwarder *forwarder.Handler
+	Gateway   *gateway.Handler
+	Hostname  *hostname.Handler
+	Hosts     *hosts.Handler
+	Render    *render.Handler
+	Revisions *revisions.Handler
+	Snapshot  *snapshot.Handler
+}
+
+// NewHandlers returns handlers applying changes to the system
+func NewHandlers(db *bolt.DB, dnsBackend dns.Backend) *Handlers {
+	return newHandlers(db, addresses.NetlinkBackend{}, dhcp.DhclientBackend{}, dnsBackend, gateway.NetlinkBackend{})
+}
+
+// NewFakeHandlers returns handlers keeping changes in memory, for tests
+func NewFakeHandlers(db *bolt.DB) *Handlers {
+	return newHandlers(db, addresses.NewFakeBackend(), dhcp.NewFakeBackend(), &dns.FakeBackend{}, &gateway.FakeBackend{})
+}
+
+func newHandlers(db *bolt.DB, a addresses.Backend, d dhcp.Backend, n dns.Backend, g gateway.Backend) *Handlers {
+	h := &Handlers{
+		Addresses: &addresses.Handler{DB: db, Backend: a},
+		Audit:     &audit.Handler{DB: db},
+		Auth:      &auth.Handler{DB: db},
+		DHCP:      &dhcp.Handler{DB: db, Backend: d},
+		DNS:       &dns.Handler{DB: db, Backend: n},
+		Gateway:   &gateway.Handler{DB: db, Backend: g},
+		Hosts:     &hosts.Handler{DB: db},
+	}
+	h.Hostname = &hostname.Handler{DB: db, Hosts: h.Hosts}
+	h.Forwarder = &forwarder.Handler{DB: db, Upstreams: h.DNS.Upstreams}
+	h.Revisions = &revisions.Handler{DB: db, Restorers: map[string]revisions.Restorer{
+		"address": h.Addresses,
+		"pools":   addresses.PoolRestorer{},
+		"dhcp":    h.DHCP,
+		"dns":     h.DNS,
+		"routes":  h.Gateway,
+	}}
+	h.Backup = &backup.Handler{Revisions: h.Revisions}
+	h.Render = &render.Handler{Revisions: h.Revisions}
+	h.Snapshot = &snapshot.Handler{Revisions: h.Revisions}
+	return h
+}
+
+// DBinit initializes the database of every subsystem,
+// reinstalling the previous state
+func (h *Handlers) DBinit() error {
+	inits := []func() error{
+		h.Audit.DBinit,
+		h.Auth.DBinit,
+		h.DHCP.DBinit,
+		h.Addresses.DBinit,
+		h.DNS.DBinit,
+		h.Gateway.DBinit,
+		h.Hosts.DBinit,
+		h.Hostname.DBinit,
+		h.Forwarder.DBinit,
+		// last, to store the configuration restored
+		h.Revisions.DBinit,
+	}
+	for _, init := range inits {
+		if err := init(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prefix is the path of the current version of the API
+const Prefix = "/v1"
+
+var (
+	dateTime = &openapi.Schema{Type: "string", Format: "date-time"}
+	str      = &openapi.Schema{Type: "string"}
+	boolean  = &openapi.Schema{Type: "boolean"}
+)
+
+// schemas names the components of the OpenAPI document
+// like the types exported by the handlers
+var schemas = map[string]interface{}{
+	"Address":           addresses.Address{},
+	"AddressBatch":      addresses.Batch{},
+	"AddressOperation":  addresses.BatchOperation{},
+	"AuditRecord":       audit.Record{},
+	"AuditVerification": audit.Verification{},
+	"BackupDocument":    backup.Document{},
+	"BackupResult":      backup.Result{},
+	"DHCP":              dhcp.Config{},
+	"DNS":               types.DNS{},
+	"ForwarderHost":     forwarder.Host{},
+	"ForwarderLease":    forwarder.Lease{},
+	"ForwarderStatus":   forwarder.Status{},
+	"Gateway":           gateway.Gateway{},
+	"Host":              hosts.Host{},
+	"Hostname":          hostname.Hostname{},
+	"Interface":         interfaces.Interface{},
+	"InterfaceAddress":  interfaces.Address{},
+	"Pool":              addresses.Pool{},
+	"PoolUsage":         addresses.PoolUsage{},
+	"RenderedFile":      render.File{},
+	"Result":            types.RecordResult{},
+	"Revision":          revisions.Revision{},
+	"RevisionChange":    revisions.Change{},
+	"Snapshot":          snapshot.Snapshot{},
+	"SnapshotAddress":   snapshot.Address{},
+	"SnapshotLink":      snapshot.Link{},
+	"SnapshotRoute":     snapshot.Route{},
+	"SnapshotRule":      snapshot.Rule{},
+	"Adoption":          snapshot.Adoption{},
+	"Token":             auth.Token{},
+}
+
+// operations are the routes of the API, relative to Prefix
+func (h *Handlers) operations() []openapi.Operation {
+	return []openapi.Operation{
+		{Method: http.MethodGet, Path: "/interfaces", Summary: "List network interfaces",
+			Handler: interfaces.GetIfaces, Response: []interfaces.Interface{}},
+		{Method: http.MethodGet, Path: "/interfaces/:iface", Summary: "List addresses of a network interface",
+			Handler: interfaces.GetIface, Response: []interfaces.Address{}},
+
+		{Method: http.MethodGet, Path: "/addresses", Summary: "List managed addresses",
+			Handler: h.Addresses.GetAddresses, Response: []addresses.Address{}},
+		{Method: http.MethodPost, Path: "/addresses", Summary: "Add an address",
+			Handler: h.Addresses.PostAddress, Body: addresses.Address{}, Status: http.StatusCreated, Response: addresses.Address{},
+			Query: []openapi.Parameter{{Name: "probe", Description: "check that no other host uses the IP", Schema: boolean}}},
+		{Method: http.MethodPost, Path: "/addresses:batch", Summary: "Create, update and delete addresses all together",
+			Handler: h.Addresses.PostBatch, Body: addresses.Batch{}, Response: []addresses.Address{}},
+		{Method: http.MethodGet, Path: "/addresses/:address", Summary: "Get an address",
+			Handler: h.Addresses.GetAddress, Response: addresses.Address{}},
+		{Method: http.MethodPut, Path: "/addresses/:address", Summary: "Set an address",
+			Handler: h.Addresses.PutAddress, Body: addresses.Address{}, Response: addresses.Address{},
+			Query: []openapi.Parameter{{Name: "probe", Description: "check that no other host uses the IP", Schema: boolean}}},
+		{Method: http.MethodDelete, Path: "/addresses/:address", Summary: "Remove an address",
+			Handler: h.Addresses.DeleteAddress, Status: http.StatusNoContent},
+		{Method: http.MethodPost, Path: "/addresses/:address/apply", Summary: "Add an address to its link again",
+			Handler: h.Addresses.PostApply, Response: addresses.Address{}},
+		{Method: http.MethodGet, Path: "/pools", Summary: "List address pools with their usage",
+			Handler: h.Addresses.GetPools, Response: []addresses.Pool{}},
+		{Method: http.MethodPost, Path: "/pools", Summary: "Add an address pool",
+			Handler: h.Addresses.PostPool, Body: addresses.Pool{}, Status: http.StatusCreated, Response: addresses.Pool{}},
+		{Method: http.MethodGet, Path: "/pools/:pool", Summary: "Get an address pool with its usage",
+			Handler: h.Addresses.GetPool, Response: addresses.Pool{}},
+		{Method: http.MethodDelete, Path: "/pools/:pool", Summary: "Remove an address pool",
+			Handler: h.Addresses.DeletePool, Status: http.StatusNoContent},
+
+		{Method: http.MethodGet, Path: "/backup", Summary: "Export the configuration",
+			Handler: h.Backup.GetBackup, Response: backup.Document{}, Alternates: []string{"application/yaml"}},
+		{Method: http.MethodPut, Path: "/backup", Summary: "Import a configuration",
+			Handler: h.Backup.PutBackup, Body: backup.Document{}, Response: backup.Result{}, Alternates: []string{"application/yaml"},
+			Query: []openapi.Parameter{{Name: "dry_run", Description: "only return the changes", Schema: boolean}}},
+
+		{Method: http.MethodGet, Path: "/dhcp", Summary: "Get the DHCP client state",
+			Handler: h.DHCP.GetDhcp, Response: dhcp.Config{}},
+		{Method: http.MethodPost, Path: "/dhcp", Summary: "Start or stop the DHCP client",
+			Handler: h.DHCP.PostDhcp, Body: dhcp.Config{}, Response: dhcp.Config{}},
+
+		{Method: http.MethodGet, Path: "/dns", Summary: "Get the resolver configuration",
+			Handler: h.DNS.GetDNS, Response: types.DNS{}},
+		{Method: http.MethodPost, Path: "/dns", Summary: "Set the resolver configuration",
+			Handler: h.DNS.PostDNS, Body: types.DNS{}, Response: types.DNS{}},
+
+		{Method: http.MethodGet, Path: "/dns/forwarder", Summary: "Get the forwarder state",
+			Handler: h.Forwarder.GetForwarder, Response: forwarder.Status{}},
+		{Method: http.MethodGet, Path: "/dns/forwarder/hosts", Summary: "List forwarder hosts", ID: "GetForwarderHosts",
+			Handler: h.Forwarder.GetHosts, Response: []forwarder.Host{}},
+		{Method: http.MethodPut, Path: "/dns/forwarder/hosts/:name", Summary: "Set a forwarder host", ID: "PutForwarderHost",
+			Handler: h.Forwarder.PutHost, Body: forwarder.Host{}, Response: forwarder.Host{}},
+		{Method: http.MethodDelete, Path: "/dns/forwarder/hosts/:name", Summary: "Remove a forwarder host", ID: "DeleteForwarderHost",
+			Handler: h.Forwarder.DeleteHost, Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: "/dns/forwarder/leases", Summary: "List leases",
+			Handler: h.Forwarder.GetLeases, Response: []forwarder.Lease{}},
+		{Method: http.MethodPut, Path: "/dns/forwarder/leases/:hostname", Summary: "Register a lease",
+			Handler: h.Forwarder.PutLease, Body: forwarder.Lease{}, Response: forwarder.Lease{}},
+		{Method: http.MethodDelete, Path: "/dns/forwarder/leases/:hostname", Summary: "Remove a lease",
+			Handler: h.Forwarder.DeleteLease, Status: http.StatusNoContent},
+
+		{Method: http.MethodGet, Path: "/hosts", Summary: "List /etc/hosts entries",
+			Handler: h.Hosts.GetHosts, Response: []hosts.Host{}},
+		{Method: http.MethodPost, Path: "/hosts", Summary: "Add an /etc/hosts entry",
+			Handler: h.Hosts.PostHost, Body: hosts.Host{}, Status: http.StatusCreated, Response: hosts.Host{}},
+		{Method: http.MethodGet, Path: "/hosts/:host", Summary: "Get an /etc/hosts entry",
+			Handler: h.Hosts.GetHost, Response: hosts.Host{}},
+		{Method: http.MethodPut, Path: "/hosts/:host", Summary: "Set an /etc/hosts entry",
+			Handler: h.Hosts.PutHost, Body: hosts.Host{}, Response: hosts.Host{}},
+		{Method: http.MethodDelete, Path: "/hosts/:host", Summary: "Remove an /etc/hosts entry",
+			Handler: h.Hosts.DeleteHost, Status: http.StatusNoContent},
+
+		{Method: http.MethodGet, Path: "/hostname", Summary: "Get the hostname",
+			Handler: h.Hostname.GetHostname, Response: hostname.Hostname{}},
+		{Method: http.MethodPut, Path: "/hostname", Summary: "Set the hostname",
+			Handler: h.Hostname.PutHostname, Body: hostname.Hostname{}, Response: hostname.Hostname{}},
+
+		{Method: http.MethodGet, Path: "/render/:format", Summary: "Render the configuration as ifupdown, netplan or networkd files",
+			Handler: h.Render.GetRender, Response: []render.File{}},
+
+		{Method: http.MethodGet, Path: "/routes", Summary: "List the routing table",
+			Handler: h.Gateway.GetRoutes, Response: []netlink.Route{}},
+		{Method: http.MethodPost, Path: "/routes/gateway", Summary: "Set the default gateway",
+			Handler: h.Gateway.PostGateway, Body: gateway.Gateway{}, Response: gateway.Gateway{}},
+		{Method: http.MethodGet, Path: "/routes/gateway", Summary: "Get the default gateway",
+			Handler: h.Gateway.GetGateway, Response: gateway.Gateway{}},
+
+		{Method: http.MethodGet, Path: "/audit", Summary: "List audit records",
+			Handler: h.Audit.GetAudit, Response: []audit.Record{},
+			Query: []openapi.Parameter{
+				{Name: "since", Schema: dateTime},
+				{Name: "until", Schema: dateTime},
+				{Name: "resource", Schema: str},
+				{Name: "user", Schema: str},
+			}},
+		{Method: http.MethodGet, Path: "/events", Summary: "Stream audit records as server-sent events",
+			Handler: h.Audit.GetEvents, Response: audit.Record{}, MediaType: "text/event-stream",
+			Query: []openapi.Parameter{{Name: "resource", Schema: str}}},
+		{Method: http.MethodGet, Path: "/audit/verify", Summary: "Verify the audit chain",
+			Handler: h.Audit.GetVerify, Response: audit.Verification{}},
+
+		{Method: http.MethodGet, Path: "/revisions", Summary: "List revisions",
+			Handler: h.Revisions.GetRevisions, Response: []revisions.Revision{}},
+		{Method: http.MethodGet, Path: "/revisions/:n", Summary: "Get a revision",
+			Handler: h.Revisions.GetRevision, Response: revisions.Revision{}},
+		{Method: http.MethodGet, Path: "/revisions/:n/diff/:m", Summary: "Compare two revisions",
+			Handler: h.Revisions.GetDiff, Response: []revisions.Change{}},
+		{Method: http.MethodPost, Path: "/revisions/:n/rollback", Summary: "Roll back to a revision",
+			Handler: h.Revisions.PostRollback, Response: revisions.Revision{}},
+
+		{Method: http.MethodGet, Path: "/snapshot", Summary: "Capture the network state of the kernel",
+			Handler: h.Snapshot.GetSnapshot, Response: snapshot.Snapshot{}},
+		{Method: http.MethodPost, Path: "/adopt", Summary: "Manage live addresses, default route or resolv.conf",
+			Handler: h.Snapshot.PostAdopt, Body: snapshot.Adoption{}, Response: backup.Result{},
+			Query: []openapi.Parameter{{Name: "dry_run", Description: "only return the changes", Schema: boolean}}},
+
+		{Method: http.MethodGet, Path: "/tokens", Summary: "List API tokens",
+			Handler: h.Auth.GetTokens, Response: []auth.Token{}},
+		{Method: http.MethodPost, Path: "/tokens", Summary: "Create an API token",
+			Handler: h.Auth.PostToken, Body: auth.Token{}, Status: http.StatusCreated, Response: auth.Token{}},
+		{Method: http.MethodDelete, Path: "/tokens/:token", Summary: "Revoke an API token",
+			Handler: h.Auth.DeleteToken, Status: http.StatusNoContent},
+	}
+}
+
+// NewAPI returns the REST API served by tentacool under Prefix,
+// requests go through the given middlewares before being audited
+func NewAPI(h *Handlers, middlewares ...rest.Middleware) (*rest.Api, error) {
+	api := rest.NewApi()
+	api.Use(middlewares...)
+	api.Use(h.Audit.Middleware(), h.Revisions.Middleware())
+
+	spec, err := openapi.New(openapi.Info{Title: "tentacool", Version: strings.TrimPrefix(Prefix, "/")}, Prefix, schemas, h.operations())
+	if err != nil {
+		return nil, err
+	}
+	router, err := rest.MakeRouter(spec.Routes()...)
+	if err != nil {
+		return nil, err
+	}
+
+	api.SetApp(apierror.App(router))
+	return api, nil
+}
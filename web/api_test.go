@@ -0,0 +1,703 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/guilhem/dnsconfig"
+	"github.com/vishvananda/netlink"
+
+	"github.com/guilhem/tentacool/addresses"
+	"github.com/guilhem/tentacool/backup"
+	"github.com/guilhem/tentacool/dhcp"
+	"github.com/guilhem/tentacool/dns"
+	"github.com/guilhem/tentacool/gateway"
+	"github.com/guilhem/tentacool/hosts"
+	"github.com/guilhem/tentacool/types"
+)
+
+// testServer serves the API over the fake backends, with a DB and an
+// /etc/hosts of its own
+type testServer struct {
+	*httptest.Server
+	t       *testing.T
+	h       *Handlers
+	dir     string
+	backend *addresses.FakeBackend
+}
+
+func newTestServer(t *testing.T) *testServer {
+	dir, err := ioutil.TempDir("", "tentacool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts.HostsPath = filepath.Join(dir, "hosts")
+	db, err := bolt.Open(filepath.Join(dir, "db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewFakeHandlers(db)
+	if err := h.DBinit(); err != nil {
+		t.Fatal(err)
+	}
+	api, err := NewAPI(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{
+		Server:  httptest.NewServer(api.MakeHandler()),
+		t:       t,
+		h:       h,
+		dir:     dir,
+		backend: h.Addresses.Backend.(*addresses.FakeBackend),
+	}
+}
+
+func (s *testServer) Close() {
+	s.Server.Close()
+	s.h.Addresses.DB.Close()
+	os.RemoveAll(s.dir)
+}
+
+// do sends body as JSON and decodes the response into out, returning
+// the status
+func (s *testServer) do(method, path string, body, out interface{}) int {
+	var r bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&r).Encode(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, s.URL+Prefix+path, &r)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			s.t.Fatalf("%s %s: %s", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// expect checks the status and, for errors, the code of a request
+func (s *testServer) expect(method, path string, body interface{}, status int, code types.Code) {
+	e := types.Error{}
+	got := s.do(method, path, body, &e)
+	if got != status {
+		s.t.Errorf("%s %s: got %d, expecting %d (%s)", method, path, got, status, e.Message)
+	}
+	if code != "" && e.Code != code {
+		s.t.Errorf("%s %s: got code %q, expecting %q", method, path, e.Code, code)
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	created := types.Address{}
+	if status := s.do("POST", "/addresses", types.Address{Link: "eth0", IP: "192.168.32.11/24"}, &created); status != http.StatusCreated {
+		t.Fatalf("POST: got %d", status)
+	}
+	if created.ID != "1" || created.Status != addresses.StatusApplied {
+		t.Errorf("POST: got %+v", created)
+	}
+	if ips := s.backend.Links["eth0"]; len(ips) != 1 || ips[0] != "192.168.32.11/24" {
+		t.Errorf("POST: backend holds %v", ips)
+	}
+
+	got := types.Address{}
+	if status := s.do("GET", "/addresses/1", nil, &got); status != http.StatusOK || got.IP != created.IP {
+		t.Errorf("GET: got %d %+v", status, got)
+	}
+
+	updated := types.Address{}
+	if status := s.do("PUT", "/addresses/1", types.Address{Link: "eth0", IP: "192.168.32.12/24"}, &updated); status != http.StatusOK {
+		t.Errorf("PUT: got %d", status)
+	}
+	if ips := s.backend.Links["eth0"]; len(ips) != 1 || ips[0] != "192.168.32.12/24" {
+		t.Errorf("PUT: backend holds %v", ips)
+	}
+
+	s.expect("POST", "/addresses", types.Address{Link: "eth0", IP: "invalid"}, http.StatusUnprocessableEntity, types.CodeInvalid)
+	s.expect("POST", "/addresses", types.Address{ID: "7", Link: "eth0", IP: "10.0.0.1/8"}, http.StatusUnprocessableEntity, types.CodeInvalid)
+	s.expect("POST", "/addresses", types.Address{Link: "eth0", IP: "192.168.32.12/24"}, http.StatusConflict, types.CodeConflict)
+	s.expect("POST", "/addresses", types.Address{ID: "lan", Link: "eth1", IP: "10.0.0.1/8"}, http.StatusCreated, "")
+	s.expect("POST", "/addresses", types.Address{ID: "lan", Link: "eth1", IP: "10.0.0.2/8"}, http.StatusConflict, types.CodeConflict)
+
+	s.expect("DELETE", "/addresses/1", nil, http.StatusNoContent, "")
+	s.expect("GET", "/addresses/1", nil, http.StatusNotFound, types.CodeNotFound)
+	s.expect("DELETE", "/addresses/1", nil, http.StatusNotFound, types.CodeNotFound)
+	if ips := s.backend.Links["eth0"]; len(ips) != 0 {
+		t.Errorf("DELETE: backend holds %v", ips)
+	}
+}
+
+func TestAddressNotApplied(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	s.backend.Err = errors.New("failing")
+	var resource json.RawMessage
+	e := types.Error{Resource: &resource}
+	if status := s.do("POST", "/addresses", types.Address{Link: "eth0", IP: "192.168.32.11/24"}, &e); status != types.StatusNotApplied {
+		t.Fatalf("POST: got %d", status)
+	}
+	if e.Code != types.CodeNotApplied {
+		t.Errorf("POST: got code %q", e.Code)
+	}
+	stored := types.Address{}
+	if err := json.Unmarshal(resource, &stored); err != nil || stored.ID != "1" {
+		t.Errorf("POST: got resource %s", resource)
+	}
+
+	// stored anyway
+	s.backend.Err = nil
+	s.expect("GET", "/addresses/1", nil, http.StatusOK, "")
+}
+
+func TestHosts(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	created := types.Host{}
+	if status := s.do("POST", "/hosts", types.Host{IP: "10.0.0.2", Names: []string{"db"}}, &created); status != http.StatusCreated || created.ID != "1" {
+		t.Fatalf("POST: got %d %+v", status, created)
+	}
+	data, err := ioutil.ReadFile(hosts.HostsPath)
+	if err != nil || !bytes.Contains(data, []byte("10.0.0.2\tdb")) {
+		t.Errorf("POST: hosts file holds %q, %v", data, err)
+	}
+
+	s.expect("PUT", "/hosts/1", types.Host{IP: "10.0.0.3", Names: []string{"db"}}, http.StatusOK, "")
+	got := types.Host{}
+	if status := s.do("GET", "/hosts/1", nil, &got); status != http.StatusOK || got.IP != "10.0.0.3" {
+		t.Errorf("GET: got %d %+v", status, got)
+	}
+
+	s.expect("POST", "/hosts", types.Host{IP: "invalid", Names: []string{"db"}}, http.StatusUnprocessableEntity, types.CodeInvalid)
+	s.expect("PUT", "/hosts/5", types.Host{IP: "10.0.0.4", Names: []string{"cache"}}, http.StatusUnprocessableEntity, types.CodeInvalid)
+	s.expect("PUT", "/hosts/cache", types.Host{IP: "10.0.0.4", Names: []string{"cache"}}, http.StatusOK, "")
+
+	s.expect("DELETE", "/hosts/1", nil, http.StatusNoContent, "")
+	s.expect("DELETE", "/hosts/1", nil, http.StatusNotFound, types.CodeNotFound)
+	s.expect("GET", "/hosts/1", nil, http.StatusNotFound, types.CodeNotFound)
+}
+
+func TestPools(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	pool := types.Pool{ID: "svc", Link: "eth0", CIDR: "192.168.32.16/28", Prefix: 24, Exclude: []string{"192.168.32.17"}}
+	s.expect("POST", "/pools", pool, http.StatusCreated, "")
+	s.expect("POST", "/pools", types.Pool{Link: "eth0", CIDR: "192.168.32.0/24"}, http.StatusConflict, types.CodeConflict)
+	s.expect("POST", "/pools", types.Pool{ID: "3", Link: "eth0", CIDR: "10.0.0.0/24"}, http.StatusUnprocessableEntity, types.CodeInvalid)
+
+	created := types.Address{}
+	if status := s.do("POST", "/addresses", types.Address{Pool: "svc"}, &created); status != http.StatusCreated {
+		t.Fatalf("POST address: got %d", status)
+	}
+	if created.IP != "192.168.32.18/24" || created.Link != "eth0" {
+		t.Errorf("POST address: got %+v", created)
+	}
+
+	s.expect("PUT", "/addresses/"+created.ID, types.Address{Pool: "svc"}, http.StatusUnprocessableEntity, types.CodeInvalid)
+	s.expect("PUT", "/addresses/"+created.ID, types.Address{Pool: "svc", Link: "eth1", IP: "192.168.32.19/24"}, http.StatusUnprocessableEntity, types.CodeInvalid)
+	s.expect("PUT", "/addresses/"+created.ID, types.Address{Pool: "svc", IP: "192.168.33.1/24"}, http.StatusUnprocessableEntity, types.CodeInvalid)
+
+	got := types.Pool{}
+	if status := s.do("GET", "/pools/svc", nil, &got); status != http.StatusOK {
+		t.Fatalf("GET pool: got %d", status)
+	}
+	if got.Usage == nil || got.Usage.Size != 13 || got.Usage.Used != 1 || got.Usage.Addresses[0] != created.ID {
+		t.Errorf("GET pool: got usage %+v", got.Usage)
+	}
+
+	s.expect("DELETE", "/pools/svc", nil, http.StatusConflict, types.CodeConflict)
+	s.expect("DELETE", "/addresses/"+created.ID, nil, http.StatusNoContent, "")
+	s.expect("DELETE", "/pools/svc", nil, http.StatusNoContent, "")
+	s.expect("GET", "/pools/svc", nil, http.StatusNotFound, types.CodeNotFound)
+	s.expect("POST", "/addresses", types.Address{Pool: "svc"}, http.StatusUnprocessableEntity, types.CodeInvalid)
+}
+
+func TestImportKeepsIDs(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	// an address stored under the next ID of a new DB
+	doc := types.Document{Version: backup.Version, Buckets: types.Config{
+		"address": {"1": json.RawMessage(`{"id":"1","link":"eth0","ip":"192.168.32.11/24"}`)},
+	}}
+	s.expect("PUT", "/backup", doc, http.StatusOK, "")
+
+	created := types.Address{}
+	if status := s.do("POST", "/addresses", types.Address{Link: "eth0", IP: "192.168.32.12/24"}, &created); status != http.StatusCreated || created.ID == "1" {
+		t.Errorf("POST: got %d %+v", status, created)
+	}
+	got := types.Address{}
+	if status := s.do("GET", "/addresses/1", nil, &got); status != http.StatusOK || got.IP != "192.168.32.11/24" {
+		t.Errorf("GET: got %d %+v", status, got)
+	}
+}
+
+// expectNotApplied checks that a request is stored but not applied,
+// decoding the stored resource into out
+func (s *testServer) expectNotApplied(method, path string, body, out interface{}) {
+	var resource json.RawMessage
+	e := types.Error{Resource: &resource}
+	if status := s.do(method, path, body, &e); status != types.StatusNotApplied || e.Code != types.CodeNotApplied {
+		s.t.Errorf("%s %s: got %d %q, expecting not applied", method, path, status, e.Code)
+		return
+	}
+	if err := json.Unmarshal(resource, out); err != nil {
+		s.t.Errorf("%s %s: got resource %s, %v", method, path, resource, err)
+	}
+}
+
+func TestDNS(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	backend := s.h.DNS.Backend.(*dns.FakeBackend)
+
+	config := dnsconfig.DnsConfig{Servers: []string{"9.9.9.9"}, Search: []string{"example.com"}}
+	s.expect("POST", "/dns", config, http.StatusOK, "")
+	if len(backend.Config.Servers) != 1 || backend.Config.Servers[0] != "9.9.9.9" {
+		t.Errorf("POST: backend holds %+v", backend.Config)
+	}
+	got := types.DNS{}
+	if status := s.do("GET", "/dns", nil, &got); status != http.StatusOK || len(got.Search) != 1 || got.Search[0] != "example.com" {
+		t.Errorf("GET: got %d %+v", status, got)
+	}
+
+	s.expect("POST", "/dns", dnsconfig.DnsConfig{Servers: []string{"invalid"}}, http.StatusUnprocessableEntity, types.CodeInvalid)
+
+	backend.Err = errors.New("failing")
+	stored := types.DNS{}
+	s.expectNotApplied("POST", "/dns", dnsconfig.DnsConfig{Servers: []string{"1.1.1.1"}}, &stored)
+	if len(stored.Servers) != 1 || stored.Servers[0] != "1.1.1.1" {
+		t.Errorf("POST: got resource %+v", stored)
+	}
+	backend.Err = nil
+	if servers, err := s.h.DNS.Upstreams(); err != nil || len(servers) != 1 || servers[0] != "1.1.1.1" {
+		t.Errorf("stored %v, %v", servers, err)
+	}
+}
+
+func TestDHCP(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	backend := s.h.DHCP.Backend.(*dhcp.FakeBackend)
+
+	got := types.DHCP{}
+	if status := s.do("GET", "/dhcp", nil, &got); status != http.StatusOK || got.Active || got.Interface != "eth0" {
+		t.Errorf("GET: got %d %+v", status, got)
+	}
+
+	s.expect("POST", "/dhcp", types.DHCP{Active: true, Interface: "enp3s0"}, http.StatusOK, "")
+	if !backend.Running["enp3s0"] {
+		t.Errorf("POST: backend runs %v", backend.Running)
+	}
+	if status := s.do("GET", "/dhcp", nil, &got); status != http.StatusOK || !got.Active || got.Interface != "enp3s0" {
+		t.Errorf("GET: got %d %+v", status, got)
+	}
+
+	for _, iface := range []string{"eth0; reboot", "-x", "../eth0", "eth0:1", "averyveryverylongname"} {
+		s.expect("POST", "/dhcp", types.DHCP{Active: true, Interface: iface}, http.StatusUnprocessableEntity, types.CodeInvalid)
+	}
+
+	// stored even when the client fails to stop
+	backend.Err = errors.New("failing")
+	stored := types.DHCP{}
+	s.expectNotApplied("POST", "/dhcp", types.DHCP{Active: false, Interface: "enp3s0"}, &stored)
+	if stored.Active || stored.Interface != "enp3s0" {
+		t.Errorf("POST: got resource %+v", stored)
+	}
+	backend.Err = nil
+	if status := s.do("GET", "/dhcp", nil, &got); status != http.StatusOK || got.Active {
+		t.Errorf("GET: got %d %+v", status, got)
+	}
+	if !backend.Running["enp3s0"] {
+		t.Errorf("POST: backend runs %v", backend.Running)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	backend := s.h.Gateway.Backend.(*gateway.FakeBackend)
+
+	s.expect("GET", "/routes/gateway", nil, http.StatusNotFound, types.CodeNotFound)
+	s.expect("POST", "/routes/gateway", types.Gateway{IP: "192.168.32.1", Link: "eth0"}, http.StatusOK, "")
+	if backend.Default != [2]string{"192.168.32.1", "eth0"} {
+		t.Errorf("POST: backend holds %v", backend.Default)
+	}
+	got := types.Gateway{}
+	if status := s.do("GET", "/routes/gateway", nil, &got); status != http.StatusOK || got.IP != "192.168.32.1" {
+		t.Errorf("GET: got %d %+v", status, got)
+	}
+
+	s.expect("POST", "/routes/gateway", types.Gateway{IP: "invalid"}, http.StatusUnprocessableEntity, types.CodeInvalid)
+
+	backend.Err = errors.New("network is unreachable")
+	stored := types.Gateway{}
+	s.expectNotApplied("POST", "/routes/gateway", types.Gateway{IP: "10.0.0.1"}, &stored)
+	if stored.IP != "10.0.0.1" {
+		t.Errorf("POST: got resource %+v", stored)
+	}
+	backend.Err = nil
+	if status := s.do("GET", "/routes/gateway", nil, &got); status != http.StatusOK || got.IP != "10.0.0.1" {
+		t.Errorf("GET: got %d %+v", status, got)
+	}
+
+	// stored, the change is a revision, unlike the invalid one
+	var revisions []types.Revision
+	if status := s.do("GET", "/revisions", nil, &revisions); status != http.StatusOK || len(revisions) != 3 {
+		t.Fatalf("GET revisions: got %d %+v", status, revisions)
+	}
+	if last := revisions[len(revisions)-1]; last.Method != "POST" || last.Path != Prefix+"/routes/gateway" {
+		t.Errorf("GET revisions: got %+v", last)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	backend := s.h.Gateway.Backend.(*gateway.FakeBackend)
+
+	backend.RouteList = []netlink.Route{{LinkIndex: 2, Gw: net.ParseIP("192.168.32.1")}}
+	var routes []types.Route
+	if status := s.do("GET", "/routes", nil, &routes); status != http.StatusOK {
+		t.Fatalf("GET: got %d", status)
+	}
+	if len(routes) != 1 || routes[0].LinkIndex != 2 || !routes[0].Gw.Equal(net.ParseIP("192.168.32.1")) {
+		t.Errorf("GET: got %+v", routes)
+	}
+
+	backend.Err = errors.New("failing")
+	s.expect("GET", "/routes", nil, http.StatusInternalServerError, "")
+}
+
+func TestBackupYAML(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	s.expect("POST", "/addresses", types.Address{Link: "eth0", IP: "192.168.32.11/24"}, http.StatusCreated, "")
+	req, err := http.NewRequest("GET", s.URL+Prefix+"/backup", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/yaml")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/yaml" {
+		t.Fatalf("GET: got %d %s, %v", resp.StatusCode, resp.Header.Get("Content-Type"), err)
+	}
+	if !bytes.Contains(data, []byte("ip: 192.168.32.11/24")) {
+		t.Errorf("GET: got\n%s", data)
+	}
+
+	// restored once deleted
+	s.expect("DELETE", "/addresses/1", nil, http.StatusNoContent, "")
+	req, err = http.NewRequest("PUT", s.URL+Prefix+"/backup", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/yaml")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := types.ImportResult{}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || !result.Applied || len(result.Changes) != 1 {
+		t.Fatalf("PUT: got %d %+v, %v", resp.StatusCode, result, err)
+	}
+	if ips := s.backend.Links["eth0"]; len(ips) != 1 || ips[0] != "192.168.32.11/24" {
+		t.Errorf("PUT: backend holds %v", ips)
+	}
+}
+
+// links returns the addresses of the fake backend on a link, sorted
+func (s *testServer) links(link string) []string {
+	s.backend.Lock()
+	defer s.backend.Unlock()
+	ips := append([]string{}, s.backend.Links[link]...)
+	sort.Strings(ips)
+	return ips
+}
+
+// stored returns the IPs of the stored addresses by ID
+func (s *testServer) stored() map[string]string {
+	var list []types.Address
+	if status := s.do("GET", "/addresses", nil, &list); status != http.StatusOK {
+		s.t.Fatalf("GET: got %d", status)
+	}
+	ips := map[string]string{}
+	for _, a := range list {
+		ips[a.ID] = a.IP
+	}
+	return ips
+}
+
+func batch(ops ...types.BatchOperation) types.Batch {
+	return types.Batch{Operations: ops}
+}
+
+func TestBatchRollback(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	for _, ip := range []string{"10.0.0.1/24", "10.0.0.2/24"} {
+		s.expect("POST", "/addresses", types.Address{Link: "eth0", IP: ip}, http.StatusCreated, "")
+	}
+	s.backend.Failing = map[string]error{"10.0.0.5/24": errors.New("failing")}
+	s.expect("POST", "/addresses:batch", batch(
+		types.BatchOperation{Op: "delete", Address: types.Address{ID: "1"}},
+		types.BatchOperation{Op: "update", Address: types.Address{ID: "2", Link: "eth0", IP: "10.0.0.3/24"}},
+		types.BatchOperation{Op: "create", Address: types.Address{Link: "eth0", IP: "10.0.0.4/24"}},
+		types.BatchOperation{Op: "create", Address: types.Address{Link: "eth0", IP: "10.0.0.5/24"}},
+	), http.StatusInternalServerError, types.CodeInternal)
+
+	// the delete, update and create done before are undone
+	if ips := s.links("eth0"); !reflect.DeepEqual(ips, []string{"10.0.0.1/24", "10.0.0.2/24"}) {
+		t.Errorf("backend holds %v", ips)
+	}
+	if ips := s.stored(); !reflect.DeepEqual(ips, map[string]string{"1": "10.0.0.1/24", "2": "10.0.0.2/24"}) {
+		t.Errorf("stored %v", ips)
+	}
+	// nor are the IDs allocated
+	created := types.Address{}
+	if status := s.do("POST", "/addresses", types.Address{Link: "eth0", IP: "10.0.0.6/24"}, &created); status != http.StatusCreated || created.ID != "3" {
+		t.Errorf("POST: got %d %+v", status, created)
+	}
+}
+
+func TestBatchIDs(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	var results []types.Address
+	status := s.do("POST", "/addresses:batch", batch(
+		types.BatchOperation{Op: "create", Address: types.Address{Link: "eth0", IP: "10.0.0.1/24"}},
+		types.BatchOperation{Op: "create", Address: types.Address{ID: "lan", Link: "eth1", IP: "192.168.32.1/24"}},
+		types.BatchOperation{Op: "create", Address: types.Address{Link: "eth0", IP: "10.0.0.2/24"}},
+		types.BatchOperation{Op: "create", Address: types.Address{Link: "eth0", IP: "10.0.0.3/24"}},
+	), &results)
+	if status != http.StatusOK {
+		t.Fatalf("POST: got %d", status)
+	}
+	var ids []string
+	for _, a := range results {
+		ids = append(ids, a.ID)
+		if a.Status != addresses.StatusApplied {
+			t.Errorf("POST: got %+v", a)
+		}
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "lan", "2", "3"}) {
+		t.Errorf("POST: got IDs %v", ids)
+	}
+	if ips := s.stored(); len(ips) != 4 || ips["2"] != "10.0.0.2/24" || ips["lan"] != "192.168.32.1/24" {
+		t.Errorf("stored %v", ips)
+	}
+}
+
+func TestBatchClashes(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	for _, ip := range []string{"10.0.0.1/24", "10.0.0.2/24"} {
+		s.expect("POST", "/addresses", types.Address{Link: "eth0", IP: ip}, http.StatusCreated, "")
+	}
+	for _, test := range []struct {
+		name   string
+		batch  types.Batch
+		status int
+		code   types.Code
+	}{
+		{"same IP twice", batch(
+			types.BatchOperation{Op: "create", Address: types.Address{Link: "eth0", IP: "10.0.0.3/24"}},
+			types.BatchOperation{Op: "create", Address: types.Address{Link: "eth0", IP: "10.0.0.3/24"}},
+		), http.StatusConflict, types.CodeConflict},
+		{"IP of an address kept", batch(
+			types.BatchOperation{Op: "create", Address: types.Address{Link: "eth0", IP: "10.0.0.1/24"}},
+		), http.StatusConflict, types.CodeConflict},
+		{"ID of an address kept", batch(
+			types.BatchOperation{Op: "create", Address: types.Address{ID: "lan", Link: "eth0", IP: "10.0.0.3/24"}},
+			types.BatchOperation{Op: "create", Address: types.Address{ID: "lan", Link: "eth0", IP: "10.0.0.4/24"}},
+		), http.StatusConflict, types.CodeConflict},
+		{"integer ID", batch(
+			types.BatchOperation{Op: "create", Address: types.Address{ID: "7", Link: "eth0", IP: "10.0.0.3/24"}},
+		), http.StatusUnprocessableEntity, types.CodeInvalid},
+		{"update of a deleted address", batch(
+			types.BatchOperation{Op: "delete", Address: types.Address{ID: "1"}},
+			types.BatchOperation{Op: "update", Address: types.Address{ID: "1", Link: "eth0", IP: "10.0.0.3/24"}},
+		), http.StatusNotFound, types.CodeNotFound},
+		{"unknown operation", batch(
+			types.BatchOperation{Op: "rename", Address: types.Address{ID: "1"}},
+		), http.StatusUnprocessableEntity, types.CodeInvalid},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s.t = t
+			s.expect("POST", "/addresses:batch", test.batch, test.status, test.code)
+			if ips := s.links("eth0"); !reflect.DeepEqual(ips, []string{"10.0.0.1/24", "10.0.0.2/24"}) {
+				t.Errorf("backend holds %v", ips)
+			}
+			if ips := s.stored(); len(ips) != 2 {
+				t.Errorf("stored %v", ips)
+			}
+		})
+	}
+
+	// swapped, the IPs only clash until both are updated
+	s.t = t
+	var results []types.Address
+	if status := s.do("POST", "/addresses:batch", batch(
+		types.BatchOperation{Op: "update", Address: types.Address{ID: "1", Link: "eth0", IP: "10.0.0.2/24"}},
+		types.BatchOperation{Op: "update", Address: types.Address{ID: "2", Link: "eth0", IP: "10.0.0.1/24"}},
+	), &results); status != http.StatusOK {
+		t.Errorf("POST: got %d", status)
+	}
+	if ips := s.stored(); !reflect.DeepEqual(ips, map[string]string{"1": "10.0.0.2/24", "2": "10.0.0.1/24"}) {
+		t.Errorf("stored %v", ips)
+	}
+	if ips := s.links("eth0"); !reflect.DeepEqual(ips, []string{"10.0.0.1/24", "10.0.0.2/24"}) {
+		t.Errorf("backend holds %v", ips)
+	}
+}
+
+func TestBatchDeleteCreate(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	s.expect("POST", "/addresses", types.Address{Link: "eth0", IP: "10.0.0.1/24"}, http.StatusCreated, "")
+	var results []types.Address
+	status := s.do("POST", "/addresses:batch", batch(
+		types.BatchOperation{Op: "delete", Address: types.Address{ID: "1"}},
+		types.BatchOperation{Op: "create", Address: types.Address{ID: "lan", Link: "eth0", IP: "10.0.0.1/24"}},
+	), &results)
+	if status != http.StatusOK || len(results) != 2 || results[1].Status != addresses.StatusApplied {
+		t.Fatalf("POST: got %d %+v", status, results)
+	}
+	if ips := s.stored(); !reflect.DeepEqual(ips, map[string]string{"lan": "10.0.0.1/24"}) {
+		t.Errorf("stored %v", ips)
+	}
+	if ips := s.links("eth0"); !reflect.DeepEqual(ips, []string{"10.0.0.1/24"}) {
+		t.Errorf("backend holds %v", ips)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.backend.Neighbors = map[string]string{"192.168.32.11": "52:54:00:12:34:56"}
+
+	var owner json.RawMessage
+	e := types.Error{Resource: &owner}
+	if status := s.do("POST", "/addresses?probe=true", types.Address{Link: "eth0", IP: "192.168.32.11/24"}, &e); status != http.StatusConflict || e.Code != types.CodeConflict {
+		t.Fatalf("POST: got %d %q", status, e.Code)
+	}
+	host := types.Neighbor{}
+	if err := json.Unmarshal(owner, &host); err != nil || host.HardwareAddr != "52:54:00:12:34:56" {
+		t.Errorf("POST: got owner %s", owner)
+	}
+	if ips := s.stored(); len(ips) != 0 {
+		t.Errorf("stored %v", ips)
+	}
+
+	// not probed without the parameter
+	s.expect("POST", "/addresses", types.Address{Link: "eth0", IP: "192.168.32.11/24"}, http.StatusCreated, "")
+}
+
+func TestProbePool(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.expect("POST", "/pools", types.Pool{ID: "svc", Link: "eth0", CIDR: "192.168.32.16/29", Prefix: 24}, http.StatusCreated, "")
+	s.backend.Neighbors = map[string]string{
+		"192.168.32.17": "52:54:00:12:34:56",
+		"192.168.32.18": "52:54:00:12:34:57",
+	}
+
+	// the IPs answering are skipped
+	created := types.Address{}
+	if status := s.do("POST", "/addresses?probe=true", types.Address{Pool: "svc"}, &created); status != http.StatusCreated || created.IP != "192.168.32.19/24" {
+		t.Errorf("POST: got %d %+v", status, created)
+	}
+	// but used without probing
+	if status := s.do("POST", "/addresses", types.Address{Pool: "svc"}, &created); status != http.StatusCreated || created.IP != "192.168.32.17/24" {
+		t.Errorf("POST: got %d %+v", status, created)
+	}
+
+	for _, ip := range []string{"192.168.32.20", "192.168.32.21", "192.168.32.22"} {
+		s.backend.Neighbors[ip] = "52:54:00:12:34:58"
+	}
+	s.expect("POST", "/addresses?probe=true", types.Address{Pool: "svc"}, http.StatusConflict, types.CodeConflict)
+	if ips := s.stored(); len(ips) != 2 {
+		t.Errorf("stored %v", ips)
+	}
+}
+
+func TestDAD(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.backend.Neighbors = map[string]string{"fd00::11": "52:54:00:12:34:56"}
+
+	// added, then removed once the DAD fails
+	s.expect("POST", "/addresses?probe=true", types.Address{Link: "eth0", IP: "fd00::11/64"}, http.StatusConflict, types.CodeConflict)
+	if ips := s.stored(); len(ips) != 0 {
+		t.Errorf("stored %v", ips)
+	}
+	if ips := s.links("eth0"); len(ips) != 0 {
+		t.Errorf("backend holds %v", ips)
+	}
+
+	// kept without DAD
+	s.expect("POST", "/addresses?probe=true", types.Address{Link: "eth0", IP: "fd00::11/64", Flags: []string{"nodad"}}, http.StatusCreated, "")
+	if ips := s.links("eth0"); !reflect.DeepEqual(ips, []string{"fd00::11/64"}) {
+		t.Errorf("backend holds %v", ips)
+	}
+}
+
+func TestPostExisting(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.backend.Links["eth0"] = []string{"192.168.32.11/24", "fd00::11/64"}
+	s.backend.Neighbors = map[string]string{"fd00::11": "52:54:00:12:34:56"}
+
+	created := types.Address{}
+	if status := s.do("POST", "/addresses", types.Address{Link: "eth0", IP: "192.168.32.11/24"}, &created); status != http.StatusCreated || created.Status != addresses.StatusApplied {
+		t.Errorf("POST: got %d %+v", status, created)
+	}
+	// left on the link without DAD
+	if status := s.do("POST", "/addresses?probe=true", types.Address{Link: "eth0", IP: "fd00::11/64"}, &created); status != http.StatusCreated || created.Status != addresses.StatusApplied {
+		t.Errorf("POST: got %d %+v", status, created)
+	}
+	if ips := s.links("eth0"); !reflect.DeepEqual(ips, []string{"192.168.32.11/24", "fd00::11/64"}) {
+		t.Errorf("backend holds %v", ips)
+	}
+	if ips := s.stored(); len(ips) != 2 {
+		t.Errorf("stored %v", ips)
+	}
+}
@@ -0,0 +1,179 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/boltdb/bolt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+
+	"github.com/guilhem/tentacool/apply"
+	"github.com/guilhem/tentacool/dns"
+	"github.com/guilhem/tentacool/ifupdown"
+	"github.com/guilhem/tentacool/migrations"
+	"github.com/guilhem/tentacool/revisions"
+)
+
+// Apply validates a declarative file and shows the changes it brings,
+// then applies them to the links, the DB and the system unless
+// --dry-run is set. The server must be stopped.
+func Apply(cmd *cobra.Command, args []string) {
+	// keep stdout for the plan
+	log.SetOutput(os.Stderr)
+
+	file, _ := cmd.Flags().GetString("file")
+	if file == "" {
+		log.Fatal("File required ('-' for stdin)")
+	}
+	in := io.Reader(os.Stdin)
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			log.WithError(err).Fatal()
+		}
+		defer f.Close()
+		in = f
+	}
+	config, err := apply.Load(in)
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+	applyFile(cmd, config, "APPLY", file)
+}
+
+// applyFile shows the changes brought by a file, then applies them
+// unless --dry-run is set, committing a revision made by method
+func applyFile(cmd *cobra.Command, config apply.File, method, path string) {
+	if err := config.Validate(); err != nil {
+		log.WithError(err).Fatal()
+	}
+
+	// a dry run only reads the current configuration, leaving the
+	// DB as it is, a missing one being empty
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	path, readOnly := viper.GetString("db"), dryRun
+	if _, err := os.Stat(path); dryRun && os.IsNotExist(err) {
+		dir, err := ioutil.TempDir("", "tentacool")
+		if err != nil {
+			log.WithError(err).Fatal()
+		}
+		defer os.RemoveAll(dir)
+		path, readOnly = filepath.Join(dir, "db"), false
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: readOnly})
+	if err != nil {
+		log.WithError(err).Fatal("Can't open DB, use the API while the server runs")
+	}
+	defer db.Close()
+
+	if !dryRun {
+		if err := migrations.Run(db); err != nil {
+			log.WithError(err).Fatal()
+		}
+	}
+
+	dnsBackend, err := dns.NewBackend(viper.GetString("dns-backend"), viper.GetString("dns-link"))
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+	handlers := NewHandlers(db, dnsBackend)
+	r := handlers.Revisions
+	if !dryRun {
+		if err := r.DBinit(); err != nil {
+			log.WithError(err).Fatal()
+		}
+	}
+
+	links, err := config.LinkChanges()
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+	current, err := r.Current()
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+	target := config.Config(current)
+	changes := revisions.Diff(current, target)
+
+	for _, c := range links {
+		os.Stdout.WriteString(c.String() + "\n")
+	}
+	if len(links) == 0 || len(changes) > 0 {
+		printChanges(os.Stdout, changes)
+	}
+	if dryRun || len(links)+len(changes) == 0 {
+		return
+	}
+
+	for _, c := range links {
+		if err := c.Apply(); err != nil {
+			log.WithError(err).Fatalf("Can't apply %s", c)
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	var revision revisions.Revision
+	err = audited(handlers.Audit, method, path, "apply", func() error {
+		err := r.Replace(target)
+		if _, ok := err.(revisions.ApplyError); err != nil && !ok {
+			return err
+		}
+		var cerr error
+		if revision, cerr = r.Commit(offlineUser(), method, path); cerr != nil {
+			return cerr
+		}
+		return err
+	})
+	if _, ok := err.(revisions.ApplyError); err != nil && !ok {
+		log.WithError(err).Fatal()
+	}
+	log.Printf("Applied as revision %d", revision.N)
+	if err != nil {
+		log.WithError(err).Fatal("Stored but not applied")
+	}
+}
+
+// ImportIfupdown converts an ifupdown interfaces file, reporting what
+// can't be taken over, then applies it like Apply
+func ImportIfupdown(cmd *cobra.Command, args []string) {
+	log.SetOutput(os.Stderr)
+
+	path := "/etc/network/interfaces"
+	if len(args) > 0 {
+		path = args[0]
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+	defer f.Close()
+	interfaces, err := ifupdown.Parse(f)
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+	config, unsupported := interfaces.File()
+	for _, d := range unsupported {
+		fmt.Printf("! %s\n", d)
+	}
+
+	if output, _ := cmd.Flags().GetString("output"); output != "" {
+		data, err := yaml.Marshal(config)
+		if err != nil {
+			log.WithError(err).Fatal()
+		}
+		if err := ioutil.WriteFile(output, data, 0644); err != nil {
+			log.WithError(err).Fatal()
+		}
+		return
+	}
+	applyFile(cmd, config, "IMPORT", path)
+}
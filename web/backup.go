@@ -0,0 +1,184 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/boltdb/bolt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/guilhem/tentacool/audit"
+	"github.com/guilhem/tentacool/backup"
+	"github.com/guilhem/tentacool/dns"
+	"github.com/guilhem/tentacool/migrations"
+	"github.com/guilhem/tentacool/revisions"
+)
+
+// Export writes a backup of the configuration stored in the DB
+func Export(cmd *cobra.Command, args []string) {
+	// keep stdout for the document
+	log.SetOutput(os.Stderr)
+
+	db, err := bolt.Open(viper.GetString("db"), 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		log.WithError(err).Fatal("Can't open DB, use GET /v1/backup while the server runs")
+	}
+	defer db.Close()
+
+	if v, err := migrations.Version(db); err != nil {
+		log.WithError(err).Fatal()
+	} else if v > migrations.Latest() {
+		log.Fatalf("DB schema version %d is newer than supported %d", v, migrations.Latest())
+	}
+
+	doc, err := backup.Export(NewHandlers(db, nil).Revisions)
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+
+	output, _ := cmd.Flags().GetString("output")
+	format, _ := cmd.Flags().GetString("format")
+	if format == "" {
+		format = backup.FormatOf(output)
+	} else if format != backup.JSON && format != backup.YAML {
+		log.Fatalf("Unknown format %s", format)
+	}
+	data, err := backup.Marshal(doc, format)
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+
+	out := io.Writer(os.Stdout)
+	if output != "" && output != "-" {
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			log.WithError(err).Fatal()
+		}
+		defer f.Close()
+		out = f
+	}
+	if _, err := out.Write(data); err != nil {
+		log.WithError(err).Fatal()
+	}
+}
+
+// Import shows the changes brought by a backup, then stores it in the DB
+// and applies it to the system unless --dry-run is set
+func Import(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		log.Fatal("Backup file required ('-' for stdin)")
+	}
+	in := io.Reader(os.Stdin)
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			log.WithError(err).Fatal()
+		}
+		defer f.Close()
+		in = f
+	}
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+	format, _ := cmd.Flags().GetString("format")
+	if format == "" {
+		format = backup.FormatOf(args[0])
+	} else if format != backup.JSON && format != backup.YAML {
+		log.Fatalf("Unknown format %s", format)
+	}
+	doc, err := backup.Unmarshal(data, format)
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+
+	db, err := bolt.Open(viper.GetString("db"), 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		log.WithError(err).Fatal("Can't open DB, use PUT /v1/backup while the server runs")
+	}
+	defer db.Close()
+
+	if err := migrations.Run(db); err != nil {
+		log.WithError(err).Fatal()
+	}
+
+	dnsBackend, err := dns.NewBackend(viper.GetString("dns-backend"), viper.GetString("dns-link"))
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+	handlers := NewHandlers(db, dnsBackend)
+	r := handlers.Revisions
+	if err := r.DBinit(); err != nil {
+		log.WithError(err).Fatal()
+	}
+
+	changes, err := backup.Import(r, doc, true)
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+	printChanges(os.Stdout, changes)
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun || len(changes) == 0 {
+		return
+	}
+
+	var revision revisions.Revision
+	err = audited(handlers.Audit, "IMPORT", args[0], "backup", func() error {
+		_, err := backup.Import(r, doc, false)
+		if _, ok := err.(revisions.ApplyError); err != nil && !ok {
+			return err
+		}
+		var cerr error
+		if revision, cerr = r.Commit(offlineUser(), "IMPORT", args[0]); cerr != nil {
+			return cerr
+		}
+		return err
+	})
+	if _, ok := err.(revisions.ApplyError); err != nil && !ok {
+		log.WithError(err).Fatal()
+	}
+	log.Printf("Imported as revision %d", revision.N)
+	if err != nil {
+		log.WithError(err).Fatal("Stored but not applied")
+	}
+}
+
+// offlineUser is the client of the offline commands, as the API names Unix
+// socket peers
+func offlineUser() string {
+	return "uid:" + strconv.Itoa(os.Getuid())
+}
+
+// audited runs an offline change of the DB, recording it in the audit
+// log with the command, its argument and the resource changed
+func audited(a *audit.Handler, command, arg, resource string, change func() error) error {
+	if err := a.DBinit(); err != nil {
+		return err
+	}
+	record := audit.Record{User: offlineUser(), Pid: int32(os.Getpid()), Method: command, Path: arg, Resource: resource}
+	return a.Change(record, change)
+}
+
+// printChanges shows changes like a diff, "~" marking modified values
+func printChanges(w io.Writer, changes []revisions.Change) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No change")
+		return
+	}
+	for _, c := range changes {
+		switch {
+		case string(c.From) == "null":
+			fmt.Fprintf(w, "+ %s/%s %s\n", c.Bucket, c.Key, c.To)
+		case string(c.To) == "null":
+			fmt.Fprintf(w, "- %s/%s %s\n", c.Bucket, c.Key, c.From)
+		default:
+			fmt.Fprintf(w, "~ %s/%s %s -> %s\n", c.Bucket, c.Key, c.From, c.To)
+		}
+	}
+}
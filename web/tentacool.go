@@ -1,13 +1,16 @@
 package web
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"os/user"
 	"strconv"
-	"strings"
 	"syscall"
 	"time"
 
@@ -18,13 +21,11 @@ import (
 	"github.com/rakyll/globalconf"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"github.com/vishvananda/netlink"
 
-	"github.com/guilhem/tentacool/addresses"
-	"github.com/guilhem/tentacool/dhcp"
+	"github.com/guilhem/tentacool/auth"
 	"github.com/guilhem/tentacool/dns"
-	"github.com/guilhem/tentacool/gateway"
-	"github.com/guilhem/tentacool/interfaces"
+	"github.com/guilhem/tentacool/linkwatch"
+	"github.com/guilhem/tentacool/migrations"
 )
 
 const (
@@ -32,11 +33,7 @@ const (
 	addressBucket = "address"
 )
 
-var (
-	db *bolt.DB
-	ln net.Listener
-)
-
+// Web runs the tentacool server
 func Web(cmd *cobra.Command, args []string) {
 
 	conf, err := globalconf.New(appName)
@@ -45,65 +42,79 @@ func Web(cmd *cobra.Command, args []string) {
 	}
 	conf.ParseAll()
 
+	var network string
+	if _, err := net.ResolveTCPAddr("tcp", viper.GetString("bind")); err == nil {
+		network = "tcp"
+	} else {
+		network = "unix"
+	}
+	if network == "tcp" && viper.GetString("tls-cert") == "" && !viper.GetBool("insecure-tcp") {
+		log.Fatal("TCP bind without TLS would send bearer tokens in clear, set --tls-cert or --insecure-tcp")
+	}
+
 	db, err := bolt.Open(viper.GetString("db"), 0600, &bolt.Options{Timeout: 1 * time.Second})
 	if err != nil {
 		log.WithError(err).Fatal()
 	}
 	defer db.Close()
 
-	if viper.GetString("setip") != "" {
-		if err = addresses.DBinit(db); err != nil {
-			log.Fatal(err)
-		}
-		splited := strings.Split(viper.GetString("setip"), ":")
-		if len(splited) < 3 {
-			log.Fatal("ID:Link:CIDR required")
-		}
-		id, link, ip := splited[0], splited[1], splited[2]
-		addresses.CommandSetIP(id, link, ip)
-		os.Exit(0)
+	if err := migrations.Run(db); err != nil {
+		log.WithError(err).Fatal()
 	}
 
-	api := rest.NewApi()
-
-	router, err := rest.MakeRouter(
-		&rest.Route{"GET", "/interfaces", interfaces.GetIfaces},
-		&rest.Route{"GET", "/interfaces/:iface", interfaces.GetIface},
-
-		&rest.Route{"GET", "/addresses", addresses.GetAddresses},
-		&rest.Route{"POST", "/addresses", addresses.PostAddress},
-		&rest.Route{"GET", "/addresses/:address", addresses.GetAddress},
-		&rest.Route{"PUT", "/addresses/:address", addresses.PutAddress},
-		&rest.Route{"DELETE", "/addresses/:address", addresses.DeleteAddress},
-
-		&rest.Route{"GET", "/dhcp", dhcp.GetDhcp},
-		&rest.Route{"POST", "/dhcp", dhcp.PostDhcp},
-
-		&rest.Route{"GET", "/dns", dns.GetDNS},
-		&rest.Route{"POST", "/dns", dns.PostDNS},
-
-		&rest.Route{"GET", "/routes", getRoutes},
-		&rest.Route{"POST", "/routes/gateway", gateway.PostGateway},
-		&rest.Route{"GET", "/routes/gateway", gateway.GetGateway},
-	)
+	dnsBackend, err := dns.NewBackend(viper.GetString("dns-backend"), viper.GetString("dns-link"))
 	if err != nil {
-		log.Fatal(err)
+		log.WithError(err).Fatal()
 	}
+	handlers := NewHandlers(db, dnsBackend)
 
-	api.SetApp(router)
-
-	var network string
-	if _, err = net.ResolveTCPAddr("tcp", viper.GetString("bind")); err == nil {
-		network = "tcp"
+	// TCP clients must authenticate, unix peers are
+	// identified by their credentials and checked against the policy
+	var middlewares []rest.Middleware
+	if network == "tcp" {
+		middlewares = append(middlewares, handlers.Auth.Middleware())
 	} else {
-		network = "unix"
+		if viper.IsSet("peers") {
+			policy := &auth.Policy{}
+			if err := viper.UnmarshalKey("roles", &policy.Roles); err != nil {
+				log.WithError(err).Fatal()
+			}
+			if err := viper.UnmarshalKey("peers", &policy.Peers); err != nil {
+				log.WithError(err).Fatal()
+			}
+			if err := policy.Validate(); err != nil {
+				log.WithError(err).Fatal()
+			}
+			handlers.Auth.Policy = policy
+		}
+		middlewares = append(middlewares, handlers.Auth.PeerMiddleware())
+	}
+	api, err := NewAPI(handlers, middlewares...)
+	if err != nil {
+		log.Fatal(err)
 	}
-	ln, err = net.Listen(network, viper.GetString("bind"))
+
+	ln, err := net.Listen(network, viper.GetString("bind"))
 	if nil != err {
 		log.WithError(err).Fatal()
 	}
 	defer ln.Close()
 
+	if network == "unix" {
+		ln = auth.PeerListener(ln)
+	}
+	if network == "tcp" {
+		if viper.GetString("tls-cert") != "" {
+			config, err := tlsConfig(viper.GetString("tls-cert"), viper.GetString("tls-key"), viper.GetString("tls-client-ca"))
+			if err != nil {
+				log.WithError(err).Fatal()
+			}
+			ln = tls.NewListener(ln, config)
+		} else {
+			log.Warn("TCP bind without TLS, bearer tokens are sent in clear")
+		}
+	}
+
 	if viper.GetString("owner") != "" && network == "unix" {
 		user, err := user.Lookup(viper.GetString("owner"))
 		if err != nil {
@@ -130,17 +141,19 @@ func Web(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	if err := dhcp.DBinit(db); err != nil {
+	// watching links first, for the objects stored on a link
+	// appearing during DBinit to be applied
+	watcher := &linkwatch.Watcher{Listeners: []linkwatch.Listener{handlers.Addresses, handlers.Gateway}}
+	if err := watcher.Start(); err != nil {
 		log.WithError(err).Fatal()
 	}
-	if err := addresses.DBinit(db); err != nil {
+	if err := handlers.DBinit(); err != nil {
 		log.WithError(err).Fatal()
 	}
-	if err := dns.DBinit(db); err != nil {
-		log.WithError(err).Fatal()
-	}
-	if err := gateway.DBinit(db); err != nil {
-		log.WithError(err).Fatal()
+	if listen := viper.GetStringSlice("dns-forwarder"); len(listen) > 0 {
+		if err := handlers.Forwarder.Start(listen, viper.GetInt("dns-forwarder-cache")); err != nil {
+			log.WithError(err).Fatal()
+		}
 	}
 
 	// Handle common process-killing signals so we can gracefully shut down:
@@ -152,6 +165,8 @@ func Web(cmd *cobra.Command, args []string) {
 		log.Printf("Caught signal %s: shutting down.", sig)
 		// Stop listening (and unlink the socket if unix type):
 		ln.Close()
+		watcher.Stop()
+		handlers.Forwarder.Stop()
 		db.Close()
 		os.Exit(0)
 	}(sigc)
@@ -160,12 +175,27 @@ func Web(cmd *cobra.Command, args []string) {
 	log.Fatal(http.Serve(ln, api.MakeHandler()))
 }
 
-func getRoutes(w rest.ResponseWriter, req *rest.Request) {
-	routes, err := netlink.RouteList(nil, netlink.FAMILY_ALL)
+// tlsConfig loads the server certificate, client certificates are
+// verified against clientCA when set, bearer tokens still being accepted
+func tlsConfig(cert, key, clientCA string) (*tls.Config, error) {
+	pair, err := tls.LoadX509KeyPair(cert, key)
 	if err != nil {
-		log.Printf(err.Error())
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCA != "" {
+		pem, err := ioutil.ReadFile(clientCA)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in " + clientCA)
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
 	}
-	w.WriteJson(routes)
+	return config, nil
 }
@@ -0,0 +1,51 @@
+package web
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/boltdb/bolt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/guilhem/tentacool/audit"
+	"github.com/guilhem/tentacool/auth"
+	"github.com/guilhem/tentacool/migrations"
+)
+
+// CreateToken stores a new API token in the DB and prints its secret,
+// for the first TCP client of a server without Unix socket or client
+// CA. The server must be stopped.
+func CreateToken(cmd *cobra.Command, args []string) {
+	// keep stdout for the secret
+	log.SetOutput(os.Stderr)
+
+	if len(args) != 1 || args[0] == "" {
+		log.Fatal("Expecting the name of the token")
+	}
+	db, err := bolt.Open(viper.GetString("db"), 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		log.WithError(err).Fatal("Can't open DB, use POST /v1/tokens while the server runs")
+	}
+	defer db.Close()
+
+	if err := migrations.Run(db); err != nil {
+		log.WithError(err).Fatal()
+	}
+	h := &auth.Handler{DB: db}
+	if err := h.DBinit(); err != nil {
+		log.WithError(err).Fatal()
+	}
+	var token auth.Token
+	err = audited(&audit.Handler{DB: db}, "CREATE", args[0], "tokens", func() (err error) {
+		token, err = h.Create(args[0])
+		return
+	})
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+	fmt.Println(token.Token)
+}